@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createEntry returns a provider that records an audit entity
+func createEntry(tenantId uuid.UUID, actor string, action string, npcId uint32, commodityId uuid.UUID, before string, after string) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		entity := Entity{
+			Id:          uuid.New(),
+			TenantId:    tenantId,
+			Actor:       actor,
+			Action:      action,
+			NpcId:       npcId,
+			CommodityId: commodityId,
+			Before:      before,
+			After:       after,
+		}
+		err := db.Create(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Entity is the GORM entity for the audit Model
+type Entity struct {
+	Id          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId    uuid.UUID `gorm:"type:uuid;not null;index:idx_shop_audits_tenant_created,priority:1"`
+	Actor       string    `gorm:"not null;index"`
+	Action      string    `gorm:"not null"`
+	NpcId       uint32    `gorm:"not null;default:0;index"`
+	CommodityId uuid.UUID `gorm:"type:uuid;index"`
+	Before      string    `gorm:"type:text;not null;default:''"`
+	After       string    `gorm:"type:text;not null;default:''"`
+	CreatedAt   time.Time `gorm:"not null;index:idx_shop_audits_tenant_created,priority:2"`
+}
+
+func (e *Entity) TableName() string {
+	return "shop_audits"
+}
+
+// Make converts an Entity to a Model
+func Make(entity Entity) (Model, error) {
+	return Model{
+		id:          entity.Id,
+		actor:       entity.Actor,
+		action:      entity.Action,
+		npcId:       entity.NpcId,
+		commodityId: entity.CommodityId,
+		before:      entity.Before,
+		after:       entity.After,
+		createdAt:   entity.CreatedAt,
+	}, nil
+}
+
+func Migration(db *gorm.DB) error {
+	return db.AutoMigrate(&Entity{})
+}
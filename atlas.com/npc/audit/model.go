@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ActionCreateShop             = "CREATE_SHOP"
+	ActionUpdateShop             = "UPDATE_SHOP"
+	ActionDeleteShop             = "DELETE_SHOP"
+	ActionRestoreShop            = "RESTORE_SHOP"
+	ActionRestoreShopsAsOf       = "RESTORE_SHOPS_AS_OF"
+	ActionPurgeShops             = "PURGE_SHOPS"
+	ActionCreateCommodity        = "CREATE_COMMODITY"
+	ActionUpdateCommodity        = "UPDATE_COMMODITY"
+	ActionDeleteCommodity        = "DELETE_COMMODITY"
+	ActionRestoreCommodity       = "RESTORE_COMMODITY"
+	ActionRestoreCommoditiesAsOf = "RESTORE_COMMODITIES_AS_OF"
+	ActionPurgeCommodities       = "PURGE_COMMODITIES"
+	ActionCreateShopTemplate     = "CREATE_SHOP_TEMPLATE"
+	ActionUpdateShopTemplate     = "UPDATE_SHOP_TEMPLATE"
+	ActionDeleteShopTemplate     = "DELETE_SHOP_TEMPLATE"
+)
+
+// SystemActor is recorded for changes made without an identified actor, such as catalog seeding.
+const SystemActor = "system"
+
+// Model is a recorded change to a shop or commodity
+type Model struct {
+	id          uuid.UUID
+	actor       string
+	action      string
+	npcId       uint32
+	commodityId uuid.UUID
+	before      string
+	after       string
+	createdAt   time.Time
+}
+
+// Id returns the id of the audit entry
+func (m *Model) Id() uuid.UUID {
+	return m.id
+}
+
+// Actor returns who made the change
+func (m *Model) Actor() string {
+	return m.actor
+}
+
+// Action returns what kind of change was made
+func (m *Model) Action() string {
+	return m.action
+}
+
+// NpcId returns the NPC of the changed shop, or 0 for changes spanning the tenant
+func (m *Model) NpcId() uint32 {
+	return m.npcId
+}
+
+// CommodityId returns the changed commodity, or uuid.Nil for changes to a shop
+func (m *Model) CommodityId() uuid.UUID {
+	return m.commodityId
+}
+
+// Before returns the JSON of the changed resource before the change, or an empty string when it did not exist
+func (m *Model) Before() string {
+	return m.before
+}
+
+// After returns the JSON of the changed resource after the change, or an empty string when it no longer exists
+func (m *Model) After() string {
+	return m.after
+}
+
+// CreatedAt returns when the change was made
+func (m *Model) CreatedAt() time.Time {
+	return m.createdAt
+}
+
+// Filter restricts the audit entries returned. Zero values do not restrict.
+type Filter struct {
+	NpcId       uint32
+	CommodityId uuid.UUID
+	Actor       string
+	From        time.Time
+	To          time.Time
+}
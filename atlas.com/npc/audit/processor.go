@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"atlas-npc/rest"
+	"context"
+	"encoding/json"
+	"github.com/Chronicle20/atlas-model/model"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type Processor interface {
+	WithTransaction(tx *gorm.DB) Processor
+	Record(action string, npcId uint32, commodityId uuid.UUID, before any, after any) error
+	GetByFilter(f Filter) ([]Model, error)
+	ByFilterProvider(f Filter) model.Provider[[]Model]
+}
+
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+	db  *gorm.DB
+	t   tenant.Model
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+		db:  db,
+		t:   tenant.MustFromContext(ctx),
+	}
+}
+
+func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   p.l,
+		ctx: p.ctx,
+		db:  tx,
+		t:   p.t,
+	}
+}
+
+// Record stores an audit entry for a change made by the actor of the processor's context. The before and after states
+// are stored as JSON, and are nil when the resource did not exist before or no longer exists after the change.
+func (p *ProcessorImpl) Record(action string, npcId uint32, commodityId uuid.UUID, before any, after any) error {
+	actor, ok := rest.ActorFromContext(p.ctx)
+	if !ok {
+		actor = SystemActor
+	}
+	bj, err := marshal(before)
+	if err != nil {
+		return err
+	}
+	aj, err := marshal(after)
+	if err != nil {
+		return err
+	}
+	_, err = createEntry(p.t.Id(), actor, action, npcId, commodityId, bj, aj)(p.db)()
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to record [%s] by [%s] for NPC [%d].", action, actor, npcId)
+		return err
+	}
+	return nil
+}
+
+func marshal(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (p *ProcessorImpl) GetByFilter(f Filter) ([]Model, error) {
+	return p.ByFilterProvider(f)()
+}
+
+func (p *ProcessorImpl) ByFilterProvider(f Filter) model.Provider[[]Model] {
+	return model.SliceMap(Make)(getByFilter(p.t.Id(), f)(p.db))(model.ParallelMap())
+}
@@ -0,0 +1,159 @@
+package audit_test
+
+import (
+	"atlas-npc/audit"
+	"atlas-npc/commodities"
+	"atlas-npc/rest"
+	"atlas-npc/shops"
+	"atlas-npc/templates"
+	"atlas-npc/test"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"testing"
+	"time"
+)
+
+func TestAuditTrail(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	ctx := rest.WithActor(test.CreateTestContext(), "gm-alice")
+	sp := shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(func(templateId uint32) error {
+		return nil
+	})
+	ap := audit.NewProcessor(logrus.New(), ctx, db)
+	npcId := uint32(9100)
+	start := time.Now().Add(-time.Second)
+
+	if _, err := sp.CreateShop(shops.NewBuilder(npcId).SetName("General Store").Build()); err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	c, err := sp.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build())
+	if err != nil {
+		t.Fatalf("Failed to add commodity: %v", err)
+	}
+	if _, err = sp.UpdateCommodity(c.Id(), (&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(75).Build()); err != nil {
+		t.Fatalf("Failed to update commodity: %v", err)
+	}
+	if err = sp.RemoveCommodity(c.Id()); err != nil {
+		t.Fatalf("Failed to remove commodity: %v", err)
+	}
+
+	// Every change to the shop is recorded against the actor, most recent first
+	entries, err := ap.GetByFilter(audit.Filter{NpcId: npcId})
+	if err != nil {
+		t.Fatalf("Failed to get audit entries: %v", err)
+	}
+	expected := []string{audit.ActionDeleteCommodity, audit.ActionUpdateCommodity, audit.ActionCreateCommodity, audit.ActionCreateShop}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d audit entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range entries {
+		if e.Action() != expected[i] || e.Actor() != "gm-alice" {
+			t.Errorf("Expected entry %d to be %s by gm-alice, got %s by %s", i, expected[i], e.Action(), e.Actor())
+		}
+	}
+
+	// The price change is captured in the before and after states
+	update := entries[1]
+	var before, after struct {
+		MesoPrice uint32 `json:"mesoPrice"`
+	}
+	if err = json.Unmarshal([]byte(update.Before()), &before); err != nil {
+		t.Fatalf("Failed to parse before state: %v", err)
+	}
+	if err = json.Unmarshal([]byte(update.After()), &after); err != nil {
+		t.Fatalf("Failed to parse after state: %v", err)
+	}
+	if before.MesoPrice != 50 || after.MesoPrice != 75 {
+		t.Errorf("Expected price to change from 50 to 75, got %d to %d", before.MesoPrice, after.MesoPrice)
+	}
+	deletion := entries[0]
+	if deletion.After() != "" {
+		t.Errorf("Expected a deleted commodity to have no after state, got %s", deletion.After())
+	}
+
+	// Filters narrow the entries returned
+	filters := []struct {
+		name     string
+		filter   audit.Filter
+		expected int
+	}{
+		{"commodity", audit.Filter{CommodityId: c.Id()}, 3},
+		{"actor", audit.Filter{Actor: "gm-bob"}, 0},
+		{"time range", audit.Filter{NpcId: npcId, From: start, To: time.Now().Add(time.Second)}, 4},
+		{"future", audit.Filter{From: time.Now().Add(time.Hour)}, 0},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ap.GetByFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("Failed to get audit entries: %v", err)
+			}
+			if len(got) != tt.expected {
+				t.Errorf("Expected %d audit entries, got %d", tt.expected, len(got))
+			}
+		})
+	}
+}
+
+func TestShopTemplateAuditTrail(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	ctx := rest.WithActor(test.CreateTestContext(), "gm-carol")
+	tp := templates.NewProcessor(logrus.New(), ctx, db)
+	ap := audit.NewProcessor(logrus.New(), ctx, db)
+
+	tm, err := tp.Create(templates.NewBuilder(uuid.Nil).SetName("Potion Shop").SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+	if _, err = tp.Update(templates.Clone(tm).SetName("Elixir Shop").Build()); err != nil {
+		t.Fatalf("Failed to update shop template: %v", err)
+	}
+	if err = tp.Delete(tm.Id()); err != nil {
+		t.Fatalf("Failed to delete shop template: %v", err)
+	}
+
+	// Every change to the template is recorded against the actor, most recent first
+	entries, err := ap.GetByFilter(audit.Filter{Actor: "gm-carol"})
+	if err != nil {
+		t.Fatalf("Failed to get audit entries: %v", err)
+	}
+	expected := []string{audit.ActionDeleteShopTemplate, audit.ActionUpdateShopTemplate, audit.ActionCreateShopTemplate}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d audit entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range entries {
+		if e.Action() != expected[i] || e.NpcId() != 0 {
+			t.Errorf("Expected entry %d to be %s for NPC 0, got %s for NPC %d", i, expected[i], e.Action(), e.NpcId())
+		}
+	}
+
+	// The rename and the template commodities are captured in the before and after states
+	var before, after struct {
+		Name        string `json:"name"`
+		Commodities []struct {
+			MesoPrice uint32 `json:"mesoPrice"`
+		} `json:"commodities"`
+	}
+	if err = json.Unmarshal([]byte(entries[1].Before()), &before); err != nil {
+		t.Fatalf("Failed to parse before state: %v", err)
+	}
+	if err = json.Unmarshal([]byte(entries[1].After()), &after); err != nil {
+		t.Fatalf("Failed to parse after state: %v", err)
+	}
+	if before.Name != "Potion Shop" || after.Name != "Elixir Shop" {
+		t.Errorf("Expected name to change from Potion Shop to Elixir Shop, got %s to %s", before.Name, after.Name)
+	}
+	if len(before.Commodities) != 1 || len(after.Commodities) != 1 {
+		t.Errorf("Expected the template commodity in both states, got %d and %d", len(before.Commodities), len(after.Commodities))
+	}
+	if entries[0].After() != "" {
+		t.Errorf("Expected a deleted template to have no after state, got %s", entries[0].After())
+	}
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// getByFilter returns a provider that gets the audit entities of a tenant matching the filter, most recent first
+func getByFilter(tenantId uuid.UUID, f Filter) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		q := db.Where("tenant_id = ?", tenantId)
+		if f.NpcId != 0 {
+			q = q.Where("npc_id = ?", f.NpcId)
+		}
+		if f.CommodityId != uuid.Nil {
+			q = q.Where("commodity_id = ?", f.CommodityId)
+		}
+		if f.Actor != "" {
+			q = q.Where("actor = ?", f.Actor)
+		}
+		if !f.From.IsZero() {
+			q = q.Where("created_at >= ?", f.From)
+		}
+		if !f.To.IsZero() {
+			q = q.Where("created_at < ?", f.To)
+		}
+
+		var results []Entity
+		err := q.Order("created_at DESC").Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"atlas-npc/rest"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/server"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
+	return func(db *gorm.DB) server.RouteInitializer {
+		return func(router *mux.Router, l logrus.FieldLogger) {
+			router.HandleFunc("/shops/audit", rest.RegisterHandler(l)(db)(si)("get_shop_audit", handleGetAudit)).Methods(http.MethodGet)
+		}
+	}
+}
+
+// filterFromQuery builds a Filter from the npcId, commodityId, actor, from and to query parameters.
+func filterFromQuery(query url.Values) (Filter, error) {
+	f := Filter{Actor: query.Get("actor")}
+	if v := query.Get("npcId"); v != "" {
+		npcId, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.NpcId = uint32(npcId)
+	}
+	if v := query.Get("commodityId"); v != "" {
+		commodityId, err := uuid.Parse(v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.CommodityId = commodityId
+	}
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.To = to
+	}
+	return f, nil
+}
+
+func handleGetAudit(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := filterFromQuery(r.URL.Query())
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Parsing audit filter.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ms, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetByFilter(f)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Getting audit entries.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(Transform)(model.FixedProvider(ms))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
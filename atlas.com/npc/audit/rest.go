@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// RestModel is a JSON API representation of the Model
+type RestModel struct {
+	Id          string          `json:"-"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	NpcId       uint32          `json:"npcId"`
+	CommodityId string          `json:"commodityId,omitempty"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r RestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *RestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r RestModel) GetName() string {
+	return "shop-audits"
+}
+
+// Transform converts a Model to a RestModel
+func Transform(m Model) (RestModel, error) {
+	rm := RestModel{
+		Id:        m.Id().String(),
+		Actor:     m.Actor(),
+		Action:    m.Action(),
+		NpcId:     m.NpcId(),
+		Before:    rawJson(m.Before()),
+		After:     rawJson(m.After()),
+		CreatedAt: m.CreatedAt(),
+	}
+	if m.CommodityId() != uuid.Nil {
+		rm.CommodityId = m.CommodityId().String()
+	}
+	return rm, nil
+}
+
+// rawJson embeds stored JSON as is, or null when there is none.
+func rawJson(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
@@ -0,0 +1,73 @@
+package catalog
+
+import (
+	"atlas-npc/shops"
+	"encoding/csv"
+	"github.com/google/uuid"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteCsv writes shops in the flat CSV format accepted by Parse. Shop settings are repeated on every row of the shop,
+// and a shop without commodities is written as a single row without a templateId.
+func WriteCsv(w io.Writer, ms []shops.Model) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		shopTemplateId := ""
+		if m.ShopTemplateId() != uuid.Nil {
+			shopTemplateId = m.ShopTemplateId().String()
+		}
+		excludedItems := make([]string, 0, len(m.ExcludedItems()))
+		for _, id := range m.ExcludedItems() {
+			excludedItems = append(excludedItems, formatUint(id))
+		}
+		shop := []string{
+			formatUint(m.NpcId()),
+			strconv.FormatBool(m.Recharger()),
+			m.Name(),
+			m.Description(),
+			m.OpensAt(),
+			m.ClosesAt(),
+			m.TimeZone(),
+			strconv.FormatBool(m.Enabled()),
+			shopTemplateId,
+			strings.Join(excludedItems, ";"),
+		}
+
+		if len(m.Commodities()) == 0 {
+			if err := cw.Write(append(shop, make([]string, len(csvColumns)-len(shop))...)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, c := range m.Commodities() {
+			record := append(append(make([]string, 0, len(csvColumns)), shop...),
+				formatUint(c.TemplateId()),
+				formatUint(c.MesoPrice()),
+				formatUint(c.DiscountRate()),
+				formatUint(c.TokenTemplateId()),
+				formatUint(c.TokenPrice()),
+				formatUint(c.Period()),
+				formatUint(c.LevelLimit()),
+				formatUint(c.JobMask()),
+				formatUint(c.Gender()),
+				formatUint(c.QuestId()),
+				formatUint(c.QuestState()),
+			)
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatUint[T uint32 | uint16 | byte](v T) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
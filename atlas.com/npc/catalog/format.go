@@ -0,0 +1,337 @@
+package catalog
+
+import (
+	"atlas-npc/commodities"
+	"atlas-npc/shops"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatJsonApi  Format = "jsonapi"
+	FormatCsv      Format = "csv"
+	FormatEmulator Format = "emulator"
+
+	// PerfectPitchTemplateId is the token item emulator shops price their `pitch` column in.
+	PerfectPitchTemplateId = uint32(4310000)
+)
+
+var ErrUnknownFormat = errors.New("unknown catalog format")
+var ErrMalformedCatalog = errors.New("malformed catalog")
+
+// csvColumns are the columns of the flat CSV format. Each row is a commodity, repeating the settings of its shop. A row
+// without a templateId declares a shop with no commodities of its own.
+var csvColumns = []string{
+	"npcId", "recharger", "name", "description", "opensAt", "closesAt", "timeZone", "enabled", "shopTemplateId", "excludedItems",
+	"templateId", "mesoPrice", "discountRate", "tokenTemplateId", "tokenPrice", "period", "levelLimit", "jobMask", "gender", "questId", "questState",
+}
+
+// Parse reads a catalog in the given format. Problems with individual rows are reported rather than failing the parse.
+func Parse(format Format, body []byte) ([]Entry, []RowError, error) {
+	switch format {
+	case FormatJsonApi:
+		return parseJsonApi(body)
+	case FormatCsv:
+		return parseCsv(body)
+	case FormatEmulator:
+		return parseEmulator(body)
+	}
+	return nil, nil, fmt.Errorf("%w [%s]", ErrUnknownFormat, format)
+}
+
+func parseJsonApi(body []byte) ([]Entry, []RowError, error) {
+	var rms []shops.RestModel
+	if err := jsonapi.Unmarshal(body, &rms); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedCatalog, err)
+	}
+
+	entries := make([]Entry, 0, len(rms))
+	rowErrors := make([]RowError, 0)
+	seen := make(map[uint32]int)
+	for i, rm := range rms {
+		row := i + 1
+		if prev, ok := seen[rm.NpcId]; ok {
+			rowErrors = append(rowErrors, RowError{source: "data", row: row, npcId: rm.NpcId, message: fmt.Sprintf("shop already defined on row %d", prev)})
+			continue
+		}
+		seen[rm.NpcId] = row
+
+		m, err := shops.Extract(rm)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{source: "data", row: row, npcId: rm.NpcId, message: err.Error()})
+			continue
+		}
+		entries = append(entries, Entry{source: "data", row: row, shop: m, commoditySource: "data"})
+	}
+	return entries, rowErrors, nil
+}
+
+// csvRow reads named columns of a CSV record, remembering the first value which fails to parse.
+type csvRow struct {
+	columns map[string]int
+	record  []string
+	err     error
+}
+
+func (r *csvRow) get(name string) string {
+	i, ok := r.columns[name]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r *csvRow) uint(name string, bitSize int) uint64 {
+	v := r.get(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseUint(v, 10, bitSize)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s [%s]", name, v)
+	}
+	return n
+}
+
+func (r *csvRow) bool(name string, def bool) bool {
+	v := r.get(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s [%s]", name, v)
+	}
+	return b
+}
+
+func (r *csvRow) uuid(name string) uuid.UUID {
+	v := r.get(name)
+	if v == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s [%s]", name, v)
+	}
+	return id
+}
+
+func (r *csvRow) uints(name string) []uint32 {
+	v := r.get(name)
+	result := make([]uint32, 0)
+	if v == "" {
+		return result
+	}
+	for _, s := range strings.Split(v, ";") {
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+		if err != nil {
+			if r.err == nil {
+				r.err = fmt.Errorf("invalid %s [%s]", name, v)
+			}
+			continue
+		}
+		result = append(result, uint32(n))
+	}
+	return result
+}
+
+func parseCsv(body []byte) ([]Entry, []RowError, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: reading header: %v", ErrMalformedCatalog, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["npcId"]; !ok {
+		return nil, nil, fmt.Errorf("%w: missing npcId column", ErrMalformedCatalog)
+	}
+
+	type pending struct {
+		row           int
+		builder       *shops.ModelBuilder
+		commodities   []commodities.Model
+		commodityRows []int
+	}
+	order := make([]uint32, 0)
+	byNpcId := make(map[uint32]*pending)
+	rowErrors := make([]RowError, 0)
+
+	// The header is row 1.
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{source: "csv", row: row, message: err.Error()})
+			continue
+		}
+
+		r := &csvRow{columns: columns, record: record}
+		npcId := uint32(r.uint("npcId", 32))
+		if r.err != nil || npcId == 0 {
+			rowErrors = append(rowErrors, RowError{source: "csv", row: row, message: fmt.Sprintf("invalid npcId [%s]", r.get("npcId"))})
+			continue
+		}
+
+		p, ok := byNpcId[npcId]
+		if !ok {
+			// Shop settings are taken from the first row of the shop.
+			b := shops.NewBuilder(npcId).
+				SetRecharger(r.bool("recharger", false)).
+				SetName(r.get("name")).
+				SetDescription(r.get("description")).
+				SetOpensAt(r.get("opensAt")).
+				SetClosesAt(r.get("closesAt")).
+				SetTimeZone(r.get("timeZone")).
+				SetEnabled(r.bool("enabled", true)).
+				SetShopTemplateId(r.uuid("shopTemplateId")).
+				SetExcludedItems(r.uints("excludedItems"))
+			if r.err != nil {
+				rowErrors = append(rowErrors, RowError{source: "csv", row: row, npcId: npcId, message: r.err.Error()})
+				continue
+			}
+			p = &pending{row: row, builder: b}
+			byNpcId[npcId] = p
+			order = append(order, npcId)
+		}
+
+		if r.get("templateId") == "" {
+			continue
+		}
+		c := (&commodities.ModelBuilder{}).
+			SetNpcId(npcId).
+			SetTemplateId(uint32(r.uint("templateId", 32))).
+			SetMesoPrice(uint32(r.uint("mesoPrice", 32))).
+			SetDiscountRate(byte(r.uint("discountRate", 8))).
+			SetTokenTemplateId(uint32(r.uint("tokenTemplateId", 32))).
+			SetTokenPrice(uint32(r.uint("tokenPrice", 32))).
+			SetPeriod(uint32(r.uint("period", 32))).
+			SetLevelLimit(uint32(r.uint("levelLimit", 32))).
+			SetJobMask(uint16(r.uint("jobMask", 16))).
+			SetGender(byte(r.uint("gender", 8))).
+			SetQuestId(uint32(r.uint("questId", 32))).
+			SetQuestState(byte(r.uint("questState", 8))).
+			Build()
+		if r.err != nil {
+			rowErrors = append(rowErrors, RowError{source: "csv", row: row, npcId: npcId, templateId: c.TemplateId(), message: r.err.Error()})
+			continue
+		}
+		p.commodities = append(p.commodities, c)
+		p.commodityRows = append(p.commodityRows, row)
+	}
+
+	entries := make([]Entry, 0, len(order))
+	for _, npcId := range order {
+		p := byNpcId[npcId]
+		entries = append(entries, Entry{source: "csv", row: p.row, shop: p.builder.SetCommodities(p.commodities).Build(), commoditySource: "csv", commodityRows: p.commodityRows})
+	}
+	return entries, rowErrors, nil
+}
+
+// emulatorCatalog mirrors the `shops` and `shopitems` tables of common v83 server emulators.
+type emulatorCatalog struct {
+	Shops     []emulatorShop     `json:"shops"`
+	ShopItems []emulatorShopItem `json:"shopitems"`
+}
+
+type emulatorShop struct {
+	ShopId uint32 `json:"shopid"`
+	NpcId  uint32 `json:"npcid"`
+}
+
+type emulatorShopItem struct {
+	ShopItemId uint32 `json:"shopitemid"`
+	ShopId     uint32 `json:"shopid"`
+	ItemId     uint32 `json:"itemid"`
+	Price      uint32 `json:"price"`
+	Pitch      uint32 `json:"pitch"`
+	Position   uint32 `json:"position"`
+}
+
+func parseEmulator(body []byte) ([]Entry, []RowError, error) {
+	var ec emulatorCatalog
+	if err := json.Unmarshal(body, &ec); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedCatalog, err)
+	}
+
+	rowErrors := make([]RowError, 0)
+	shopRows := make(map[uint32]int)
+	npcRows := make(map[uint32]int)
+	for i, s := range ec.Shops {
+		row := i + 1
+		if prev, ok := shopRows[s.ShopId]; ok {
+			rowErrors = append(rowErrors, RowError{source: "shops", row: row, npcId: s.NpcId, message: fmt.Sprintf("shopid [%d] already defined on row %d", s.ShopId, prev)})
+			continue
+		}
+		if prev, ok := npcRows[s.NpcId]; ok {
+			rowErrors = append(rowErrors, RowError{source: "shops", row: row, npcId: s.NpcId, message: fmt.Sprintf("npcid already has a shop on row %d", prev)})
+			continue
+		}
+		shopRows[s.ShopId] = row
+		npcRows[s.NpcId] = row
+	}
+
+	type item struct {
+		row int
+		emulatorShopItem
+	}
+	itemsByShop := make(map[uint32][]item)
+	for i, si := range ec.ShopItems {
+		row := i + 1
+		if _, ok := shopRows[si.ShopId]; !ok {
+			rowErrors = append(rowErrors, RowError{source: "shopitems", row: row, templateId: si.ItemId, message: fmt.Sprintf("unknown shopid [%d]", si.ShopId)})
+			continue
+		}
+		itemsByShop[si.ShopId] = append(itemsByShop[si.ShopId], item{row: row, emulatorShopItem: si})
+	}
+
+	entries := make([]Entry, 0, len(shopRows))
+	for i, s := range ec.Shops {
+		if shopRows[s.ShopId] != i+1 || npcRows[s.NpcId] != i+1 {
+			continue
+		}
+		items := itemsByShop[s.ShopId]
+		sort.SliceStable(items, func(a, b int) bool {
+			return items[a].Position < items[b].Position
+		})
+
+		cms := make([]commodities.Model, 0, len(items))
+		rows := make([]int, 0, len(items))
+		for _, it := range items {
+			b := (&commodities.ModelBuilder{}).
+				SetNpcId(s.NpcId).
+				SetTemplateId(it.ItemId).
+				SetMesoPrice(it.Price)
+			if it.Pitch > 0 {
+				b.SetTokenTemplateId(PerfectPitchTemplateId).SetTokenPrice(it.Pitch)
+			}
+			cms = append(cms, b.Build())
+			rows = append(rows, it.row)
+		}
+		// Emulators let any shop recharge throwing stars and bullets.
+		m := shops.NewBuilder(s.NpcId).SetRecharger(true).SetCommodities(cms).Build()
+		entries = append(entries, Entry{source: "shops", row: i + 1, shop: m, commoditySource: "shopitems", commodityRows: rows})
+	}
+	return entries, rowErrors, nil
+}
@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"atlas-npc/shops"
+)
+
+// Entry is a shop parsed from a catalog, along with where it and its commodities were found in the source.
+type Entry struct {
+	source          string
+	row             int
+	shop            shops.Model
+	commoditySource string
+	commodityRows   []int
+}
+
+// Source returns the section of the catalog the shop was defined in
+func (e Entry) Source() string {
+	return e.source
+}
+
+// Row returns the source row the shop was defined on
+func (e Entry) Row() int {
+	return e.row
+}
+
+// Shop returns the parsed shop and its commodities
+func (e Entry) Shop() shops.Model {
+	return e.shop
+}
+
+// CommoditySource returns the section of the catalog the commodities of the shop were defined in
+func (e Entry) CommoditySource() string {
+	return e.commoditySource
+}
+
+// CommodityRow returns the source row the i-th commodity of the shop was defined on
+func (e Entry) CommodityRow(i int) int {
+	if i < len(e.commodityRows) {
+		return e.commodityRows[i]
+	}
+	return e.row
+}
+
+// RowError describes why a row of a catalog could not be imported.
+type RowError struct {
+	source     string
+	row        int
+	npcId      uint32
+	templateId uint32
+	message    string
+}
+
+// Source returns the section of the catalog the row belongs to (e.g. "data", "csv", "shops", "shopitems")
+func (e RowError) Source() string {
+	return e.source
+}
+
+// Row returns the 1-based row within the source
+func (e RowError) Row() int {
+	return e.row
+}
+
+// NpcId returns the NPC of the shop the row belongs to, 0 if unknown
+func (e RowError) NpcId() uint32 {
+	return e.npcId
+}
+
+// TemplateId returns the item template of the row, 0 if the error is not about a commodity
+func (e RowError) TemplateId() uint32 {
+	return e.templateId
+}
+
+// Message returns a description of the problem
+func (e RowError) Message() string {
+	return e.message
+}
+
+// ImportResult summarizes an import. When it carries errors nothing was imported.
+type ImportResult struct {
+	shops       int
+	commodities int
+	errors      []RowError
+	skipped     []RowError
+}
+
+// Shops returns the number of shops imported
+func (r ImportResult) Shops() int {
+	return r.shops
+}
+
+// Commodities returns the number of commodities imported
+func (r ImportResult) Commodities() int {
+	return r.commodities
+}
+
+// Errors returns the rows which prevented the import
+func (r ImportResult) Errors() []RowError {
+	return r.errors
+}
+
+// Skipped returns the rows which were left out while the rest was imported
+func (r ImportResult) Skipped() []RowError {
+	return r.skipped
+}
@@ -0,0 +1,278 @@
+package catalog
+
+import (
+	"atlas-npc/commodities"
+	"atlas-npc/database"
+	"atlas-npc/shops"
+	"atlas-npc/templates"
+	"context"
+	"errors"
+	"fmt"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCatalog = errors.New("invalid catalog")
+var ErrUnknownCloneMode = errors.New("unknown clone mode")
+var ErrSameTenant = errors.New("source and target tenant are the same")
+
+type CloneMode string
+
+const (
+	// CloneModeOverwrite replaces target shops with the source shop for the same NPC.
+	CloneModeOverwrite CloneMode = "overwrite"
+	// CloneModeMerge keeps target shops, adding only the source commodities for items they do not already sell.
+	CloneModeMerge CloneMode = "merge"
+)
+
+type Processor interface {
+	Import(format Format, body []byte) (ImportResult, error)
+	Validate(entries []Entry) []RowError
+	Export() ([]shops.Model, error)
+	Clone(source tenant.Model, mode CloneMode, skipUnknownTemplates bool) (ImportResult, error)
+}
+
+type ProcessorImpl struct {
+	l                    logrus.FieldLogger
+	ctx                  context.Context
+	db                   *gorm.DB
+	t                    tenant.Model
+	ValidateTemplateIdFn func(templateId uint32) error
+	sp                   shops.Processor
+	cp                   commodities.Processor
+	tp                   templates.Processor
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
+	p := &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+		db:  db,
+		t:   tenant.MustFromContext(ctx),
+		sp:  shops.NewProcessor(l, ctx, db),
+		cp:  commodities.NewProcessor(l, ctx, db),
+		tp:  templates.NewProcessor(l, ctx, db),
+	}
+	return p
+}
+
+func (p *ProcessorImpl) validateTemplateId(templateId uint32) error {
+	if p.ValidateTemplateIdFn != nil {
+		return p.ValidateTemplateIdFn(templateId)
+	}
+	return p.cp.ValidateTemplateId(templateId)
+}
+
+// templateChecker returns a validator which looks up each item template once, however many rows reference it.
+func (p *ProcessorImpl) templateChecker() func(templateId uint32) error {
+	checked := make(map[uint32]error)
+	return func(templateId uint32) error {
+		if err, ok := checked[templateId]; ok {
+			return err
+		}
+		err := p.validateTemplateId(templateId)
+		checked[templateId] = err
+		return err
+	}
+}
+
+// Import replaces the shops found in the catalog, leaving other shops of the tenant untouched. Every row is validated
+// before anything is written; if any row is rejected, ErrInvalidCatalog is returned along with a report of every
+// rejected row and nothing is imported.
+func (p *ProcessorImpl) Import(format Format, body []byte) (ImportResult, error) {
+	entries, rowErrors, err := Parse(format, body)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	checkTemplate := p.templateChecker()
+	rowErrors = append(rowErrors, p.validate(entries, checkTemplate)...)
+	if len(rowErrors) > 0 {
+		p.l.Debugf("Rejecting [%s] catalog with [%d] invalid rows.", format, len(rowErrors))
+		return ImportResult{errors: rowErrors}, ErrInvalidCatalog
+	}
+
+	result, err := p.write(entries, checkTemplate)
+	if err != nil {
+		p.l.WithError(err).Errorf("Transaction failed while importing [%s] catalog.", format)
+		return ImportResult{}, err
+	}
+	p.l.Infof("Imported [%d] shops with [%d] commodities from [%s] catalog for tenant [%s].", result.shops, result.commodities, format, p.t.Id())
+	return result, nil
+}
+
+// write replaces the shops of the entries in a single transaction, reusing the template lookups of validation.
+func (p *ProcessorImpl) write(entries []Entry, checkTemplate func(templateId uint32) error) (ImportResult, error) {
+	result := ImportResult{errors: make([]RowError, 0), skipped: make([]RowError, 0)}
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		for _, e := range entries {
+			m := e.Shop()
+			s, err := p.sp.WithTransaction(tx).WithTemplateValidator(checkTemplate).UpdateShop(m)
+			if err != nil {
+				return fmt.Errorf("writing shop for NPC [%d]: %w", m.NpcId(), err)
+			}
+			result.shops++
+			result.commodities += len(s.Commodities())
+		}
+		return nil
+	})
+	if txErr != nil {
+		return ImportResult{}, txErr
+	}
+	return result, nil
+}
+
+// Validate checks the schedule and shop template of each shop, and the item and token templates of each commodity.
+// Item templates are looked up once regardless of how many rows reference them.
+func (p *ProcessorImpl) Validate(entries []Entry) []RowError {
+	return p.validate(entries, p.templateChecker())
+}
+
+func (p *ProcessorImpl) validate(entries []Entry, checkTemplate func(templateId uint32) error) []RowError {
+	rowErrors := make([]RowError, 0)
+	sp := p.sp.WithTemplateValidator(checkTemplate)
+	checkedShopTemplates := make(map[uuid.UUID]error)
+
+	for _, e := range entries {
+		s := e.Shop()
+		if err := s.ValidateSchedule(); err != nil {
+			rowErrors = append(rowErrors, RowError{source: e.Source(), row: e.Row(), npcId: s.NpcId(), message: err.Error()})
+		}
+		if id := s.ShopTemplateId(); id != uuid.Nil {
+			err, ok := checkedShopTemplates[id]
+			if !ok {
+				_, err = p.tp.GetById()(id)
+				checkedShopTemplates[id] = err
+			}
+			if err != nil {
+				rowErrors = append(rowErrors, RowError{source: e.Source(), row: e.Row(), npcId: s.NpcId(), message: fmt.Sprintf("%s [%s]", shops.ErrUnknownShopTemplate, id)})
+			}
+		}
+
+		var ces shops.CommodityErrors
+		if err := sp.ValidateCommodities(s.Commodities()); errors.As(err, &ces) {
+			for _, ce := range ces {
+				message := ce.Err.Error()
+				if ce.Attribute != "templateId" {
+					message = fmt.Sprintf("%s: %s", ce.Attribute, message)
+				}
+				rowErrors = append(rowErrors, RowError{source: e.CommoditySource(), row: e.CommodityRow(ce.Index), npcId: s.NpcId(), templateId: ce.TemplateId, message: message})
+			}
+		} else if err != nil {
+			rowErrors = append(rowErrors, RowError{source: e.Source(), row: e.Row(), npcId: s.NpcId(), message: err.Error()})
+		}
+	}
+	return rowErrors
+}
+
+// Export returns every shop of the tenant with its own commodities, in the shape Import accepts.
+func (p *ProcessorImpl) Export() ([]shops.Model, error) {
+	return p.sp.GetCatalog()
+}
+
+// Clone copies every shop of the source tenant into the tenant of the processor. Shop templates belong to the source
+// tenant, so inherited commodities are copied as the shop's own. When skipUnknownTemplates is set, commodities whose
+// item or token template is unknown to the target's data service are left out and reported as skipped; otherwise they
+// reject the clone as Import would.
+func (p *ProcessorImpl) Clone(source tenant.Model, mode CloneMode, skipUnknownTemplates bool) (ImportResult, error) {
+	if mode != CloneModeOverwrite && mode != CloneModeMerge {
+		return ImportResult{}, fmt.Errorf("%w [%s]", ErrUnknownCloneMode, mode)
+	}
+	if source.Id() == p.t.Id() {
+		return ImportResult{}, ErrSameTenant
+	}
+
+	sp := shops.NewProcessor(p.l, tenant.WithContext(p.ctx, source), p.db)
+	sms, err := sp.GetCatalog()
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to retrieve shops of tenant [%s].", source.Id())
+		return ImportResult{}, err
+	}
+
+	existing := make(map[uint32]shops.Model)
+	if mode == CloneModeMerge {
+		tms, err := p.sp.GetCatalog()
+		if err != nil {
+			return ImportResult{}, err
+		}
+		for _, tm := range tms {
+			existing[tm.NpcId()] = tm
+		}
+	}
+
+	checkTemplate := p.templateChecker()
+	skipped := make([]RowError, 0)
+	cloned := make([]Entry, 0, len(sms))
+	entries := make([]Entry, 0, len(sms))
+	for i, sm := range sms {
+		row := i + 1
+		cms := sm.Commodities()
+		if sm.ShopTemplateId() != uuid.Nil {
+			rm := sp.CommodityDecorator(sm)
+			cms = rm.Commodities()
+		}
+
+		kept := make([]commodities.Model, 0, len(cms))
+		for _, c := range cms {
+			if skipUnknownTemplates {
+				err := checkTemplate(c.TemplateId())
+				if err == nil && c.TokenTemplateId() != 0 {
+					err = checkTemplate(c.TokenTemplateId())
+				}
+				if err != nil {
+					skipped = append(skipped, RowError{source: "source", row: row, npcId: sm.NpcId(), templateId: c.TemplateId(), message: err.Error()})
+					continue
+				}
+			}
+			kept = append(kept, commodities.Clone(c).SetInherited(false).Build())
+		}
+		s := shops.Clone(sm).
+			SetShopTemplateId(uuid.Nil).
+			SetExcludedItems(make([]uint32, 0)).
+			SetCommodities(kept).
+			Build()
+		cloned = append(cloned, Entry{source: "source", row: row, shop: s, commoditySource: "source"})
+
+		if tm, ok := existing[sm.NpcId()]; ok {
+			s = p.mergeShop(tm, kept)
+		}
+		entries = append(entries, Entry{source: "source", row: row, shop: s, commoditySource: "source"})
+	}
+
+	// Only what comes from the source is validated; target shops kept by a merge are written back as they are.
+	rowErrors := p.validate(cloned, checkTemplate)
+	if len(rowErrors) > 0 {
+		p.l.Debugf("Rejecting clone of tenant [%s] with [%d] invalid rows.", source.Id(), len(rowErrors))
+		return ImportResult{errors: rowErrors, skipped: skipped}, ErrInvalidCatalog
+	}
+
+	result, err := p.write(entries, checkTemplate)
+	if err != nil {
+		p.l.WithError(err).Errorf("Transaction failed while cloning shops of tenant [%s].", source.Id())
+		return ImportResult{}, err
+	}
+	result.skipped = skipped
+	p.l.Infof("Cloned [%d] shops with [%d] commodities from tenant [%s] to tenant [%s], skipping [%d] commodities.", result.shops, result.commodities, source.Id(), p.t.Id(), len(skipped))
+	return result, nil
+}
+
+// mergeShop adds to the target shop the cloned commodities for items it neither sells nor excludes.
+func (p *ProcessorImpl) mergeShop(target shops.Model, cms []commodities.Model) shops.Model {
+	sold := make(map[uint32]bool)
+	resolved := p.sp.CommodityDecorator(target)
+	for _, c := range resolved.Commodities() {
+		sold[c.TemplateId()] = true
+	}
+	for _, id := range target.ExcludedItems() {
+		sold[id] = true
+	}
+
+	merged := append(make([]commodities.Model, 0, len(target.Commodities())+len(cms)), target.Commodities()...)
+	for _, c := range cms {
+		if !sold[c.TemplateId()] {
+			merged = append(merged, commodities.Clone(c).SetNpcId(target.NpcId()).Build())
+		}
+	}
+	return shops.Clone(target).SetCommodities(merged).Build()
+}
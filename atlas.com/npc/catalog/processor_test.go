@@ -0,0 +1,346 @@
+package catalog_test
+
+import (
+	"atlas-npc/catalog"
+	"atlas-npc/commodities"
+	"atlas-npc/shops"
+	"atlas-npc/templates"
+	"atlas-npc/test"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"testing"
+)
+
+func TestParseCsv(t *testing.T) {
+	body := "npcId,recharger,name,enabled,excludedItems,templateId,mesoPrice,tokenTemplateId,tokenPrice,jobMask\n" +
+		"9000,true,General Store,,2000000;2000001,2000002,50,,,\n" +
+		"9000,false,Ignored,false,,2000003,75,4310000,2,3\n" +
+		"9001,,Empty Shop,false,,,,,,\n" +
+		"abc,,Broken,,,,,,,\n" +
+		"9000,,,,,2000004,notanumber,,,\n"
+
+	entries, rowErrors, err := catalog.Parse(catalog.FormatCsv, []byte(body))
+	if err != nil {
+		t.Fatalf("Failed to parse catalog: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 shops, got %d", len(entries))
+	}
+	if len(rowErrors) != 2 || rowErrors[0].Row() != 5 || rowErrors[1].Row() != 6 {
+		t.Fatalf("Expected errors on rows 5 and 6, got %+v", rowErrors)
+	}
+
+	s := entries[0].Shop()
+	if s.NpcId() != 9000 || !s.Recharger() || s.Name() != "General Store" || !s.Enabled() {
+		t.Errorf("Shop settings were not taken from its first row")
+	}
+	if len(s.ExcludedItems()) != 2 {
+		t.Errorf("Expected 2 excluded items, got %d", len(s.ExcludedItems()))
+	}
+	if len(s.Commodities()) != 2 {
+		t.Fatalf("Expected 2 commodities, got %d", len(s.Commodities()))
+	}
+	c := s.Commodities()[1]
+	if c.TemplateId() != 2000003 || c.MesoPrice() != 75 || c.TokenTemplateId() != 4310000 || c.TokenPrice() != 2 || c.JobMask() != 3 {
+		t.Errorf("Commodity was not parsed correctly")
+	}
+	if entries[0].CommodityRow(1) != 3 {
+		t.Errorf("Expected commodity on row 3, got %d", entries[0].CommodityRow(1))
+	}
+
+	empty := entries[1].Shop()
+	if empty.Enabled() || len(empty.Commodities()) != 0 {
+		t.Errorf("Expected a disabled shop without commodities")
+	}
+}
+
+func TestParseEmulator(t *testing.T) {
+	body := `{
+		"shops": [{"shopid": 1, "npcid": 9000}, {"shopid": 2, "npcid": 9000}],
+		"shopitems": [
+			{"shopitemid": 1, "shopid": 1, "itemid": 2000001, "price": 100, "pitch": 0, "position": 2},
+			{"shopitemid": 2, "shopid": 1, "itemid": 2000000, "price": 0, "pitch": 5, "position": 1},
+			{"shopitemid": 3, "shopid": 3, "itemid": 2000002, "price": 10, "pitch": 0, "position": 1}
+		]
+	}`
+
+	entries, rowErrors, err := catalog.Parse(catalog.FormatEmulator, []byte(body))
+	if err != nil {
+		t.Fatalf("Failed to parse catalog: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 shop, got %d", len(entries))
+	}
+	if len(rowErrors) != 2 {
+		t.Fatalf("Expected 2 row errors, got %+v", rowErrors)
+	}
+
+	s := entries[0].Shop()
+	cms := s.Commodities()
+	if len(cms) != 2 || cms[0].TemplateId() != 2000000 || cms[1].TemplateId() != 2000001 {
+		t.Fatalf("Expected commodities ordered by position")
+	}
+	if cms[0].TokenTemplateId() != catalog.PerfectPitchTemplateId || cms[0].TokenPrice() != 5 {
+		t.Errorf("Expected pitch to be priced in Perfect Pitch")
+	}
+	if entries[0].CommoditySource() != "shopitems" || entries[0].CommodityRow(0) != 2 {
+		t.Errorf("Expected first commodity from shopitems row 2, got %s row %d", entries[0].CommoditySource(), entries[0].CommodityRow(0))
+	}
+}
+
+func TestImport(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	unknownTemplateId := uint32(2999999)
+	ctx := test.CreateTestContext()
+	p := catalog.NewProcessor(logrus.New(), ctx, db)
+	validated := make(map[uint32]int)
+	p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+		validated[templateId]++
+		if templateId == unknownTemplateId {
+			return fmt.Errorf("%w [%d]", commodities.ErrUnknownTemplate, templateId)
+		}
+		return nil
+	}
+	cp := commodities.NewProcessor(logrus.New(), ctx, db)
+
+	// A single unknown template rejects the whole catalog
+	body := "npcId,templateId,mesoPrice\n" +
+		"9000,2000000,50\n" +
+		"9001,2000000,60\n" +
+		fmt.Sprintf("9001,%d,70\n", unknownTemplateId)
+	result, err := p.Import(catalog.FormatCsv, []byte(body))
+	if !errors.Is(err, catalog.ErrInvalidCatalog) {
+		t.Fatalf("Expected ErrInvalidCatalog, got %v", err)
+	}
+	if len(result.Errors()) != 1 || result.Errors()[0].Row() != 4 || result.Errors()[0].TemplateId() != unknownTemplateId {
+		t.Fatalf("Expected a single error on row 4, got %+v", result.Errors())
+	}
+	if validated[2000000] != 1 {
+		t.Errorf("Expected template 2000000 to be validated once, got %d", validated[2000000])
+	}
+	if exists, _ := cp.ExistsByNpcId(9000); exists {
+		t.Errorf("Expected nothing to be imported from a rejected catalog")
+	}
+
+	// An unknown shop template is reported against the shop
+	_, err = p.Import(catalog.FormatCsv, []byte("npcId,shopTemplateId\n9000,9d3f8c1e-4d2b-4c4e-9a55-1f0a3b2c6d7e\n"))
+	if !errors.Is(err, catalog.ErrInvalidCatalog) {
+		t.Fatalf("Expected ErrInvalidCatalog, got %v", err)
+	}
+
+	// A valid catalog replaces the listed shops
+	body = "npcId,templateId,mesoPrice\n" +
+		"9000,2000000,50\n" +
+		"9000,2000001,55\n" +
+		"9001,2000000,60\n"
+	result, err = p.Import(catalog.FormatCsv, []byte(body))
+	if err != nil {
+		t.Fatalf("Failed to import catalog: %v", err)
+	}
+	if result.Shops() != 2 || result.Commodities() != 3 {
+		t.Errorf("Expected 2 shops and 3 commodities, got %d and %d", result.Shops(), result.Commodities())
+	}
+	cms, err := cp.GetByNpcId(9000)
+	if err != nil || len(cms) != 2 {
+		t.Fatalf("Expected 2 commodities for NPC 9000, got %d (%v)", len(cms), err)
+	}
+
+	// Malformed documents fail outright
+	_, err = p.Import(catalog.FormatEmulator, []byte("{"))
+	if !errors.Is(err, catalog.ErrMalformedCatalog) {
+		t.Errorf("Expected ErrMalformedCatalog, got %v", err)
+	}
+	_, err = p.Import(catalog.Format("xml"), []byte(""))
+	if !errors.Is(err, catalog.ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	p := catalog.NewProcessor(logrus.New(), test.CreateTestContext(), db)
+	p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+		return nil
+	}
+
+	body := "npcId,recharger,name,description,opensAt,closesAt,timeZone,enabled,excludedItems,templateId,mesoPrice,discountRate,tokenTemplateId,tokenPrice,period,levelLimit,jobMask,gender,questId,questState\n" +
+		"9000,true,\"General Store, Henesys\",Sells potions,09:00,17:00,UTC,true,2000005;2000006,2000000,50,10,,,,,,,,\n" +
+		"9000,,,,,,,,,2000001,0,0,4310000,3,60,30,2,1,1000,2\n" +
+		"9001,false,Closed Shop,,,,,false,,,,,,,,,,,,\n"
+	_, err := p.Import(catalog.FormatCsv, []byte(body))
+	if err != nil {
+		t.Fatalf("Failed to import catalog: %v", err)
+	}
+
+	exported, err := p.Export()
+	if err != nil {
+		t.Fatalf("Failed to export catalog: %v", err)
+	}
+	if len(exported) != 2 || exported[0].NpcId() != 9000 || exported[1].NpcId() != 9001 {
+		t.Fatalf("Expected shops 9000 and 9001 in order")
+	}
+
+	compare := func(t *testing.T, entries []catalog.Entry) {
+		if len(entries) != len(exported) {
+			t.Fatalf("Expected %d shops, got %d", len(exported), len(entries))
+		}
+		for i, e := range entries {
+			want, got := exported[i], e.Shop()
+			if got.NpcId() != want.NpcId() || got.Recharger() != want.Recharger() || got.Name() != want.Name() ||
+				got.Description() != want.Description() || got.OpensAt() != want.OpensAt() || got.ClosesAt() != want.ClosesAt() ||
+				got.TimeZone() != want.TimeZone() || got.Enabled() != want.Enabled() || len(got.ExcludedItems()) != len(want.ExcludedItems()) {
+				t.Errorf("Shop [%d] settings did not round trip", want.NpcId())
+			}
+			if len(got.Commodities()) != len(want.Commodities()) {
+				t.Fatalf("Shop [%d] expected %d commodities, got %d", want.NpcId(), len(want.Commodities()), len(got.Commodities()))
+			}
+			for j, wc := range want.Commodities() {
+				gc := got.Commodities()[j]
+				if gc.TemplateId() != wc.TemplateId() || gc.MesoPrice() != wc.MesoPrice() || gc.DiscountRate() != wc.DiscountRate() ||
+					gc.TokenTemplateId() != wc.TokenTemplateId() || gc.TokenPrice() != wc.TokenPrice() || gc.Period() != wc.Period() ||
+					gc.LevelLimit() != wc.LevelLimit() || gc.JobMask() != wc.JobMask() || gc.Gender() != wc.Gender() ||
+					gc.QuestId() != wc.QuestId() || gc.QuestState() != wc.QuestState() {
+					t.Errorf("Commodity [%d] of shop [%d] did not round trip", wc.TemplateId(), want.NpcId())
+				}
+			}
+		}
+	}
+
+	t.Run("Csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := catalog.WriteCsv(&buf, exported); err != nil {
+			t.Fatalf("Failed to write CSV: %v", err)
+		}
+		entries, rowErrors, err := catalog.Parse(catalog.FormatCsv, buf.Bytes())
+		if err != nil || len(rowErrors) != 0 {
+			t.Fatalf("Failed to parse exported CSV: %v %+v", err, rowErrors)
+		}
+		compare(t, entries)
+	})
+
+	t.Run("JsonApi", func(t *testing.T) {
+		rms := make([]shops.RestModel, 0, len(exported))
+		for _, m := range exported {
+			rm, err := shops.Transform(m)
+			if err != nil {
+				t.Fatalf("Failed to transform shop: %v", err)
+			}
+			rms = append(rms, rm)
+		}
+		body, err := jsonapi.Marshal(rms)
+		if err != nil {
+			t.Fatalf("Failed to marshal shops: %v", err)
+		}
+		entries, rowErrors, err := catalog.Parse(catalog.FormatJsonApi, body)
+		if err != nil || len(rowErrors) != 0 {
+			t.Fatalf("Failed to parse exported JSON:API: %v %+v", err, rowErrors)
+		}
+		compare(t, entries)
+	})
+}
+
+func TestClone(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	unknownTemplateId := uint32(2999999)
+	validate := func(templateId uint32) error {
+		if templateId == unknownTemplateId {
+			return fmt.Errorf("%w [%d]", commodities.ErrUnknownTemplate, templateId)
+		}
+		return nil
+	}
+	newProcessor := func(ctx context.Context) catalog.Processor {
+		p := catalog.NewProcessor(logrus.New(), ctx, db)
+		p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = validate
+		return p
+	}
+
+	// The source tenant sells an item the target does not know, and has a shop inheriting from a template
+	sourceCtx := test.CreateTestContext()
+	source := tenant.MustFromContext(sourceCtx)
+	tm, err := templates.NewProcessor(logrus.New(), sourceCtx, db).Create(templates.NewBuilder(uuid.Nil).
+		SetName("Potion Shop").
+		SetCommodities([]commodities.Model{(&commodities.ModelBuilder{}).SetTemplateId(2000002).SetMesoPrice(10).Build()}).
+		Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+	body := "npcId,shopTemplateId,templateId,mesoPrice\n" +
+		"9000,,2000000,50\n" +
+		"9000,,2000001,55\n" +
+		fmt.Sprintf("9000,,%d,1\n", unknownTemplateId) +
+		fmt.Sprintf("9002,%s,2000003,20\n", tm.Id())
+	sp := catalog.NewProcessor(logrus.New(), sourceCtx, db)
+	sp.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+		return nil
+	}
+	if _, err = sp.Import(catalog.FormatCsv, []byte(body)); err != nil {
+		t.Fatalf("Failed to import source catalog: %v", err)
+	}
+
+	// The target tenant already sells one of the items at its own price
+	targetCtx := test.CreateTestContext()
+	tp := newProcessor(targetCtx)
+	body = "npcId,templateId,mesoPrice\n" +
+		"9000,2000000,999\n" +
+		"9000,2000009,5\n"
+	if _, err = tp.Import(catalog.FormatCsv, []byte(body)); err != nil {
+		t.Fatalf("Failed to import target catalog: %v", err)
+	}
+
+	if _, err = tp.Clone(tenant.MustFromContext(targetCtx), catalog.CloneModeOverwrite, true); !errors.Is(err, catalog.ErrSameTenant) {
+		t.Errorf("Expected ErrSameTenant, got %v", err)
+	}
+	if _, err = tp.Clone(source, catalog.CloneModeOverwrite, false); !errors.Is(err, catalog.ErrInvalidCatalog) {
+		t.Errorf("Expected unknown templates to reject the clone, got %v", err)
+	}
+
+	commoditiesOf := func(npcId uint32) map[uint32]uint32 {
+		cms, err := commodities.NewProcessor(logrus.New(), targetCtx, db).GetByNpcId(npcId)
+		if err != nil {
+			t.Fatalf("Failed to get commodities: %v", err)
+		}
+		prices := make(map[uint32]uint32)
+		for _, c := range cms {
+			prices[c.TemplateId()] = c.MesoPrice()
+		}
+		return prices
+	}
+
+	// Merging keeps the target's commodities and adds the missing ones
+	result, err := tp.Clone(source, catalog.CloneModeMerge, true)
+	if err != nil {
+		t.Fatalf("Failed to merge clone: %v", err)
+	}
+	if len(result.Skipped()) != 1 || result.Skipped()[0].TemplateId() != unknownTemplateId {
+		t.Errorf("Expected the unknown template to be skipped, got %+v", result.Skipped())
+	}
+	merged := commoditiesOf(9000)
+	if len(merged) != 3 || merged[2000000] != 999 || merged[2000001] != 55 || merged[2000009] != 5 {
+		t.Errorf("Unexpected merged commodities %v", merged)
+	}
+	flattened := commoditiesOf(9002)
+	if len(flattened) != 2 || flattened[2000002] != 10 || flattened[2000003] != 20 {
+		t.Errorf("Expected inherited commodities to be copied as the shop's own, got %v", flattened)
+	}
+
+	// Overwriting replaces the target's shop with the source's
+	if _, err = tp.Clone(source, catalog.CloneModeOverwrite, true); err != nil {
+		t.Fatalf("Failed to overwrite clone: %v", err)
+	}
+	overwritten := commoditiesOf(9000)
+	if len(overwritten) != 2 || overwritten[2000000] != 50 || overwritten[2000001] != 55 {
+		t.Errorf("Unexpected overwritten commodities %v", overwritten)
+	}
+}
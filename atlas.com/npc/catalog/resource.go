@@ -0,0 +1,188 @@
+package catalog
+
+import (
+	"atlas-npc/rest"
+	"atlas-npc/shops"
+	"errors"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/server"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// maxCatalogSize bounds the size of an imported catalog.
+const maxCatalogSize = 32 << 20
+
+func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
+	return func(db *gorm.DB) server.RouteInitializer {
+		return func(router *mux.Router, l logrus.FieldLogger) {
+			router.HandleFunc("/shops/export", rest.RegisterHandler(l)(db)(si)("export_shops", handleExportShops)).Methods(http.MethodGet)
+			router.HandleFunc("/shops/clone", rest.RegisterInputHandler[CloneRestModel](l)(db)(si)("clone_shops", handleCloneShops)).Methods(http.MethodPost)
+			router.HandleFunc("/shops/import", rest.RegisterHandler(l)(db)(si)("import_shops", handleImportShops)).Methods(http.MethodPost)
+		}
+	}
+}
+
+// formatFromRequest selects the catalog format from the `format` query parameter, falling back to the Content-Type.
+func formatFromRequest(r *http.Request) Format {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return Format(f)
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == "text/csv" {
+		return FormatCsv
+	}
+	return FormatJsonApi
+}
+
+func handleImportShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCatalogSize))
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Reading shop catalog.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		format := formatFromRequest(r)
+		result, err := NewProcessor(d.Logger(), d.Context(), d.DB()).Import(format, body)
+		status := http.StatusOK
+		if err != nil {
+			if errors.Is(err, ErrUnknownFormat) || errors.Is(err, ErrMalformedCatalog) {
+				d.Logger().WithError(err).Errorf("Parsing [%s] shop catalog.", format)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if !errors.Is(err, ErrInvalidCatalog) {
+				d.Logger().WithError(err).Errorf("Importing [%s] shop catalog.", format)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			status = http.StatusUnprocessableEntity
+		}
+
+		res, err := TransformImport(uuid.New().String())(result)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST model.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(status)
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[ImportRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleExportShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := FormatJsonApi
+		if f := r.URL.Query().Get("format"); f != "" {
+			format = Format(f)
+		}
+		if format != FormatJsonApi && format != FormatCsv {
+			d.Logger().Errorf("Unable to export shops as [%s].", format)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ms, err := NewProcessor(d.Logger(), d.Context(), d.DB()).Export()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Exporting shops.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if format == FormatCsv {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="shops.csv"`)
+			w.WriteHeader(http.StatusOK)
+			err = WriteCsv(w, ms)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Writing shop export.")
+			}
+			return
+		}
+
+		res, err := model.SliceMap(shops.Transform)(model.FixedProvider(ms))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]shops.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+// sourceTenant builds the tenant to clone from, taking the region and version of the target unless given.
+func sourceTenant(target tenant.Model, i CloneRestModel) (tenant.Model, error) {
+	id, err := uuid.Parse(i.SourceTenantId)
+	if err != nil {
+		return tenant.Model{}, err
+	}
+	region := i.SourceRegion
+	majorVersion := i.SourceMajorVersion
+	minorVersion := i.SourceMinorVersion
+	if region == "" {
+		region = target.Region()
+	}
+	if majorVersion == 0 {
+		majorVersion = target.MajorVersion()
+		minorVersion = target.MinorVersion()
+	}
+	return tenant.Create(id, region, majorVersion, minorVersion)
+}
+
+func handleCloneShops(d *rest.HandlerDependency, c *rest.HandlerContext, i CloneRestModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source, err := sourceTenant(tenant.MustFromContext(d.Context()), i)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Invalid source tenant [%s].", i.SourceTenantId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mode := CloneMode(i.Mode)
+		if mode == "" {
+			mode = CloneModeOverwrite
+		}
+
+		result, err := NewProcessor(d.Logger(), d.Context(), d.DB()).Clone(source, mode, i.SkipUnknownTemplates)
+		status := http.StatusOK
+		if err != nil {
+			if errors.Is(err, ErrUnknownCloneMode) || errors.Is(err, ErrSameTenant) {
+				d.Logger().WithError(err).Errorf("Cloning shops of tenant [%s].", source.Id())
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if !errors.Is(err, ErrInvalidCatalog) {
+				d.Logger().WithError(err).Errorf("Cloning shops of tenant [%s].", source.Id())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			status = http.StatusUnprocessableEntity
+		}
+
+		res, err := TransformImport(uuid.New().String())(result)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST model.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(status)
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[ImportRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
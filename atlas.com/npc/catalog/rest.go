@@ -0,0 +1,89 @@
+package catalog
+
+// ImportRestModel is a JSON API representation of an ImportResult
+type ImportRestModel struct {
+	Id          string              `json:"-"`
+	Shops       int                 `json:"shops"`
+	Commodities int                 `json:"commodities"`
+	Errors      []RowErrorRestModel `json:"errors"`
+	Skipped     []RowErrorRestModel `json:"skipped"`
+}
+
+// RowErrorRestModel is a JSON representation of a RowError
+type RowErrorRestModel struct {
+	Source     string `json:"source"`
+	Row        int    `json:"row"`
+	NpcId      uint32 `json:"npcId,omitempty"`
+	TemplateId uint32 `json:"templateId,omitempty"`
+	Message    string `json:"message"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r ImportRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *ImportRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r ImportRestModel) GetName() string {
+	return "shop-imports"
+}
+
+// TransformImport converts an ImportResult to an ImportRestModel
+func TransformImport(id string) func(m ImportResult) (ImportRestModel, error) {
+	return func(m ImportResult) (ImportRestModel, error) {
+		return ImportRestModel{
+			Id:          id,
+			Shops:       m.shops,
+			Commodities: m.commodities,
+			Errors:      transformRowErrors(m.errors),
+			Skipped:     transformRowErrors(m.skipped),
+		}, nil
+	}
+}
+
+func transformRowErrors(es []RowError) []RowErrorRestModel {
+	results := make([]RowErrorRestModel, 0, len(es))
+	for _, e := range es {
+		results = append(results, RowErrorRestModel{
+			Source:     e.source,
+			Row:        e.row,
+			NpcId:      e.npcId,
+			TemplateId: e.templateId,
+			Message:    e.message,
+		})
+	}
+	return results
+}
+
+// CloneRestModel is a JSON API request to clone the shops of another tenant
+type CloneRestModel struct {
+	Id                   string `json:"-"`
+	SourceTenantId       string `json:"sourceTenantId"`
+	SourceRegion         string `json:"sourceRegion"`       // Defaults to the region of the target tenant
+	SourceMajorVersion   uint16 `json:"sourceMajorVersion"` // Defaults to the version of the target tenant
+	SourceMinorVersion   uint16 `json:"sourceMinorVersion"`
+	Mode                 string `json:"mode"` // overwrite (default) or merge
+	SkipUnknownTemplates bool   `json:"skipUnknownTemplates"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r CloneRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *CloneRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r CloneRestModel) GetName() string {
+	return "shop-clones"
+}
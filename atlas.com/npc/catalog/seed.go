@@ -0,0 +1,236 @@
+package catalog
+
+import (
+	"atlas-npc/database"
+	"atlas-npc/shops"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Chronicle20/atlas-rest/server"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvSeedDirectory names the directory holding seed catalogs, laid out as <region>/<major>.<minor>/<catalog>.
+const EnvSeedDirectory = "SHOP_SEED_DIRECTORY"
+
+const (
+	// seedRetryDelay is how long seeding a tenant waits after its first failure before being tried again.
+	seedRetryDelay = 5 * time.Second
+	// seedMaxRetryDelay bounds the wait after repeated failures.
+	seedMaxRetryDelay = 5 * time.Minute
+)
+
+// Seeder loads the seed catalogs for a tenant's region and version into the tenant, the first time the tenant is seen
+// and only while it has no shops.
+type Seeder struct {
+	mutex        sync.Mutex
+	directory    string
+	initialized  map[uuid.UUID]bool
+	locks        map[uuid.UUID]*sync.Mutex
+	failures     map[uuid.UUID]seedFailure
+	NewProcessor func(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor
+}
+
+// seedFailure is how often seeding a tenant has failed in a row, and when it may next be tried.
+type seedFailure struct {
+	attempts int
+	retryAt  time.Time
+}
+
+var seeder *Seeder
+var seederOnce sync.Once
+
+func GetSeeder() *Seeder {
+	seederOnce.Do(func() {
+		seeder = NewSeeder(os.Getenv(EnvSeedDirectory))
+	})
+	return seeder
+}
+
+func NewSeeder(directory string) *Seeder {
+	return &Seeder{
+		directory:    directory,
+		initialized:  make(map[uuid.UUID]bool),
+		locks:        make(map[uuid.UUID]*sync.Mutex),
+		failures:     make(map[uuid.UUID]seedFailure),
+		NewProcessor: NewProcessor,
+	}
+}
+
+// Initialize seeds the tenant of the context, logging rather than returning failures so it can run ahead of requests.
+func (s *Seeder) Initialize(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) {
+	err := s.Seed(l, ctx, db)
+	if err != nil {
+		l.WithError(err).Errorf("Unable to seed shops for tenant [%s].", tenant.MustFromContext(ctx).Id())
+	}
+}
+
+// SeedRequests returns a route initializer which seeds the tenant of every request carrying tenant headers before the
+// request is handled. Requests without them, such as those for the OpenAPI specification, are passed through.
+func (s *Seeder) SeedRequests(db *gorm.DB) server.RouteInitializer {
+	return func(router *mux.Router, l logrus.FieldLogger) {
+		router.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("TENANT_ID") == "" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				server.ParseTenant(l, r.Context(), func(tl logrus.FieldLogger, tctx context.Context) http.HandlerFunc {
+					s.Initialize(tl, tctx, db)
+					return next.ServeHTTP
+				})(w, r)
+			})
+		})
+	}
+}
+
+// Seed imports every catalog in the tenant's seed directory in a single transaction. Tenants which already have shops
+// are left untouched. A tenant is only considered once per process. Tenants are seeded independently, so a slow seed
+// does not hold up others, and a tenant whose seeding failed is not tried again until its backoff has passed.
+func (s *Seeder) Seed(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) error {
+	if s.directory == "" {
+		return nil
+	}
+	t := tenant.MustFromContext(ctx)
+
+	lock, ok := s.tenantLock(t.Id())
+	if !ok {
+		return nil
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another caller may have seeded the tenant, or failed to, while this one waited
+	if _, ok = s.tenantLock(t.Id()); !ok {
+		return nil
+	}
+
+	err := s.seed(l, ctx, db, t)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		f := s.failures[t.Id()]
+		f.attempts++
+		delay := min(seedRetryDelay<<(f.attempts-1), seedMaxRetryDelay)
+		f.retryAt = time.Now().Add(delay)
+		s.failures[t.Id()] = f
+		l.Warnf("Seeding tenant [%s] failed [%d] times. Retrying in [%s].", t.Id(), f.attempts, delay)
+		return err
+	}
+	delete(s.failures, t.Id())
+	s.initialized[t.Id()] = true
+	return nil
+}
+
+// tenantLock returns the lock serializing seeding of the tenant, or false when the tenant needs no seeding, as it is
+// initialized or backing off after a failure.
+func (s *Seeder) tenantLock(tenantId uuid.UUID) (*sync.Mutex, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.initialized[tenantId] {
+		return nil, false
+	}
+	if f, ok := s.failures[tenantId]; ok && time.Now().Before(f.retryAt) {
+		return nil, false
+	}
+	lock, ok := s.locks[tenantId]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[tenantId] = lock
+	}
+	return lock, true
+}
+
+func (s *Seeder) seed(l logrus.FieldLogger, ctx context.Context, db *gorm.DB, t tenant.Model) error {
+	empty, err := shops.NewProcessor(l, ctx, db).IsEmpty()
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return nil
+	}
+
+	dir := filepath.Join(s.directory, t.Region(), fmt.Sprintf("%d.%d", t.MajorVersion(), t.MinorVersion()))
+	files, err := seedFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		l.Debugf("No seed catalogs in [%s] for tenant [%s].", dir, t.Id())
+		return nil
+	}
+
+	var total ImportResult
+	txErr := database.ExecuteTransaction(db, func(tx *gorm.DB) error {
+		p := s.NewProcessor(l, ctx, tx)
+		for _, file := range files {
+			body, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			result, err := p.Import(seedFormat(file, body), body)
+			if err != nil {
+				for _, re := range result.Errors() {
+					l.Errorf("Seed catalog [%s] %s row [%d]: %s", file, re.Source(), re.Row(), re.Message())
+				}
+				return fmt.Errorf("seed catalog [%s]: %w", file, err)
+			}
+			total.shops += result.Shops()
+			total.commodities += result.Commodities()
+		}
+		return nil
+	})
+	if txErr != nil {
+		return txErr
+	}
+	l.Infof("Seeded [%d] shops with [%d] commodities from [%s] for tenant [%s].", total.shops, total.commodities, dir, t.Id())
+	return nil
+}
+
+// seedFiles lists the .json and .csv catalogs of a directory in name order. A missing directory has no catalogs.
+func seedFiles(dir string) ([]string, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, de := range des {
+		ext := strings.ToLower(filepath.Ext(de.Name()))
+		if de.IsDir() || (ext != ".json" && ext != ".csv") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, de.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// seedFormat picks the format of a seed catalog: CSV by extension, and for JSON, the emulator layout when the document
+// has a top level `shops` member.
+func seedFormat(file string, body []byte) Format {
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		return FormatCsv
+	}
+	var members map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&members); err == nil {
+		if _, ok := members["shops"]; ok {
+			return FormatEmulator
+		}
+	}
+	return FormatJsonApi
+}
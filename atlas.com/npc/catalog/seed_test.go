@@ -0,0 +1,209 @@
+package catalog_test
+
+import (
+	"atlas-npc/catalog"
+	"atlas-npc/commodities"
+	"atlas-npc/shops"
+	"atlas-npc/test"
+	"context"
+	"fmt"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSeed(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	ctx := test.CreateTestContext()
+	ten := tenant.MustFromContext(ctx)
+	dir := t.TempDir()
+	versionDir := filepath.Join(dir, ten.Region(), fmt.Sprintf("%d.%d", ten.MajorVersion(), ten.MinorVersion()))
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatalf("Failed to create seed directory: %v", err)
+	}
+	files := map[string]string{
+		"01-general.csv": "npcId,templateId,mesoPrice\n9000,2000000,50\n9000,2000001,55\n",
+		"02-emulator.json": `{"shops": [{"shopid": 1, "npcid": 9001}],
+			"shopitems": [{"shopitemid": 1, "shopid": 1, "itemid": 2070000, "price": 500, "pitch": 0, "position": 1}]}`,
+		"README.md": "ignored",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(versionDir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("Failed to write seed catalog: %v", err)
+		}
+	}
+
+	seeder := catalog.NewSeeder(dir)
+	seeder.NewProcessor = func(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) catalog.Processor {
+		p := catalog.NewProcessor(l, ctx, db)
+		p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+			return nil
+		}
+		return p
+	}
+	if err := seeder.Seed(logrus.New(), ctx, db); err != nil {
+		t.Fatalf("Failed to seed tenant: %v", err)
+	}
+
+	sp := shops.NewProcessor(logrus.New(), ctx, db)
+	seeded, err := sp.GetCatalog()
+	if err != nil {
+		t.Fatalf("Failed to get catalog: %v", err)
+	}
+	if len(seeded) != 2 || len(seeded[0].Commodities()) != 2 || len(seeded[1].Commodities()) != 1 {
+		t.Fatalf("Expected both seed catalogs to be loaded, got %d shops", len(seeded))
+	}
+
+	// A tenant which already has shops is not seeded again
+	if _, err = sp.UpdateShop(shops.NewBuilder(9000).Build()); err != nil {
+		t.Fatalf("Failed to update shop: %v", err)
+	}
+	if err = catalog.NewSeeder(dir).Seed(logrus.New(), ctx, db); err != nil {
+		t.Fatalf("Failed to seed tenant: %v", err)
+	}
+	if exists, _ := commodities.NewProcessor(logrus.New(), ctx, db).ExistsByNpcId(9000); exists {
+		t.Errorf("Expected shops of a non-empty tenant to be left untouched")
+	}
+
+	// A tenant without a seed directory is left empty
+	other := test.CreateTestContext()
+	if err = catalog.NewSeeder(filepath.Join(dir, "missing")).Seed(logrus.New(), other, db); err != nil {
+		t.Fatalf("Failed to seed tenant: %v", err)
+	}
+	if empty, _ := shops.NewProcessor(logrus.New(), other, db).IsEmpty(); !empty {
+		t.Errorf("Expected tenant without seed catalogs to remain empty")
+	}
+}
+
+func TestSeedOnce(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	ctx := test.CreateTestContext()
+	ten := tenant.MustFromContext(ctx)
+	dir := t.TempDir()
+	versionDir := filepath.Join(dir, ten.Region(), fmt.Sprintf("%d.%d", ten.MajorVersion(), ten.MinorVersion()))
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatalf("Failed to create seed directory: %v", err)
+	}
+	catalogFile := filepath.Join(versionDir, "01-general.csv")
+	if err := os.WriteFile(catalogFile, []byte("npcId,templateId,mesoPrice\n9100,2000000,50\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write seed catalog: %v", err)
+	}
+
+	var mutex sync.Mutex
+	imports := 0
+	fail := true
+	seeder := catalog.NewSeeder(dir)
+	seeder.NewProcessor = func(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) catalog.Processor {
+		mutex.Lock()
+		defer mutex.Unlock()
+		imports++
+		p := catalog.NewProcessor(l, ctx, db)
+		p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+			if fail {
+				return commodities.ErrUnknownTemplate
+			}
+			return nil
+		}
+		return p
+	}
+
+	// A failed seed is not retried until its backoff has passed
+	if err := seeder.Seed(logrus.New(), ctx, db); err == nil {
+		t.Fatalf("Expected seeding with an unknown item to fail")
+	}
+	fail = false
+	if err := seeder.Seed(logrus.New(), ctx, db); err != nil {
+		t.Fatalf("Expected seeding during the backoff to be skipped, got %v", err)
+	}
+	if imports != 1 {
+		t.Errorf("Expected seeding to not be retried during the backoff, got %d imports", imports)
+	}
+
+	// Concurrent callers for a tenant seed it once
+	imports = 0
+	seeder = catalog.NewSeeder(dir)
+	seeder.NewProcessor = func(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) catalog.Processor {
+		mutex.Lock()
+		defer mutex.Unlock()
+		imports++
+		p := catalog.NewProcessor(l, ctx, db)
+		p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+			return nil
+		}
+		return p
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := seeder.Seed(logrus.New(), ctx, db); err != nil {
+				t.Errorf("Failed to seed tenant: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if imports != 1 {
+		t.Errorf("Expected the tenant to be seeded once, got %d imports", imports)
+	}
+}
+
+func TestSeedRequests(t *testing.T) {
+	_, db, cleanup := test.CreateShopsProcessor(t)
+	defer cleanup()
+
+	ctx := test.CreateTestContext()
+	ten := tenant.MustFromContext(ctx)
+	dir := t.TempDir()
+	versionDir := filepath.Join(dir, ten.Region(), fmt.Sprintf("%d.%d", ten.MajorVersion(), ten.MinorVersion()))
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatalf("Failed to create seed directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "01-general.csv"), []byte("npcId,templateId,mesoPrice\n9200,2000000,50\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write seed catalog: %v", err)
+	}
+
+	seeder := catalog.NewSeeder(dir)
+	seeder.NewProcessor = func(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) catalog.Processor {
+		p := catalog.NewProcessor(l, ctx, db)
+		p.(*catalog.ProcessorImpl).ValidateTemplateIdFn = func(templateId uint32) error {
+			return nil
+		}
+		return p
+	}
+	router := mux.NewRouter()
+	seeder.SeedRequests(db)(router, logrus.New())
+	handled := 0
+	router.HandleFunc("/shops", func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	})
+
+	// A request without tenant headers is handled without seeding
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/shops", nil))
+	if empty, _ := shops.NewProcessor(logrus.New(), ctx, db).IsEmpty(); !empty || handled != 1 {
+		t.Errorf("Expected a request without tenant headers to be handled without seeding")
+	}
+
+	// The tenant of a request is seeded before the request is handled
+	r := httptest.NewRequest(http.MethodGet, "/shops", nil)
+	r.Header.Set("TENANT_ID", ten.Id().String())
+	r.Header.Set("REGION", ten.Region())
+	r.Header.Set("MAJOR_VERSION", strconv.Itoa(int(ten.MajorVersion())))
+	r.Header.Set("MINOR_VERSION", strconv.Itoa(int(ten.MinorVersion())))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if empty, _ := shops.NewProcessor(logrus.New(), ctx, db).IsEmpty(); empty || handled != 2 {
+		t.Errorf("Expected the tenant of a request to be seeded before it is handled")
+	}
+}
@@ -0,0 +1,44 @@
+package quest
+
+import (
+	"context"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/requests"
+	"github.com/sirupsen/logrus"
+)
+
+type Processor interface {
+	GetByCharacterId(characterId uint32) ([]Model, error)
+	ByCharacterIdProvider(characterId uint32) model.Provider[[]Model]
+}
+
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context) Processor {
+	p := &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+	}
+	return p
+}
+
+func (p *ProcessorImpl) ByCharacterIdProvider(characterId uint32) model.Provider[[]Model] {
+	return requests.SliceProvider[RestModel, Model](p.l, p.ctx)(requestByCharacterId(characterId), Extract, model.Filters[Model]())
+}
+
+func (p *ProcessorImpl) GetByCharacterId(characterId uint32) ([]Model, error) {
+	return p.ByCharacterIdProvider(characterId)()
+}
+
+// GetState returns the state of the quest, treating quests the character has no record of as not started.
+func GetState(quests []Model, questId uint32) State {
+	for _, q := range quests {
+		if q.QuestId() == questId {
+			return q.State()
+		}
+	}
+	return StateNotStarted
+}
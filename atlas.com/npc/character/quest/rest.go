@@ -0,0 +1,34 @@
+package quest
+
+import (
+	"strconv"
+)
+
+type RestModel struct {
+	Id    uint32 `json:"-"`
+	State byte   `json:"state"`
+}
+
+func (r RestModel) GetName() string {
+	return "quests"
+}
+
+func (r RestModel) GetID() string {
+	return strconv.Itoa(int(r.Id))
+}
+
+func (r *RestModel) SetID(strId string) error {
+	id, err := strconv.Atoi(strId)
+	if err != nil {
+		return err
+	}
+	r.Id = uint32(id)
+	return nil
+}
+
+func Extract(rm RestModel) (Model, error) {
+	return Model{
+		questId: rm.Id,
+		state:   State(rm.State),
+	}, nil
+}
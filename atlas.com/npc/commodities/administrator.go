@@ -2,26 +2,34 @@ package commodities
 
 import (
 	"context"
+	"errors"
 	tenant "github.com/Chronicle20/atlas-tenant"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
-func createCommodity(ctx context.Context, db *gorm.DB) func(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
-	return func(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
+var ErrNotFound = errors.New("not found")
+
+func createCommodity(ctx context.Context, db *gorm.DB) func(npcId uint32, m Model) (Model, error) {
+	return func(npcId uint32, m Model) (Model, error) {
 		t := tenant.MustFromContext(ctx)
 		id := uuid.New()
 		entity := Entity{
 			Id:              id,
 			TenantId:        t.Id(),
 			NpcId:           npcId,
-			TemplateId:      templateId,
-			MesoPrice:       mesoPrice,
-			DiscountRate:    discountRate,
-			TokenTemplateId: tokenTemplateId,
-			TokenPrice:      tokenPrice,
-			Period:          period,
-			LevelLimit:      levelLimited,
+			TemplateId:      m.TemplateId(),
+			MesoPrice:       m.MesoPrice(),
+			DiscountRate:    m.DiscountRate(),
+			TokenTemplateId: m.TokenTemplateId(),
+			TokenPrice:      m.TokenPrice(),
+			Period:          m.Period(),
+			LevelLimit:      m.LevelLimit(),
+			JobMask:         m.JobMask(),
+			Gender:          m.Gender(),
+			QuestId:         m.QuestId(),
+			QuestState:      m.QuestState(),
 		}
 
 		if err := db.Create(&entity).Error; err != nil {
@@ -32,21 +40,25 @@ func createCommodity(ctx context.Context, db *gorm.DB) func(npcId uint32, templa
 	}
 }
 
-func updateCommodity(ctx context.Context, db *gorm.DB) func(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
-	return func(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
+func updateCommodity(ctx context.Context, db *gorm.DB) func(id uuid.UUID, m Model) (Model, error) {
+	return func(id uuid.UUID, m Model) (Model, error) {
 		t := tenant.MustFromContext(ctx)
 		var entity Entity
 		if err := db.Where(&Entity{Id: id, TenantId: t.Id()}).First(&entity).Error; err != nil {
 			return Model{}, err
 		}
 
-		entity.TemplateId = templateId
-		entity.MesoPrice = mesoPrice
-		entity.DiscountRate = discountRate
-		entity.TokenTemplateId = tokenTemplateId
-		entity.TokenPrice = tokenPrice
-		entity.Period = period
-		entity.LevelLimit = levelLimited
+		entity.TemplateId = m.TemplateId()
+		entity.MesoPrice = m.MesoPrice()
+		entity.DiscountRate = m.DiscountRate()
+		entity.TokenTemplateId = m.TokenTemplateId()
+		entity.TokenPrice = m.TokenPrice()
+		entity.Period = m.Period()
+		entity.LevelLimit = m.LevelLimit()
+		entity.JobMask = m.JobMask()
+		entity.Gender = m.Gender()
+		entity.QuestId = m.QuestId()
+		entity.QuestState = m.QuestState()
 
 		if err := db.Save(&entity).Error; err != nil {
 			return Model{}, err
@@ -76,3 +88,86 @@ func deleteAllCommodities(ctx context.Context, db *gorm.DB) func() error {
 		return db.Where(&Entity{TenantId: t.Id()}).Delete(&Entity{}).Error
 	}
 }
+
+func restoreCommodity(ctx context.Context, db *gorm.DB) func(id uuid.UUID) (Model, error) {
+	return func(id uuid.UUID) (Model, error) {
+		t := tenant.MustFromContext(ctx)
+		result := db.Unscoped().Model(&Entity{}).
+			Where("tenant_id = ? AND id = ? AND deleted_at IS NOT NULL", t.Id(), id).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			return Model{}, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return Model{}, ErrNotFound
+		}
+
+		var entity Entity
+		if err := db.Where(&Entity{Id: id, TenantId: t.Id()}).First(&entity).Error; err != nil {
+			return Model{}, err
+		}
+		return Make(entity)
+	}
+}
+
+// restoreCommoditiesDeletedAt restores the commodities of an NPC deleted at the given instant, returning those restored.
+func restoreCommoditiesDeletedAt(ctx context.Context, db *gorm.DB) func(npcId uint32, deletedAt time.Time) ([]Model, error) {
+	return func(npcId uint32, deletedAt time.Time) ([]Model, error) {
+		t := tenant.MustFromContext(ctx)
+		var entities []Entity
+		err := db.Unscoped().
+			Where("tenant_id = ? AND npc_id = ? AND deleted_at = ?", t.Id(), npcId, deletedAt).
+			Find(&entities).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(entities) == 0 {
+			return []Model{}, nil
+		}
+
+		ids := make([]uuid.UUID, 0, len(entities))
+		for _, e := range entities {
+			ids = append(ids, e.Id)
+		}
+		err = db.Unscoped().Model(&Entity{}).
+			Where("tenant_id = ? AND id IN ?", t.Id(), ids).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return nil, err
+		}
+		result := make([]Model, 0, len(entities))
+		for _, e := range entities {
+			m, err := Make(e)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, m)
+		}
+		return result, nil
+	}
+}
+
+// restoreCommoditiesAsOf returns the tenant's commodities to how they were at the given time, by deleting those created
+// since and restoring those deleted since.
+func restoreCommoditiesAsOf(ctx context.Context, db *gorm.DB) func(asOf time.Time) error {
+	return func(asOf time.Time) error {
+		t := tenant.MustFromContext(ctx)
+		err := db.Where("tenant_id = ? AND created_at > ?", t.Id(), asOf).Delete(&Entity{}).Error
+		if err != nil {
+			return err
+		}
+		return db.Unscoped().Model(&Entity{}).
+			Where("tenant_id = ? AND deleted_at > ? AND created_at <= ?", t.Id(), asOf, asOf).
+			Update("deleted_at", nil).Error
+	}
+}
+
+func purgeDeletedCommodities(ctx context.Context, db *gorm.DB) func(before time.Time) (int64, error) {
+	return func(before time.Time) (int64, error) {
+		t := tenant.MustFromContext(ctx)
+		result := db.Unscoped().
+			Where("tenant_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", t.Id(), before).
+			Delete(&Entity{})
+		return result.RowsAffected, result.Error
+	}
+}
@@ -8,16 +8,20 @@ import (
 // Entity is the GORM entity for the commodities Model
 type Entity struct {
 	gorm.Model
-	Id           uuid.UUID `gorm:"type:uuid;primaryKey"`
-	TenantId     uuid.UUID `gorm:"type:uuid;not null"`
-	NpcId        uint32    `gorm:"not null"`
-	TemplateId   uint32    `gorm:"not null"`
-	MesoPrice    uint32    `gorm:"not null"`
-	DiscountRate byte      `gorm:"not null;default:0"`
-	TokenTemplateId  uint32    `gorm:"not null;default:0"`
-	TokenPrice   uint32    `gorm:"not null;default:0"`
-	Period       uint32    `gorm:"not null;default:0"`
-	LevelLimit   uint32    `gorm:"not null;default:0"`
+	Id              uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId        uuid.UUID `gorm:"type:uuid;not null;index:idx_commodities_tenant_template,priority:1"`
+	NpcId           uint32    `gorm:"not null"`
+	TemplateId      uint32    `gorm:"not null;index:idx_commodities_tenant_template,priority:2"`
+	MesoPrice       uint32    `gorm:"not null"`
+	DiscountRate    byte      `gorm:"not null;default:0"`
+	TokenTemplateId uint32    `gorm:"not null;default:0"`
+	TokenPrice      uint32    `gorm:"not null;default:0"`
+	Period          uint32    `gorm:"not null;default:0"`
+	LevelLimit      uint32    `gorm:"not null;default:0"`
+	JobMask         uint16    `gorm:"not null;default:0"`
+	Gender          byte      `gorm:"not null;default:0"`
+	QuestId         uint32    `gorm:"not null;default:0"`
+	QuestState      byte      `gorm:"not null;default:0"`
 }
 
 func (e *Entity) TableName() string {
@@ -27,15 +31,31 @@ func (e *Entity) TableName() string {
 // Make converts an Entity to a Model
 func Make(entity Entity) (Model, error) {
 	return Model{
-		id:           entity.Id,
-		npcId:        entity.NpcId,
-		templateId:   entity.TemplateId,
-		mesoPrice:    entity.MesoPrice,
-		discountRate: entity.DiscountRate,
-		tokenTemplateId:  entity.TokenTemplateId,
-		tokenPrice:   entity.TokenPrice,
-		period:       entity.Period,
-		levelLimit:   entity.LevelLimit,
+		id:              entity.Id,
+		npcId:           entity.NpcId,
+		templateId:      entity.TemplateId,
+		mesoPrice:       entity.MesoPrice,
+		discountRate:    entity.DiscountRate,
+		tokenTemplateId: entity.TokenTemplateId,
+		tokenPrice:      entity.TokenPrice,
+		period:          entity.Period,
+		levelLimit:      entity.LevelLimit,
+		jobMask:         entity.JobMask,
+		gender:          entity.Gender,
+		questId:         entity.QuestId,
+		questState:      entity.QuestState,
+	}, nil
+}
+
+// MakeDeleted converts a soft-deleted Entity to a DeletedModel
+func MakeDeleted(entity Entity) (DeletedModel, error) {
+	m, err := Make(entity)
+	if err != nil {
+		return DeletedModel{}, err
+	}
+	return DeletedModel{
+		commodity: m,
+		deletedAt: entity.DeletedAt.Time,
 	}, nil
 }
 
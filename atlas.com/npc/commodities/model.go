@@ -2,20 +2,45 @@ package commodities
 
 import (
 	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// JobFamilyBeginner through JobFamilyPirate are the bits of a commodity job mask. A mask of 0 allows every job.
+	JobFamilyBeginner uint16 = 1 << iota
+	JobFamilyWarrior
+	JobFamilyMagician
+	JobFamilyBowman
+	JobFamilyThief
+	JobFamilyPirate
+)
+
+const (
+	// GenderAny allows a commodity to be bought by characters of either gender.
+	GenderAny byte = 0
+	// GenderMale restricts a commodity to male characters (character gender 0).
+	GenderMale byte = 1
+	// GenderFemale restricts a commodity to female characters (character gender 1).
+	GenderFemale byte = 2
 )
 
 type Model struct {
-	id             uuid.UUID
-	npcId          uint32
-	templateId     uint32
-	mesoPrice      uint32
-	discountRate   byte
+	id              uuid.UUID
+	npcId           uint32
+	templateId      uint32
+	mesoPrice       uint32
+	discountRate    byte
 	tokenTemplateId uint32
-	tokenPrice     uint32
-	period         uint32
-	levelLimit     uint32
-	unitPrice      float64
-	slotMax        uint32
+	tokenPrice      uint32
+	period          uint32
+	levelLimit      uint32
+	unitPrice       float64
+	slotMax         uint32
+	inherited       bool
+	jobMask         uint16
+	gender          byte
+	questId         uint32
+	questState      byte
 }
 
 // Id returns the model's id
@@ -73,19 +98,107 @@ func (m *Model) SlotMax() uint32 {
 	return m.slotMax
 }
 
+// Inherited returns whether the commodity was resolved from the shop's template rather than the shop itself
+func (m *Model) Inherited() bool {
+	return m.inherited
+}
+
+// EffectiveMesoPrice returns the meso price after the commodity's discount rate (a percentage) is applied
+func (m *Model) EffectiveMesoPrice() uint32 {
+	rate := uint64(m.discountRate)
+	if rate > 100 {
+		rate = 100
+	}
+	return uint32(uint64(m.mesoPrice) * (100 - rate) / 100)
+}
+
+// MeetsLevelRequirement returns whether a character of the given level satisfies the commodity's level limit
+func (m *Model) MeetsLevelRequirement(level byte) bool {
+	return uint32(level) >= m.levelLimit
+}
+
+// JobMask returns the job families allowed to buy the commodity, 0 allowing all
+func (m *Model) JobMask() uint16 {
+	return m.jobMask
+}
+
+// Gender returns the gender allowed to buy the commodity
+func (m *Model) Gender() byte {
+	return m.gender
+}
+
+// AllowsJob returns whether a character with the given job may buy the commodity
+func (m *Model) AllowsJob(jobId uint16) bool {
+	if m.jobMask == 0 {
+		return true
+	}
+	return m.jobMask&JobFamily(jobId) != 0
+}
+
+// AllowsGender returns whether a character with the given gender may buy the commodity
+func (m *Model) AllowsGender(gender byte) bool {
+	if m.gender == GenderAny {
+		return true
+	}
+	return m.gender == gender+1
+}
+
+// QuestId returns the quest gating the commodity, 0 if it is not quest gated
+func (m *Model) QuestId() uint32 {
+	return m.questId
+}
+
+// QuestState returns the state the gating quest must be in for the commodity to be bought
+func (m *Model) QuestState() byte {
+	return m.questState
+}
+
+// RequiresQuest returns whether the commodity is gated by a quest
+func (m *Model) RequiresQuest() bool {
+	return m.questId != 0
+}
+
+// AllowsQuestState returns whether a character whose gating quest is in the given state may buy the commodity
+func (m *Model) AllowsQuestState(state byte) bool {
+	if !m.RequiresQuest() {
+		return true
+	}
+	return m.questState == state
+}
+
+// AvailableTo returns whether a character with the given job and gender may buy the commodity
+func (m *Model) AvailableTo(jobId uint16, gender byte) bool {
+	return m.AllowsJob(jobId) && m.AllowsGender(gender)
+}
+
+// JobFamily returns the job mask bit for the family a job belongs to, or 0 if it belongs to none (e.g. GM jobs).
+// Cygnus Knights and Heroes share the bit of the explorer family they branch from.
+func JobFamily(jobId uint16) uint16 {
+	branch := (jobId / 100) % 10
+	if branch > 5 {
+		return 0
+	}
+	return 1 << branch
+}
+
 // ModelBuilder is used to build Model instances
 type ModelBuilder struct {
-	id           uuid.UUID
-	npcId        uint32
-	templateId   uint32
-	mesoPrice    uint32
-	discountRate byte
-	tokenTemplateId  uint32
-	tokenPrice   uint32
-	period       uint32
-	levelLimit   uint32
-	unitPrice    float64
-	slotMax      uint32
+	id              uuid.UUID
+	npcId           uint32
+	templateId      uint32
+	mesoPrice       uint32
+	discountRate    byte
+	tokenTemplateId uint32
+	tokenPrice      uint32
+	period          uint32
+	levelLimit      uint32
+	unitPrice       float64
+	slotMax         uint32
+	inherited       bool
+	jobMask         uint16
+	gender          byte
+	questId         uint32
+	questState      byte
 }
 
 // SetId sets the id for the ModelBuilder
@@ -154,36 +267,92 @@ func (b *ModelBuilder) SetSlotMax(slotMax uint32) *ModelBuilder {
 	return b
 }
 
+// SetInherited sets whether the commodity was resolved from a shop template
+func (b *ModelBuilder) SetInherited(inherited bool) *ModelBuilder {
+	b.inherited = inherited
+	return b
+}
+
+// SetJobMask sets the job families allowed to buy the commodity
+func (b *ModelBuilder) SetJobMask(jobMask uint16) *ModelBuilder {
+	b.jobMask = jobMask
+	return b
+}
+
+// SetGender sets the gender allowed to buy the commodity
+func (b *ModelBuilder) SetGender(gender byte) *ModelBuilder {
+	b.gender = gender
+	return b
+}
+
+// SetQuestId sets the quest gating the commodity
+func (b *ModelBuilder) SetQuestId(questId uint32) *ModelBuilder {
+	b.questId = questId
+	return b
+}
+
+// SetQuestState sets the state the gating quest must be in
+func (b *ModelBuilder) SetQuestState(questState byte) *ModelBuilder {
+	b.questState = questState
+	return b
+}
+
 // Build creates a new Model instance with the builder's values
 func (b *ModelBuilder) Build() Model {
 	return Model{
-		id:           b.id,
-		npcId:        b.npcId,
-		templateId:   b.templateId,
-		mesoPrice:    b.mesoPrice,
-		discountRate: b.discountRate,
-		tokenTemplateId:  b.tokenTemplateId,
-		tokenPrice:   b.tokenPrice,
-		period:       b.period,
-		levelLimit:   b.levelLimit,
-		unitPrice:    b.unitPrice,
-		slotMax:      b.slotMax,
+		id:              b.id,
+		npcId:           b.npcId,
+		templateId:      b.templateId,
+		mesoPrice:       b.mesoPrice,
+		discountRate:    b.discountRate,
+		tokenTemplateId: b.tokenTemplateId,
+		tokenPrice:      b.tokenPrice,
+		period:          b.period,
+		levelLimit:      b.levelLimit,
+		unitPrice:       b.unitPrice,
+		slotMax:         b.slotMax,
+		inherited:       b.inherited,
+		jobMask:         b.jobMask,
+		gender:          b.gender,
+		questId:         b.questId,
+		questState:      b.questState,
 	}
 }
 
 // Clone creates a new ModelBuilder with values from the given Model
 func Clone(m Model) *ModelBuilder {
 	return &ModelBuilder{
-		id:           m.id,
-		npcId:        m.npcId,
-		templateId:   m.templateId,
-		mesoPrice:    m.mesoPrice,
-		discountRate: m.discountRate,
-		tokenTemplateId:  m.tokenTemplateId,
-		tokenPrice:   m.tokenPrice,
-		period:       m.period,
-		levelLimit:   m.levelLimit,
-		unitPrice:    m.unitPrice,
-		slotMax:      m.slotMax,
+		id:              m.id,
+		npcId:           m.npcId,
+		templateId:      m.templateId,
+		mesoPrice:       m.mesoPrice,
+		discountRate:    m.discountRate,
+		tokenTemplateId: m.tokenTemplateId,
+		tokenPrice:      m.tokenPrice,
+		period:          m.period,
+		levelLimit:      m.levelLimit,
+		unitPrice:       m.unitPrice,
+		slotMax:         m.slotMax,
+		inherited:       m.inherited,
+		jobMask:         m.jobMask,
+		gender:          m.gender,
+		questId:         m.questId,
+		questState:      m.questState,
 	}
 }
+
+// DeletedModel is a soft-deleted commodity which may be restored
+type DeletedModel struct {
+	commodity Model
+	deletedAt time.Time
+}
+
+// Commodity returns the deleted commodity
+func (m DeletedModel) Commodity() Model {
+	return m.commodity
+}
+
+// DeletedAt returns when the commodity was deleted
+func (m DeletedModel) DeletedAt() time.Time {
+	return m.deletedAt
+}
@@ -1,10 +1,15 @@
 package commodities
 
 import (
+	"atlas-npc/audit"
 	"atlas-npc/data/consumable"
+	"atlas-npc/data/equipable"
 	"atlas-npc/data/etc"
 	"atlas-npc/data/setup"
+	"atlas-npc/database"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Chronicle20/atlas-constants/inventory"
 	"github.com/Chronicle20/atlas-constants/item"
 	"github.com/Chronicle20/atlas-model/model"
@@ -12,17 +17,23 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Processor interface {
+	GetById(id uuid.UUID) (Model, error)
 	GetByNpcId(npcId uint32) ([]Model, error)
 	ByNpcIdProvider(npcId uint32) model.Provider[[]Model]
+	GetByTemplateId(templateId uint32) ([]Model, error)
+	ByTemplateIdProvider(templateId uint32) model.Provider[[]Model]
+	DataDecorator(m Model) Model
+	ValidateTemplateId(templateId uint32) error
 	GetAllByTenant() ([]Model, error)
 	ByTenantProvider() model.Provider[[]Model]
 	GetCommodityIdToNpcIdMap() (map[uuid.UUID]uint32, error)
 	CommodityIdToNpcIdMapProvider() model.Provider[map[uuid.UUID]uint32]
-	CreateCommodity(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error)
-	UpdateCommodity(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error)
+	CreateCommodity(npcId uint32, m Model) (Model, error)
+	UpdateCommodity(id uuid.UUID, m Model) (Model, error)
 	DeleteCommodity(id uuid.UUID) error
 	DeleteAllCommoditiesByNpcId(npcId uint32) error
 	DeleteAllCommodities() error
@@ -30,6 +41,12 @@ type Processor interface {
 	ExistsByNpcId(npcId uint32) (bool, error)
 	GetDistinctNpcIds() ([]uint32, error)
 	DistinctNpcIdsProvider() model.Provider[[]uint32]
+	GetDeleted() ([]DeletedModel, error)
+	DeletedProvider() model.Provider[[]DeletedModel]
+	RestoreCommodity(id uuid.UUID) (Model, error)
+	RestoreDeletedAt(npcId uint32, deletedAt time.Time) ([]Model, error)
+	RestoreAsOf(asOf time.Time) error
+	PurgeDeleted(before time.Time) (int64, error)
 }
 
 type ProcessorImpl struct {
@@ -37,10 +54,11 @@ type ProcessorImpl struct {
 	ctx              context.Context
 	db               *gorm.DB
 	t                tenant.Model
+	ap               audit.Processor
 	GetByNpcIdFn     func(npcId uint32) ([]Model, error)
 	GetAllByTenantFn func() ([]Model, error)
-	CreateFn         func(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error)
-	UpdateFn         func(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error)
+	CreateFn         func(npcId uint32, m Model) (Model, error)
+	UpdateFn         func(id uuid.UUID, m Model) (Model, error)
 	DeleteFn         func(id uuid.UUID) error
 }
 
@@ -50,6 +68,7 @@ func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Proces
 		ctx: ctx,
 		db:  db,
 		t:   tenant.MustFromContext(ctx),
+		ap:  audit.NewProcessor(l, ctx, db),
 	}
 	return p
 }
@@ -60,6 +79,7 @@ func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
 		ctx: p.ctx,
 		db:  tx,
 		t:   p.t,
+		ap:  p.ap.WithTransaction(tx),
 	}
 	newProcessor.GetByNpcIdFn = p.GetByNpcIdFn
 	newProcessor.GetAllByTenantFn = p.GetAllByTenantFn
@@ -69,6 +89,11 @@ func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
 	return newProcessor
 }
 
+// GetById returns the commodity with the given id, without data decoration
+func (p *ProcessorImpl) GetById(id uuid.UUID) (Model, error) {
+	return model.Map(Make)(getById(p.t.Id(), id)(p.db))()
+}
+
 func (p *ProcessorImpl) GetByNpcId(npcId uint32) ([]Model, error) {
 	if p.GetByNpcIdFn != nil {
 		return p.GetByNpcIdFn(npcId)
@@ -81,6 +106,15 @@ func (p *ProcessorImpl) ByNpcIdProvider(npcId uint32) model.Provider[[]Model] {
 	return model.SliceMap(model.Decorate(model.Decorators(p.DataDecorator)))(mp)(model.ParallelMap())
 }
 
+// GetByTemplateId returns the commodities of every shop selling the item, without data decoration
+func (p *ProcessorImpl) GetByTemplateId(templateId uint32) ([]Model, error) {
+	return p.ByTemplateIdProvider(templateId)()
+}
+
+func (p *ProcessorImpl) ByTemplateIdProvider(templateId uint32) model.Provider[[]Model] {
+	return model.SliceMap(Make)(getByTemplateId(p.t.Id(), templateId)(p.db))(model.ParallelMap())
+}
+
 func (p *ProcessorImpl) DataDecorator(m Model) Model {
 	b := Clone(m)
 
@@ -116,25 +150,70 @@ func (p *ProcessorImpl) DataDecorator(m Model) Model {
 	return b.Build()
 }
 
-func (p *ProcessorImpl) CreateCommodity(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
-	if p.CreateFn != nil {
-		return p.CreateFn(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+var ErrUnknownTemplate = errors.New("unknown item template")
+
+// ValidateTemplateId verifies the item template exists in the data service. Cash items have no data processor and are
+// accepted as is.
+func (p *ProcessorImpl) ValidateTemplateId(templateId uint32) error {
+	it, ok := inventory.TypeFromItemId(item.Id(templateId))
+	if !ok {
+		return fmt.Errorf("%w [%d]", ErrUnknownTemplate, templateId)
+	}
+
+	var err error
+	if it == inventory.TypeValueEquip {
+		_, err = equipable.NewProcessor(p.l, p.ctx).GetById(templateId)
+	} else if it == inventory.TypeValueUse {
+		_, err = consumable.NewProcessor(p.l, p.ctx).GetById(templateId)
+	} else if it == inventory.TypeValueSetup {
+		_, err = setup.NewProcessor(p.l, p.ctx).GetById(templateId)
+	} else if it == inventory.TypeValueETC {
+		_, err = etc.NewProcessor(p.l, p.ctx).GetById(templateId)
 	}
-	c, err := createCommodity(p.ctx, p.db)(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
 	if err != nil {
-		return Model{}, err
+		p.l.WithError(err).Debugf("Unable to retrieve item template [%d].", templateId)
+		return fmt.Errorf("%w [%d]", ErrUnknownTemplate, templateId)
+	}
+	return nil
+}
+
+func (p *ProcessorImpl) CreateCommodity(npcId uint32, m Model) (Model, error) {
+	if p.CreateFn != nil {
+		return p.CreateFn(npcId, m)
+	}
+	var c Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		var err error
+		c, err = createCommodity(p.ctx, tx)(npcId, m)
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionCreateCommodity, nil, &c)
+	})
+	if txErr != nil {
+		return Model{}, txErr
 	}
 	return model.Map(model.Decorate(model.Decorators(p.DataDecorator)))(model.FixedProvider(c))()
 }
 
-func (p *ProcessorImpl) UpdateCommodity(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (Model, error) {
+func (p *ProcessorImpl) UpdateCommodity(id uuid.UUID, m Model) (Model, error) {
 	if p.UpdateFn != nil {
-		return p.UpdateFn(id, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
-
+		return p.UpdateFn(id, m)
 	}
-	c, err := updateCommodity(p.ctx, p.db)(id, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
-	if err != nil {
-		return Model{}, err
+	var c Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		before, err := model.Map(Make)(getById(p.t.Id(), id)(tx))()
+		if err != nil {
+			return err
+		}
+		c, err = updateCommodity(p.ctx, tx)(id, m)
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionUpdateCommodity, &before, &c)
+	})
+	if txErr != nil {
+		return Model{}, txErr
 	}
 	return model.Map(model.Decorate(model.Decorators(p.DataDecorator)))(model.FixedProvider(c))()
 }
@@ -143,7 +222,69 @@ func (p *ProcessorImpl) DeleteCommodity(id uuid.UUID) error {
 	if p.DeleteFn != nil {
 		return p.DeleteFn(id)
 	}
-	return deleteCommodity(p.ctx, p.db)(id)
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		before, err := model.Map(Make)(getById(p.t.Id(), id)(tx))()
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = deleteCommodity(p.ctx, tx)(id)
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionDeleteCommodity, &before, nil)
+	})
+}
+
+// record audits a change to a commodity. A nil before or after marks the commodity as created or deleted.
+func (p *ProcessorImpl) record(tx *gorm.DB, action string, before *Model, after *Model) error {
+	var npcId uint32
+	var id uuid.UUID
+	var bv, av any
+	for _, m := range []*Model{before, after} {
+		if m != nil {
+			npcId = m.NpcId()
+			id = m.Id()
+		}
+	}
+	if before != nil {
+		rm, err := Transform(*before)
+		if err != nil {
+			return err
+		}
+		bv = rm
+	}
+	if after != nil {
+		rm, err := Transform(*after)
+		if err != nil {
+			return err
+		}
+		av = rm
+	}
+	return p.ap.WithTransaction(tx).Record(action, npcId, id, bv, av)
+}
+
+// deleteAll deletes the commodities provided, auditing each.
+func (p *ProcessorImpl) deleteAll(provider database.EntityProvider[[]Entity], del func(tx *gorm.DB) error) error {
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		ms, err := model.SliceMap(Make)(provider(tx))(model.ParallelMap())()
+		if err != nil {
+			return err
+		}
+		err = del(tx)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			err = p.record(tx, audit.ActionDeleteCommodity, &m, nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (p *ProcessorImpl) GetAllByTenant() ([]Model, error) {
@@ -167,11 +308,15 @@ func (p *ProcessorImpl) CommodityIdToNpcIdMapProvider() model.Provider[map[uuid.
 }
 
 func (p *ProcessorImpl) DeleteAllCommoditiesByNpcId(npcId uint32) error {
-	return deleteAllCommoditiesByNpcId(p.ctx, p.db)(npcId)
+	return p.deleteAll(getByNpcId(p.t.Id(), npcId), func(tx *gorm.DB) error {
+		return deleteAllCommoditiesByNpcId(p.ctx, tx)(npcId)
+	})
 }
 
 func (p *ProcessorImpl) DeleteAllCommodities() error {
-	return deleteAllCommodities(p.ctx, p.db)()
+	return p.deleteAll(getAllByTenant(p.t.Id()), func(tx *gorm.DB) error {
+		return deleteAllCommodities(p.ctx, tx)()
+	})
 }
 
 func (p *ProcessorImpl) ExistsByNpcId(npcId uint32) (bool, error) {
@@ -185,3 +330,77 @@ func (p *ProcessorImpl) GetDistinctNpcIds() ([]uint32, error) {
 func (p *ProcessorImpl) DistinctNpcIdsProvider() model.Provider[[]uint32] {
 	return getDistinctNpcIds(p.t.Id())(p.db)
 }
+
+func (p *ProcessorImpl) GetDeleted() ([]DeletedModel, error) {
+	return p.DeletedProvider()()
+}
+
+func (p *ProcessorImpl) DeletedProvider() model.Provider[[]DeletedModel] {
+	return model.SliceMap(MakeDeleted)(getDeleted(p.t.Id())(p.db))(model.ParallelMap())
+}
+
+func (p *ProcessorImpl) RestoreCommodity(id uuid.UUID) (Model, error) {
+	var c Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		var err error
+		c, err = restoreCommodity(p.ctx, tx)(id)
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionRestoreCommodity, nil, &c)
+	})
+	if txErr != nil {
+		return Model{}, txErr
+	}
+	return model.Map(model.Decorate(model.Decorators(p.DataDecorator)))(model.FixedProvider(c))()
+}
+
+// RestoreDeletedAt restores the commodities of an NPC deleted at the given instant, such as those deleted together with
+// its shop, auditing each.
+func (p *ProcessorImpl) RestoreDeletedAt(npcId uint32, deletedAt time.Time) ([]Model, error) {
+	var cs []Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		var err error
+		cs, err = restoreCommoditiesDeletedAt(p.ctx, tx)(npcId, deletedAt)
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			err = p.record(tx, audit.ActionRestoreCommodity, nil, &c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return cs, nil
+}
+
+func (p *ProcessorImpl) RestoreAsOf(asOf time.Time) error {
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		err := restoreCommoditiesAsOf(p.ctx, tx)(asOf)
+		if err != nil {
+			return err
+		}
+		return p.ap.WithTransaction(tx).Record(audit.ActionRestoreCommoditiesAsOf, 0, uuid.Nil, nil, map[string]any{"asOf": asOf})
+	})
+}
+
+func (p *ProcessorImpl) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		var err error
+		purged, err = purgeDeletedCommodities(p.ctx, tx)(before)
+		if err != nil {
+			return err
+		}
+		return p.ap.WithTransaction(tx).Record(audit.ActionPurgeCommodities, 0, uuid.Nil, nil, map[string]any{"before": before, "purged": purged})
+	})
+	if txErr != nil {
+		return 0, txErr
+	}
+	return purged, nil
+}
@@ -51,7 +51,7 @@ func testCreateCommodity(t *testing.T, processor commodities.Processor, db *gorm
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.CreateCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.CreateCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create commodity: %v", err)
 	}
@@ -91,7 +91,7 @@ func testGetByNpcId(t *testing.T, processor commodities.Processor, db *gorm.DB)
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	_, err := processor.CreateCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err := processor.CreateCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
@@ -143,7 +143,7 @@ func testUpdateCommodity(t *testing.T, processor commodities.Processor, db *gorm
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.CreateCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.CreateCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
@@ -154,7 +154,7 @@ func testUpdateCommodity(t *testing.T, processor commodities.Processor, db *gorm
 	updatedTokenTemplateId := uint32(0)
 	updatedPeriod := uint32(0)
 	updatedLevelLimited := uint32(0)
-	updatedCommodity, err := processor.UpdateCommodity(commodity.Id(), updatedTemplateId, updatedMesoPrice, updatedDiscountRate, updatedTokenTemplateId, updatedTokenPrice, updatedPeriod, updatedLevelLimited)
+	updatedCommodity, err := processor.UpdateCommodity(commodity.Id(), (&commodities.ModelBuilder{}).SetTemplateId(updatedTemplateId).SetMesoPrice(updatedMesoPrice).SetDiscountRate(updatedDiscountRate).SetTokenTemplateId(updatedTokenTemplateId).SetTokenPrice(updatedTokenPrice).SetPeriod(updatedPeriod).SetLevelLimit(updatedLevelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to update commodity: %v", err)
 	}
@@ -200,7 +200,7 @@ func testDeleteCommodity(t *testing.T, processor commodities.Processor, db *gorm
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.CreateCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.CreateCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
@@ -244,7 +244,7 @@ func testExistsByNpcId(t *testing.T, processor commodities.Processor, db *gorm.D
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	_, err = processor.CreateCommodity(existentNpcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err = processor.CreateCommodity(existentNpcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
@@ -275,23 +275,23 @@ func testGetDistinctNpcIds(t *testing.T, processor commodities.Processor, db *go
 	levelLimited := uint32(0)
 
 	// Create commodities for each NPC
-	_, err := processor.CreateCommodity(npcId1, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err := processor.CreateCommodity(npcId1, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity for NPC %d: %v", npcId1, err)
 	}
 
-	_, err = processor.CreateCommodity(npcId2, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err = processor.CreateCommodity(npcId2, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity for NPC %d: %v", npcId2, err)
 	}
 
 	// Create multiple commodities for the same NPC to test distinct
-	_, err = processor.CreateCommodity(npcId3, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err = processor.CreateCommodity(npcId3, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create first test commodity for NPC %d: %v", npcId3, err)
 	}
 
-	_, err = processor.CreateCommodity(npcId3, templateId+1, mesoPrice+100, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	_, err = processor.CreateCommodity(npcId3, (&commodities.ModelBuilder{}).SetTemplateId(templateId+1).SetMesoPrice(mesoPrice+100).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create second test commodity for NPC %d: %v", npcId3, err)
 	}
@@ -18,6 +18,33 @@ func getByNpcId(tenantId uuid.UUID, npcId uint32) database.EntityProvider[[]Enti
 	}
 }
 
+// getById returns a provider that gets a commodity entity by id
+func getById(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		var result Entity
+		err := db.Where(&Entity{TenantId: tenantId, Id: id}).First(&result).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return model.ErrorProvider[Entity](ErrNotFound)
+			}
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(result)
+	}
+}
+
+// getByTemplateId returns a provider that gets the commodity entities of a tenant selling an item
+func getByTemplateId(tenantId uuid.UUID, templateId uint32) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		err := db.Where(&Entity{TenantId: tenantId, TemplateId: templateId}).Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
 func getAllByTenant(tenantId uuid.UUID) database.EntityProvider[[]Entity] {
 	return func(db *gorm.DB) model.Provider[[]Entity] {
 		var results []Entity
@@ -85,3 +112,19 @@ func getDistinctNpcIds(tenantId uuid.UUID) database.EntityProvider[[]uint32] {
 		return model.FixedProvider(results)
 	}
 }
+
+// getDeleted returns a provider that gets all soft-deleted commodity entities for a tenant, most recently deleted first
+func getDeleted(tenantId uuid.UUID) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		err := db.Unscoped().
+			Where("tenant_id = ?", tenantId).
+			Where("deleted_at IS NOT NULL").
+			Order("deleted_at DESC").
+			Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
@@ -2,20 +2,26 @@ package commodities
 
 import (
 	"github.com/google/uuid"
+	"time"
 )
 
 // RestModel is a JSON API representation of the Model
 type RestModel struct {
-	Id           string  `json:"id"`
-	TemplateId   uint32  `json:"templateId"`
-	MesoPrice    uint32  `json:"mesoPrice"`
-	DiscountRate byte    `json:"discountRate"`
-	TokenTemplateId  uint32  `json:"tokenTemplateId"`
-	TokenPrice   uint32  `json:"tokenPrice"`
-	Period       uint32  `json:"period"`
-	LevelLimit   uint32  `json:"levelLimit"`
-	UnitPrice    float64 `json:"unitPrice"`
-	SlotMax      uint32  `json:"slotMax"`
+	Id              string  `json:"id"`
+	TemplateId      uint32  `json:"templateId"`
+	MesoPrice       uint32  `json:"mesoPrice"`
+	DiscountRate    byte    `json:"discountRate"`
+	TokenTemplateId uint32  `json:"tokenTemplateId"`
+	TokenPrice      uint32  `json:"tokenPrice"`
+	Period          uint32  `json:"period"`
+	LevelLimit      uint32  `json:"levelLimit"`
+	UnitPrice       float64 `json:"unitPrice"`
+	SlotMax         uint32  `json:"slotMax"`
+	Inherited       bool    `json:"inherited"`
+	JobMask         uint16  `json:"jobMask"`
+	Gender          byte    `json:"gender"`
+	QuestId         uint32  `json:"questId"`
+	QuestState      byte    `json:"questState"`
 }
 
 // GetID to satisfy jsonapi.MarshalIdentifier interface
@@ -37,24 +43,34 @@ func (r RestModel) GetName() string {
 // Transform converts a Model to a RestModel
 func Transform(m Model) (RestModel, error) {
 	return RestModel{
-		Id:           m.id.String(),
-		TemplateId:   m.templateId,
-		MesoPrice:    m.mesoPrice,
-		DiscountRate: m.discountRate,
-		TokenTemplateId:  m.tokenTemplateId,
-		TokenPrice:   m.tokenPrice,
-		Period:       m.period,
-		LevelLimit:   m.levelLimit,
-		UnitPrice:    m.unitPrice,
-		SlotMax:      m.slotMax,
+		Id:              m.id.String(),
+		TemplateId:      m.templateId,
+		MesoPrice:       m.mesoPrice,
+		DiscountRate:    m.discountRate,
+		TokenTemplateId: m.tokenTemplateId,
+		TokenPrice:      m.tokenPrice,
+		Period:          m.period,
+		LevelLimit:      m.levelLimit,
+		UnitPrice:       m.unitPrice,
+		SlotMax:         m.slotMax,
+		Inherited:       m.inherited,
+		JobMask:         m.jobMask,
+		Gender:          m.gender,
+		QuestId:         m.questId,
+		QuestState:      m.questState,
 	}, nil
 }
 
-// Extract converts a RestModel to a Model
+// Extract converts a RestModel to a Model. Whether a commodity is inherited is decided by the shop template, so the
+// inherited attribute of the request is ignored. A commodity yet to be created has no id.
 func Extract(rm RestModel) (Model, error) {
-	id, err := uuid.Parse(rm.Id)
-	if err != nil {
-		return Model{}, err
+	var id uuid.UUID
+	if rm.Id != "" {
+		var err error
+		id, err = uuid.Parse(rm.Id)
+		if err != nil {
+			return Model{}, err
+		}
 	}
 
 	builder := &ModelBuilder{}
@@ -69,5 +85,47 @@ func Extract(rm RestModel) (Model, error) {
 		SetLevelLimit(rm.LevelLimit).
 		SetUnitPrice(rm.UnitPrice).
 		SetSlotMax(rm.SlotMax).
+		SetJobMask(rm.JobMask).
+		SetGender(rm.Gender).
+		SetQuestId(rm.QuestId).
+		SetQuestState(rm.QuestState).
 		Build(), nil
 }
+
+// DeletedRestModel is a JSON API representation of a soft-deleted commodity
+type DeletedRestModel struct {
+	Id         string    `json:"-"`
+	NpcId      uint32    `json:"npcId"`
+	TemplateId uint32    `json:"templateId"`
+	MesoPrice  uint32    `json:"mesoPrice"`
+	TokenPrice uint32    `json:"tokenPrice"`
+	DeletedAt  time.Time `json:"deletedAt"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r DeletedRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *DeletedRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r DeletedRestModel) GetName() string {
+	return "deleted-commodities"
+}
+
+// TransformDeleted converts a DeletedModel to a DeletedRestModel
+func TransformDeleted(m DeletedModel) (DeletedRestModel, error) {
+	return DeletedRestModel{
+		Id:         m.commodity.id.String(),
+		NpcId:      m.commodity.npcId,
+		TemplateId: m.commodity.templateId,
+		MesoPrice:  m.commodity.mesoPrice,
+		TokenPrice: m.commodity.tokenPrice,
+		DeletedAt:  m.deletedAt,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+var ErrNotConfigured = errors.New("not configured")
+
+// DatabaseCheck pings the database of the gorm connection.
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{Name: "database", Probe: func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// KafkaCheck connects to every broker the producers and consumers use.
+func KafkaCheck(brokers []string) Check {
+	return Check{Name: "kafka", Probe: func(ctx context.Context) error {
+		for _, b := range brokers {
+			if b == "" {
+				return fmt.Errorf("broker %w", ErrNotConfigured)
+			}
+			conn, err := kafka.DialContext(ctx, "tcp", b)
+			if err != nil {
+				return err
+			}
+			_ = conn.Close()
+		}
+		return nil
+	}}
+}
+
+// ConsumerCheck reports the state of the Kafka consumers, as given by the state function.
+func ConsumerCheck(state func() error) Check {
+	return Check{Name: "kafka-consumers", Probe: func(ctx context.Context) error {
+		return state()
+	}}
+}
+
+// ServiceCheck requests the root url of a downstream service. Any response means the service is reachable; the status
+// of a request made without a tenant is not meaningful.
+func ServiceCheck(name string, url string) Check {
+	return Check{Name: name, Probe: func(ctx context.Context) error {
+		if url == "" {
+			return fmt.Errorf("url %w", ErrNotConfigured)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}}
+}
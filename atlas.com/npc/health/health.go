@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+// checkTimeout bounds how long a readiness probe waits on a dependency.
+const checkTimeout = 2 * time.Second
+
+// Check probes a dependency the service needs to serve requests.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// Report is the status of the service and of each dependency checked.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckReport `json:"checks,omitempty"`
+}
+
+// CheckReport is the status of a dependency, with the error of a failed probe.
+type CheckReport struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// LiveHandler reports the process is up. It checks no dependencies, so an outage elsewhere does not restart the service.
+func LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusUp})
+	}
+}
+
+// ReadyHandler reports whether the service can serve requests, probing every check concurrently. The service is not
+// ready while stopping, or when any check fails.
+func ReadyHandler(l logrus.FieldLogger, stopping func() bool, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		report := Report{Status: StatusUp, Checks: make(map[string]CheckReport, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c Check) {
+				defer wg.Done()
+				cr := CheckReport{Status: StatusUp}
+				if err := c.Probe(ctx); err != nil {
+					l.WithError(err).Warnf("Readiness check [%s] failed.", c.Name)
+					cr = CheckReport{Status: StatusDown, Error: err.Error()}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				report.Checks[c.Name] = cr
+				if cr.Status == StatusDown {
+					report.Status = StatusDown
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		if stopping() {
+			report.Status = StatusDown
+		}
+		status := http.StatusOK
+		if report.Status == StatusDown {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	}
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
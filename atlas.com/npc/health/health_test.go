@@ -0,0 +1,68 @@
+package health_test
+
+import (
+	"atlas-npc/health"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyHandler(t *testing.T) {
+	up := health.Check{Name: "database", Probe: func(ctx context.Context) error {
+		return nil
+	}}
+	down := health.Check{Name: "kafka", Probe: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}}
+	running := func() bool { return false }
+	stopping := func() bool { return true }
+
+	tests := []struct {
+		name     string
+		stopping func() bool
+		checks   []health.Check
+		status   int
+		expected map[string]string
+	}{
+		{"AllUp", running, []health.Check{up}, http.StatusOK, map[string]string{"database": health.StatusUp}},
+		{"DependencyDown", running, []health.Check{up, down}, http.StatusServiceUnavailable, map[string]string{"database": health.StatusUp, "kafka": health.StatusDown}},
+		{"TearingDown", stopping, []health.Check{up}, http.StatusServiceUnavailable, map[string]string{"database": health.StatusUp}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			health.ReadyHandler(logrus.New(), tt.stopping, tt.checks...)(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			var report health.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			if (report.Status == health.StatusUp) != (tt.status == http.StatusOK) {
+				t.Errorf("Expected report status to match HTTP status %d, got %s", tt.status, report.Status)
+			}
+			for name, status := range tt.expected {
+				if report.Checks[name].Status != status {
+					t.Errorf("Expected check %s to be %s, got %s", name, status, report.Checks[name].Status)
+				}
+			}
+			if report.Checks["kafka"].Status == health.StatusDown && report.Checks["kafka"].Error == "" {
+				t.Errorf("Expected the failed check to carry its error")
+			}
+		})
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	health.LiveHandler()(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
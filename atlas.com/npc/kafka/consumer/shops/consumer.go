@@ -1,6 +1,7 @@
 package shops
 
 import (
+	"atlas-npc/catalog"
 	consumer2 "atlas-npc/kafka/consumer"
 	shop2 "atlas-npc/kafka/message/shops"
 	"atlas-npc/shops"
@@ -41,6 +42,7 @@ func handleEnterCommand(db *gorm.DB) message.Handler[shop2.Command[shop2.Command
 		if e.Type != shop2.CommandShopEnter {
 			return
 		}
+		catalog.GetSeeder().Initialize(l, ctx, db)
 		_ = shops.NewProcessor(l, ctx, db).EnterAndEmit(e.CharacterId, e.Body.NpcTemplateId)
 	}
 }
@@ -0,0 +1,63 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Chronicle20/atlas-kafka/handler"
+	"sync"
+)
+
+var ErrNoHandlers = errors.New("no handlers registered")
+var ErrStopped = errors.New("consumers stopped")
+
+// State tracks the handlers registered with the consumer manager and the lifetime of its consumers, so readiness can
+// report whether messages are being consumed rather than only whether the brokers can be reached.
+type State struct {
+	ctx      context.Context
+	mutex    sync.Mutex
+	handlers map[string]int
+	errs     []error
+}
+
+// NewState tracks consumers which run until the context is done.
+func NewState(ctx context.Context) *State {
+	return &State{
+		ctx:      ctx,
+		handlers: make(map[string]int),
+		errs:     make([]error, 0),
+	}
+}
+
+// RegisterHandler wraps the handler registration of the consumer manager, recording each handler registered and each
+// registration refused.
+func (s *State) RegisterHandler(rf func(topic string, handler handler.Handler) (string, error)) func(topic string, handler handler.Handler) (string, error) {
+	return func(topic string, h handler.Handler) (string, error) {
+		id, err := rf(topic, h)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if err != nil {
+			s.errs = append(s.errs, fmt.Errorf("topic [%s]: %w", topic, err))
+			return id, err
+		}
+		s.handlers[topic]++
+		return id, nil
+	}
+}
+
+// Err reports why messages are not being consumed: a handler could not be registered, none were, or the consumers have
+// stopped.
+func (s *State) Err() error {
+	if s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.errs) > 0 {
+		return errors.Join(s.errs...)
+	}
+	if len(s.handlers) == 0 {
+		return ErrNoHandlers
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package consumer_test
+
+import (
+	"atlas-npc/kafka/consumer"
+	"context"
+	"errors"
+	"github.com/Chronicle20/atlas-kafka/handler"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	accept := func(topic string, h handler.Handler) (string, error) {
+		return "handler", nil
+	}
+	refuse := func(topic string, h handler.Handler) (string, error) {
+		return "", errors.New("no consumer for topic")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := consumer.NewState(ctx)
+
+	// Consumers without handlers consume nothing
+	if err := s.Err(); !errors.Is(err, consumer.ErrNoHandlers) {
+		t.Errorf("Expected ErrNoHandlers before any handler is registered, got %v", err)
+	}
+
+	// Registered handlers make the consumers ready
+	if _, err := s.RegisterHandler(accept)("shop_command", nil); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Expected consumers to be ready once a handler is registered, got %v", err)
+	}
+
+	// A refused registration is reported
+	if _, err := s.RegisterHandler(refuse)("character_status_event", nil); err == nil {
+		t.Fatalf("Expected the refused registration to be returned")
+	}
+	if err := s.Err(); err == nil {
+		t.Errorf("Expected a refused registration to be reported")
+	}
+
+	// Consumers stop with their context
+	cancel()
+	if err := s.Err(); !errors.Is(err, consumer.ErrStopped) {
+		t.Errorf("Expected ErrStopped once the consumers' context is done, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package message
 
 import (
 	"atlas-npc/kafka/producer"
+	"atlas-npc/metrics"
 	"sync"
 
 	"github.com/Chronicle20/atlas-model/model"
@@ -51,6 +52,7 @@ func Emit(p producer.Provider) func(f func(buf *Buffer) error) error {
 		for t, ms := range b.GetAll() {
 			err = p(t)(model.FixedProvider(ms))
 			if err != nil {
+				metrics.KafkaEmitFailure(t)
 				return err
 			}
 		}
@@ -68,6 +70,7 @@ func EmitWithResult[M any, B any](p producer.Provider) func(func(*Buffer) func(B
 			}
 			for t, ms := range buf.GetAll() {
 				if err = p(t)(model.FixedProvider(ms)); err != nil {
+					metrics.KafkaEmitFailure(t)
 					return result, err
 				}
 			}
@@ -67,7 +67,20 @@ type StatusEvent[E any] struct {
 }
 
 type StatusEventEnteredBody struct {
-	NpcTemplateId uint32 `json:"npcTemplateId"`
+	NpcTemplateId uint32                 `json:"npcTemplateId"`
+	Commodities   []StatusEventCommodity `json:"commodities"`
+}
+
+type StatusEventCommodity struct {
+	TemplateId      uint32  `json:"templateId"`
+	MesoPrice       uint32  `json:"mesoPrice"`
+	DiscountRate    byte    `json:"discountRate"`
+	TokenTemplateId uint32  `json:"tokenTemplateId"`
+	TokenPrice      uint32  `json:"tokenPrice"`
+	Period          uint32  `json:"period"`
+	LevelLimit      uint32  `json:"levelLimit"`
+	UnitPrice       float64 `json:"unitPrice"`
+	SlotMax         uint32  `json:"slotMax"`
 }
 
 type StatusEventExitedBody struct {
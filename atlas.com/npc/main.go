@@ -1,17 +1,29 @@
 package main
 
 import (
+	"atlas-npc/audit"
+	"atlas-npc/catalog"
 	"atlas-npc/commodities"
 	"atlas-npc/database"
+	"atlas-npc/health"
+	consumer2 "atlas-npc/kafka/consumer"
 	character2 "atlas-npc/kafka/consumer/character"
 	shops2 "atlas-npc/kafka/consumer/shops"
 	"atlas-npc/logger"
+	"atlas-npc/metrics"
+	"atlas-npc/openapi"
 	"atlas-npc/service"
 	"atlas-npc/shops"
+	"atlas-npc/tasks"
+	"atlas-npc/templates"
 	"atlas-npc/tracing"
+	"atlas-npc/transactions"
 	"github.com/Chronicle20/atlas-kafka/consumer"
+	"github.com/Chronicle20/atlas-rest/requests"
 	"github.com/Chronicle20/atlas-rest/server"
+	"net/http"
 	"os"
+	"time"
 )
 
 const serviceName = "atlas-npc-shops"
@@ -48,24 +60,49 @@ func main() {
 		l.WithError(err).Fatal("Unable to initialize tracer.")
 	}
 
-	db := database.Connect(l, database.SetMigrations(commodities.Migration, shops.Migration))
+	db := database.Connect(l, database.SetMigrations(commodities.Migration, shops.Migration, templates.Migration, audit.Migration, transactions.Migration))
 
 	cmf := consumer.GetManager().AddConsumer(l, tdm.Context(), tdm.WaitGroup())
 	character2.InitConsumers(l)(cmf)(consumerGroupId)
 	shops2.InitConsumers(l)(cmf)(consumerGroupId)
-	character2.InitHandlers(l)(db)(consumer.GetManager().RegisterHandler)
-	shops2.InitHandlers(l)(db)(consumer.GetManager().RegisterHandler)
+	cs := consumer2.NewState(tdm.Context())
+	character2.InitHandlers(l)(db)(cs.RegisterHandler(consumer.GetManager().RegisterHandler))
+	shops2.InitHandlers(l)(db)(cs.RegisterHandler(consumer.GetManager().RegisterHandler))
+
+	tasks.Register(l, tdm.Context())(shops.NewClosingTask(l, db, time.Minute))
+	tasks.Register(l, tdm.Context())(shops.NewIdleSessionTask(l, db, time.Minute))
+
+	ops := http.NewServeMux()
+	ops.Handle("/metrics", metrics.Handler())
+	ops.Handle("/health/live", health.LiveHandler())
+	ops.Handle("/health/ready", health.ReadyHandler(l, tdm.Stopping,
+		health.DatabaseCheck(db),
+		health.KafkaCheck(consumer2.LookupBrokers()),
+		health.ConsumerCheck(cs.Err),
+		health.ServiceCheck("data", requests.RootUrl("DATA")),
+		health.ServiceCheck("characters", requests.RootUrl("CHARACTERS")),
+		health.ServiceCheck("inventory", requests.RootUrl("INVENTORY")),
+		health.ServiceCheck("quests", requests.RootUrl("QUESTS")),
+	))
+	shutdownOps := metrics.Serve(l)(ops)
 
 	server.New(l).
 		WithContext(tdm.Context()).
 		WithWaitGroup(tdm.WaitGroup()).
 		SetBasePath(GetServer().GetPrefix()).
 		SetPort(os.Getenv("REST_PORT")).
+		AddRouteInitializer(catalog.GetSeeder().SeedRequests(db)).
 		AddRouteInitializer(shops.InitResource(GetServer())(db)).
+		AddRouteInitializer(templates.InitResource(GetServer())(db)).
+		AddRouteInitializer(catalog.InitResource(GetServer())(db)).
+		AddRouteInitializer(audit.InitResource(GetServer())(db)).
+		AddRouteInitializer(transactions.InitResource(GetServer())(db)).
+		AddRouteInitializer(openapi.InitResource(GetServer())).
 		Run()
 
 	tdm.TeardownFunc(tracing.Teardown(l)(tc))
 
 	tdm.Wait()
+	shutdownOps()
 	l.Infoln("Service shutdown.")
 }
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "atlas_npc"
+
+const (
+	OutcomeSuccess  = "success"
+	OutcomeRejected = "rejected"
+	OutcomeFailed   = "failed"
+)
+
+var shopOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "shop_operations_total",
+	Help:      "Shop operations handled, by operation, outcome and the error code sent to the character.",
+}, []string{"operation", "outcome", "code"})
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "rest_request_duration_seconds",
+	Help:      "Latency of REST requests to the services this service depends on.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"dependency", "method", "outcome"})
+
+var consumableCache = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "consumable_cache_lookups_total",
+	Help:      "Lookups of the rechargeable consumable cache, by result.",
+}, []string{"result"})
+
+var registryOccupancy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "shop_registry_characters",
+	Help:      "Characters currently in a shop, by tenant.",
+}, []string{"tenant"})
+
+var kafkaEmitFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "kafka_emit_failures_total",
+	Help:      "Kafka messages which could not be produced, by topic.",
+}, []string{"topic"})
+
+var transactionRecordFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "transaction_record_failures_total",
+	Help:      "Completed shop operations which could not be recorded for the economy analytics, by operation.",
+}, []string{"operation"})
+
+// ShopOperation counts a shop operation. The code is the error code sent to the character when rejected.
+func ShopOperation(operation string, outcome string, code string) {
+	shopOperations.WithLabelValues(operation, outcome, code).Inc()
+}
+
+// Request observes the latency of a REST request to a dependency.
+func Request(dependency string, method string, err error, elapsed time.Duration) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailed
+	}
+	requestDuration.WithLabelValues(dependency, method, outcome).Observe(elapsed.Seconds())
+}
+
+// ConsumableCacheHit counts a lookup served from the consumable cache.
+func ConsumableCacheHit() {
+	consumableCache.WithLabelValues("hit").Inc()
+}
+
+// ConsumableCacheMiss counts a lookup which loaded from the data service.
+func ConsumableCacheMiss() {
+	consumableCache.WithLabelValues("miss").Inc()
+}
+
+// RegistryOccupancy sets the number of characters in a shop for a tenant.
+func RegistryOccupancy(tenantId string, characters int) {
+	registryOccupancy.WithLabelValues(tenantId).Set(float64(characters))
+}
+
+// KafkaEmitFailure counts a failure to produce the messages of a topic.
+func KafkaEmitFailure(topic string) {
+	kafkaEmitFailures.WithLabelValues(topic).Inc()
+}
+
+// TransactionRecordFailure counts a completed shop operation which could not be recorded.
+func TransactionRecordFailure(operation string) {
+	transactionRecordFailures.WithLabelValues(operation).Inc()
+}
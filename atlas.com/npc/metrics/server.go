@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"time"
+)
+
+// EnvOpsPort is the port of the operational endpoints, served apart from the REST API.
+const EnvOpsPort = "OPS_PORT"
+
+const defaultOpsPort = "9100"
+
+// Handler serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve runs the operational endpoints of the mux, returning a function which shuts them down. The endpoints are not
+// bound to the teardown of the service: they are shut down last, once the REST API and Kafka consumers have stopped, so
+// readiness reports the service as stopping and metrics are scraped for as long as it is draining.
+func Serve(l logrus.FieldLogger) func(mux *http.ServeMux) func() {
+	return func(mux *http.ServeMux) func() {
+		port := os.Getenv(EnvOpsPort)
+		if port == "" {
+			port = defaultOpsPort
+		}
+		srv := &http.Server{Addr: ":" + port, Handler: mux}
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			l.Infof("Serving operational endpoints on port [%s].", port)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.WithError(err).Errorf("Operational endpoints stopped.")
+			}
+		}()
+
+		return func() {
+			sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(sctx); err != nil {
+				l.WithError(err).Errorf("Unable to shut down operational endpoints.")
+			}
+			<-stopped
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package openapi_test
+
+import (
+	"atlas-npc/audit"
+	"atlas-npc/catalog"
+	"atlas-npc/openapi"
+	"atlas-npc/shops"
+	"atlas-npc/templates"
+	"atlas-npc/transactions"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testServerInformation struct{}
+
+func (s testServerInformation) GetBaseURL() string {
+	return ""
+}
+
+func (s testServerInformation) GetPrefix() string {
+	return "/api/"
+}
+
+// registeredRouter registers the routes of every resource the service serves.
+func registeredRouter() *mux.Router {
+	si := testServerInformation{}
+	l := logrus.New()
+	router := mux.NewRouter()
+	shops.InitResource(si)(nil)(router, l)
+	templates.InitResource(si)(nil)(router, l)
+	catalog.InitResource(si)(nil)(router, l)
+	audit.InitResource(si)(nil)(router, l)
+	transactions.InitResource(si)(nil)(router, l)
+	openapi.InitResource(si)(router, l)
+	return router
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	spec := openapi.Spec(testServerInformation{}.GetPrefix())
+
+	registered := make(map[string]bool)
+	err := registeredRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, m := range methods {
+			registered[strings.ToLower(m)+" "+path] = true
+			if _, ok := spec.Paths[path][strings.ToLower(m)]; !ok {
+				t.Errorf("Route [%s %s] is missing from the specification.", m, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+
+	for path, item := range spec.Paths {
+		for m := range item {
+			if !registered[m+" "+path] {
+				t.Errorf("Specification documents [%s %s], which is not a registered route.", strings.ToUpper(m), path)
+			}
+		}
+	}
+}
+
+func TestSpecReferences(t *testing.T) {
+	spec := openapi.Spec("/api/")
+	if len(spec.Servers) != 1 || spec.Servers[0].Url != "/api" {
+		t.Errorf("Expected server url [/api], got %v.", spec.Servers)
+	}
+
+	b, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("Failed to marshal specification: %v", err)
+	}
+	var doc any
+	if err = json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal specification: %v", err)
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch tv := v.(type) {
+		case map[string]any:
+			if r, ok := tv["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(r, "#/components/"), "/")
+				found := false
+				switch parts[0] {
+				case "schemas":
+					_, found = spec.Components.Schemas[parts[1]]
+				case "parameters":
+					_, found = spec.Components.Parameters[parts[1]]
+				}
+				if !found {
+					t.Errorf("Unresolved reference [%s].", r)
+				}
+			}
+			for _, c := range tv {
+				walk(c)
+			}
+		case []any:
+			for _, c := range tv {
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func TestTenantHeaders(t *testing.T) {
+	spec := openapi.Spec("/api/")
+	for path, item := range spec.Paths {
+		if path == "/openapi.json" {
+			continue
+		}
+		for m, o := range item {
+			found := false
+			for _, p := range o.Parameters {
+				if p.Ref == "#/components/parameters/TenantId" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Operation [%s %s] does not document the tenant headers.", strings.ToUpper(m), path)
+			}
+		}
+	}
+}
+
+func TestServeSpec(t *testing.T) {
+	w := httptest.NewRecorder()
+	registeredRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status [%d], got [%d].", http.StatusOK, w.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to unmarshal specification: %v", err)
+	}
+	if doc.OpenAPI == "" || len(doc.Paths) == 0 {
+		t.Errorf("Expected a specification, got %s.", w.Body.String())
+	}
+}
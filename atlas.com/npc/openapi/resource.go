@@ -0,0 +1,32 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/Chronicle20/atlas-rest/server"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// InitResource serves the specification of the REST API. It is not tenant specific, so needs no tenant headers.
+func InitResource(si jsonapi.ServerInformation) server.RouteInitializer {
+	return func(router *mux.Router, l logrus.FieldLogger) {
+		spec, err := json.Marshal(Spec(si.GetPrefix()))
+		if err != nil {
+			l.WithError(err).Errorf("Serializing OpenAPI specification.")
+			return
+		}
+		router.HandleFunc("/openapi.json", handleGetSpec(l, spec)).Methods(http.MethodGet)
+	}
+}
+
+func handleGetSpec(l logrus.FieldLogger, spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", JsonMediaType)
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(spec); err != nil {
+			l.WithError(err).Errorf("Writing OpenAPI specification.")
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package openapi
+
+const (
+	JsonApiMediaType = "application/vnd.api+json"
+	JsonMediaType    = "application/json"
+	CsvMediaType     = "text/csv"
+	EventMediaType   = "text/event-stream"
+)
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func str(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+func enum(description string, values ...string) *Schema {
+	return &Schema{Type: "string", Description: description, Enum: values}
+}
+
+func id(description string) *Schema {
+	return &Schema{Type: "string", Format: "uuid", Description: description}
+}
+
+func dateTime(description string) *Schema {
+	return &Schema{Type: "string", Format: "date-time", Description: description}
+}
+
+func integer(description string) *Schema {
+	return &Schema{Type: "integer", Format: "int64", Description: description}
+}
+
+func number(description string) *Schema {
+	return &Schema{Type: "number", Description: description}
+}
+
+func boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+func array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+func object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+func readOnly(s *Schema) *Schema {
+	s.ReadOnly = true
+	return s
+}
+
+// resource describes a JSON:API resource object of the given type. Each relationship is a to-many relationship
+// named for, and holding identifiers of, the resource type it refers to.
+func resource(resourceType string, attributes string, relationships ...string) *Schema {
+	properties := map[string]*Schema{
+		"type":       enum("", resourceType),
+		"id":         str(""),
+		"attributes": ref(attributes),
+	}
+	if len(relationships) > 0 {
+		rs := make(map[string]*Schema, len(relationships))
+		for _, r := range relationships {
+			rs[r] = object(map[string]*Schema{"data": array(ref("ResourceIdentifier"))})
+		}
+		properties["relationships"] = object(rs)
+	}
+	return object(properties, "type", "attributes")
+}
+
+// single describes a JSON:API document whose primary data is one resource, with any included resources.
+func single(resource string, included ...string) *Schema {
+	return document(ref(resource), included...)
+}
+
+// collection describes a JSON:API document whose primary data is a list of resources, with any included resources.
+func collection(resource string, included ...string) *Schema {
+	return document(array(ref(resource)), included...)
+}
+
+// page describes a JSON:API document holding a page of a list of resources, with the number of matching resources in
+// its meta and links to the other pages.
+func page(resource string, included ...string) *Schema {
+	d := collection(resource, included...)
+	d.Properties["meta"] = object(map[string]*Schema{
+		"total": integer("Number of resources matching the filters, across all pages."),
+		"page": object(map[string]*Schema{
+			"number": integer(""),
+			"size":   integer(""),
+			"last":   integer("Number of the last page, 1 when nothing matches."),
+		}),
+	}, "total", "page")
+	d.Properties["links"] = object(map[string]*Schema{
+		"self":  str(""),
+		"first": str(""),
+		"last":  str(""),
+		"prev":  str("Absent on the first page."),
+		"next":  str("Absent on the last page."),
+	}, "self", "first", "last")
+	d.Required = append(d.Required, "meta", "links")
+	return d
+}
+
+func document(data *Schema, included ...string) *Schema {
+	properties := map[string]*Schema{"data": data}
+	if len(included) == 1 {
+		properties["included"] = array(ref(included[0]))
+	} else if len(included) > 1 {
+		is := make([]*Schema, 0, len(included))
+		for _, i := range included {
+			is = append(is, ref(i))
+		}
+		properties["included"] = array(&Schema{OneOf: is})
+	}
+	return object(properties, "data")
+}
+
+// schemas are the component schemas, the attributes and resource objects of every resource type the service reads
+// or writes, and the JSON:API error document.
+func schemas() map[string]*Schema {
+	return map[string]*Schema{
+		"ResourceIdentifier": object(map[string]*Schema{
+			"type": str(""),
+			"id":   str(""),
+		}, "type", "id"),
+		"Errors": object(map[string]*Schema{
+			"errors": array(object(map[string]*Schema{
+				"status": str("HTTP status code of the error."),
+				"code":   str("Machine readable reason, such as UNKNOWN_TEMPLATE or ARBITRAGE."),
+				"title":  str(""),
+				"detail": str(""),
+				"source": object(map[string]*Schema{
+					"pointer":   str("JSON pointer to the offending attribute of the request document."),
+					"parameter": str("Query parameter at fault."),
+				}),
+			}, "status", "title")),
+		}, "errors"),
+
+		"ShopAttributes": object(map[string]*Schema{
+			"npcId":          integer(""),
+			"recharger":      boolean(""),
+			"name":           str(""),
+			"description":    str(""),
+			"opensAt":        str("Time of day the shop opens, as HH:MM. Empty when always open."),
+			"closesAt":       str("Time of day the shop closes, as HH:MM. Empty when always open."),
+			"timeZone":       str("IANA time zone of the opening hours."),
+			"enabled":        boolean("Absent on input means enabled."),
+			"shopTemplateId": str("Template the shop inherits commodities from. Empty when none."),
+			"excludedItems":  array(integer("Item template id.")),
+		}),
+		"Shop": resource("shops", "ShopAttributes", "commodities"),
+
+		"CommodityAttributes": commodityAttributes(),
+		"Commodity":           resource("commodities", "CommodityAttributes"),
+		"CommoditySnapshot":   commoditySnapshot(),
+
+		"CharacterCommodityAttributes": object(map[string]*Schema{
+			"templateId":             integer(""),
+			"mesoPrice":              integer(""),
+			"discountRate":           integer("Percentage taken off the meso price."),
+			"effectivePrice":         integer("Meso price after discount."),
+			"tokenTemplateId":        integer(""),
+			"tokenPrice":             integer(""),
+			"levelLimit":             integer(""),
+			"unitPrice":              number(""),
+			"slotMax":                integer(""),
+			"inherited":              boolean(""),
+			"meetsLevelRequirement":  boolean(""),
+			"meetsJobRequirement":    boolean(""),
+			"meetsGenderRequirement": boolean(""),
+			"meetsQuestRequirement":  boolean(""),
+			"available":              boolean("Whether the character meets every requirement."),
+			"remainingAllowance":     integer(""),
+			"affordable":             boolean(""),
+		}),
+		"CharacterCommodity": resource("character-commodities", "CharacterCommodityAttributes"),
+
+		"CharacterAttributes": object(map[string]*Schema{}),
+		"Character":           resource("characters", "CharacterAttributes"),
+
+		"ShopSessionAttributes": object(map[string]*Schema{
+			"characterId":  integer(""),
+			"npcId":        integer(""),
+			"enteredAt":    dateTime(""),
+			"lastActivity": dateTime("When the character entered, or last bought, sold or recharged."),
+		}),
+		"ShopSession": resource("shop-sessions", "ShopSessionAttributes"),
+
+		"DeletedShopAttributes": object(map[string]*Schema{
+			"npcId":     integer(""),
+			"name":      str(""),
+			"recharger": boolean(""),
+			"deletedAt": dateTime(""),
+		}),
+		"DeletedShop": resource("deleted-shops", "DeletedShopAttributes"),
+
+		"DeletedCommodityAttributes": object(map[string]*Schema{
+			"npcId":      integer(""),
+			"templateId": integer(""),
+			"mesoPrice":  integer(""),
+			"tokenPrice": integer(""),
+			"deletedAt":  dateTime(""),
+		}),
+		"DeletedCommodity": resource("deleted-commodities", "DeletedCommodityAttributes"),
+
+		"ShopDiffAttributes": object(map[string]*Schema{
+			"npcId":             integer(""),
+			"created":           boolean("Whether the update would create the shop."),
+			"changedAttributes": array(str("")),
+			"added":             array(ref("CommoditySnapshot")),
+			"updated": array(object(map[string]*Schema{
+				"before": ref("CommoditySnapshot"),
+				"after":  ref("CommoditySnapshot"),
+			})),
+			"removed":   array(ref("CommoditySnapshot")),
+			"unchanged": integer(""),
+		}),
+		"ShopDiff": resource("shop-diffs", "ShopDiffAttributes"),
+
+		"VendorAttributes": object(map[string]*Schema{
+			"npcId":              integer(""),
+			"shopName":           str(""),
+			"commodityId":        id(""),
+			"templateId":         integer(""),
+			"mesoPrice":          integer(""),
+			"discountRate":       integer(""),
+			"effectiveMesoPrice": integer(""),
+			"tokenTemplateId":    integer(""),
+			"tokenPrice":         integer(""),
+			"levelLimit":         integer(""),
+			"inherited":          boolean(""),
+		}),
+		"Vendor": resource("vendors", "VendorAttributes"),
+
+		"ArbitrageAttributes": object(map[string]*Schema{
+			"npcId":              integer(""),
+			"commodityId":        id(""),
+			"templateId":         integer(""),
+			"inherited":          boolean(""),
+			"effectiveMesoPrice": integer(""),
+			"sellPrice":          integer(""),
+			"profit":             integer(""),
+		}),
+		"Arbitrage": resource("shop-arbitrage", "ArbitrageAttributes"),
+
+		"Activity": object(map[string]*Schema{
+			"npcId":       integer(""),
+			"characterId": integer(""),
+			"operation":   enum("", "enter", "exit", "buy", "sell", "recharge"),
+			"outcome":     enum("", "success", "rejected", "failed"),
+			"code":        str("Reason a rejected operation was refused."),
+			"templateId":  integer(""),
+			"quantity":    integer(""),
+			"occurredAt":  dateTime(""),
+		}),
+
+		"ShopTemplateAttributes": object(map[string]*Schema{
+			"name":        str(""),
+			"description": str(""),
+		}),
+		"ShopTemplate": resource("shop-templates", "ShopTemplateAttributes", "commodities"),
+
+		"ShopImportAttributes": object(map[string]*Schema{
+			"shops":       integer("Number of shops imported."),
+			"commodities": integer("Number of commodities imported."),
+			"errors":      array(ref("RowError")),
+			"skipped":     array(ref("RowError")),
+		}),
+		"ShopImport": resource("shop-imports", "ShopImportAttributes"),
+		"RowError": object(map[string]*Schema{
+			"source":     str(""),
+			"row":        integer(""),
+			"npcId":      integer(""),
+			"templateId": integer(""),
+			"message":    str(""),
+		}),
+
+		"ShopCloneAttributes": object(map[string]*Schema{
+			"sourceTenantId":       id(""),
+			"sourceRegion":         str("Defaults to the region of the target tenant."),
+			"sourceMajorVersion":   integer("Defaults to the version of the target tenant."),
+			"sourceMinorVersion":   integer(""),
+			"mode":                 enum("Defaults to overwrite.", "overwrite", "merge"),
+			"skipUnknownTemplates": boolean(""),
+		}, "sourceTenantId"),
+		"ShopClone": resource("shop-clones", "ShopCloneAttributes"),
+
+		"ShopAuditAttributes": object(map[string]*Schema{
+			"actor":       str(""),
+			"action":      str(""),
+			"npcId":       integer(""),
+			"commodityId": id(""),
+			"before":      &Schema{Type: "object", Description: "State before the change, null for creations."},
+			"after":       &Schema{Type: "object", Description: "State after the change, null for deletions."},
+			"createdAt":   dateTime(""),
+		}),
+		"ShopAudit": resource("shop-audits", "ShopAuditAttributes"),
+
+		"ShopEconomyAttributes": object(map[string]*Schema{
+			"npcId":          integer("Set when grouped by shop."),
+			"templateId":     integer("Set when grouped by item."),
+			"day":            str("Set when grouped by day, as YYYY-MM-DD."),
+			"mesoSunk":       integer(""),
+			"mesoPaid":       integer(""),
+			"tokensConsumed": integer(""),
+			"quantity":       integer(""),
+			"uniqueBuyers":   integer(""),
+			"transactions":   integer(""),
+		}),
+		"ShopEconomy": resource("shop-economy", "ShopEconomyAttributes"),
+	}
+}
+
+// commodityAttributes are the attributes of a commodity. The unit price and slot max come from reference data, and the
+// inheritance of a commodity from the shop, so are read only.
+func commodityAttributes() *Schema {
+	return object(map[string]*Schema{
+		"templateId":      integer(""),
+		"mesoPrice":       integer(""),
+		"discountRate":    integer("Percentage taken off the meso price."),
+		"tokenTemplateId": integer(""),
+		"tokenPrice":      integer(""),
+		"period":          integer(""),
+		"levelLimit":      integer(""),
+		"jobMask":         integer("Jobs allowed to buy, 0 for all."),
+		"gender":          integer("0 either, 1 male, 2 female."),
+		"questId":         integer(""),
+		"questState":      integer(""),
+		"unitPrice":       readOnly(number("")),
+		"slotMax":         readOnly(integer("")),
+		"inherited":       readOnly(boolean("Whether the commodity is inherited from the shop template.")),
+	}, "templateId")
+}
+
+// commoditySnapshot is a commodity serialized outside a resource object, as it appears in a shop diff.
+func commoditySnapshot() *Schema {
+	s := commodityAttributes()
+	s.Properties["id"] = str("")
+	return s
+}
@@ -0,0 +1,357 @@
+package openapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	version = "1.0.0"
+
+	tagShops       = "shops"
+	tagCommodities = "commodities"
+	tagCharacters  = "characters"
+	tagTemplates   = "shop-templates"
+	tagCatalog     = "catalog"
+	tagAudit       = "audit"
+	tagAnalytics   = "analytics"
+)
+
+// tenantHeaders identify the tenant of a request. Every operation other than the specification itself requires them.
+var tenantHeaders = []Parameter{
+	{Ref: "#/components/parameters/TenantId"},
+	{Ref: "#/components/parameters/Region"},
+	{Ref: "#/components/parameters/MajorVersion"},
+	{Ref: "#/components/parameters/MinorVersion"},
+	{Ref: "#/components/parameters/Actor"},
+}
+
+func parameters() map[string]Parameter {
+	return map[string]Parameter{
+		"TenantId":     {Name: "TENANT_ID", In: "header", Required: true, Schema: id("")},
+		"Region":       {Name: "REGION", In: "header", Required: true, Schema: str("")},
+		"MajorVersion": {Name: "MAJOR_VERSION", In: "header", Required: true, Schema: integer("")},
+		"MinorVersion": {Name: "MINOR_VERSION", In: "header", Required: true, Schema: integer("")},
+		"Actor":        {Name: "ACTOR_ID", In: "header", Description: "Recorded as the actor of audited changes.", Schema: str("")},
+		"IfMatch": {Name: "If-Match", In: "header", Required: true,
+			Description: "ETag of the shop the write is conditional on, or * to write unconditionally.", Schema: str("")},
+		"NpcId":          {Name: "npcId", In: "path", Required: true, Schema: integer("")},
+		"CommodityId":    {Name: "commodityId", In: "path", Required: true, Schema: id("")},
+		"ShopId":         {Name: "shopId", In: "path", Required: true, Schema: id("")},
+		"ShopTemplateId": {Name: "shopTemplateId", In: "path", Required: true, Schema: id("")},
+		"TemplateId":     {Name: "templateId", In: "path", Required: true, Schema: integer("Item template id.")},
+		"CharacterId":    {Name: "characterId", In: "path", Required: true, Schema: integer("")},
+		"Include": {Name: "include", In: "query", Description: "Set to commodities to include the commodities of the shops.",
+			Schema: enum("", "commodities")},
+	}
+}
+
+func param(name string) Parameter {
+	return Parameter{Ref: "#/components/parameters/" + name}
+}
+
+func query(name string, s *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Schema: s}
+}
+
+type operationBuilder struct {
+	o *Operation
+}
+
+// operation starts an operation. Operations are identified by the name their handler is registered under.
+func operation(operationId string, tag string, summary string) *operationBuilder {
+	return &operationBuilder{o: &Operation{
+		OperationId: operationId,
+		Summary:     summary,
+		Tags:        []string{tag},
+		Parameters:  append([]Parameter{}, tenantHeaders...),
+		Responses:   map[string]Response{},
+	}}
+}
+
+func (b *operationBuilder) params(ps ...Parameter) *operationBuilder {
+	b.o.Parameters = append(b.o.Parameters, ps...)
+	return b
+}
+
+func (b *operationBuilder) body(mediaType string, s *Schema) *operationBuilder {
+	if b.o.RequestBody == nil {
+		b.o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{}}
+	}
+	b.o.RequestBody.Content[mediaType] = MediaType{Schema: s}
+	return b
+}
+
+func (b *operationBuilder) respond(status int, description string, mediaType string, s *Schema) *operationBuilder {
+	r := b.o.Responses[strconv.Itoa(status)]
+	r.Description = description
+	if s != nil {
+		if r.Content == nil {
+			r.Content = map[string]MediaType{}
+		}
+		r.Content[mediaType] = MediaType{Schema: s}
+	}
+	b.o.Responses[strconv.Itoa(status)] = r
+	return b
+}
+
+func (b *operationBuilder) ok(s *Schema) *operationBuilder {
+	return b.respond(http.StatusOK, "OK.", JsonApiMediaType, s)
+}
+
+func (b *operationBuilder) status(status int, description string) *operationBuilder {
+	return b.respond(status, description, "", nil)
+}
+
+func (b *operationBuilder) errors(status int, description string) *operationBuilder {
+	return b.respond(status, description, JsonApiMediaType, ref("Errors"))
+}
+
+func (b *operationBuilder) header(status int, name string, description string) *operationBuilder {
+	r := b.o.Responses[strconv.Itoa(status)]
+	if r.Headers == nil {
+		r.Headers = map[string]Header{}
+	}
+	r.Headers[name] = Header{Description: description, Schema: str("")}
+	b.o.Responses[strconv.Itoa(status)] = r
+	return b
+}
+
+// conditional marks a write as conditional on the version of the shop, refused without an If-Match header.
+func (b *operationBuilder) conditional() *operationBuilder {
+	return b.params(param("IfMatch")).
+		status(http.StatusPreconditionFailed, "The shop has changed since the given ETag.").
+		status(http.StatusPreconditionRequired, "The If-Match header is missing.")
+}
+
+type paths map[string]PathItem
+
+func (ps paths) add(path string, method string, b *operationBuilder) {
+	if _, ok := ps[path]; !ok {
+		ps[path] = PathItem{}
+	}
+	ps[path][strings.ToLower(method)] = b.o
+}
+
+// Spec builds the specification of the REST API, served under the prefix of the server.
+func Spec(prefix string) Document {
+	ps := paths{}
+	shopPaths(ps)
+	templatePaths(ps)
+	catalogPaths(ps)
+	auditPaths(ps)
+	analyticsPaths(ps)
+	ps["/openapi.json"] = PathItem{"get": &Operation{
+		OperationId: "get_openapi",
+		Summary:     "Get the OpenAPI specification of the service.",
+		Responses: map[string]Response{"200": {Description: "OK.", Content: map[string]MediaType{
+			JsonMediaType: {Schema: &Schema{Type: "object"}},
+		}}},
+	}}
+
+	return Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "atlas-npc",
+			Description: "NPC shops, their commodities and shop templates. Resources are exchanged as JSON:API documents.",
+			Version:     version,
+		},
+		Servers:    []Server{{Url: "/" + strings.Trim(prefix, "/")}},
+		Paths:      ps,
+		Components: Components{Schemas: schemas(), Parameters: parameters()},
+	}
+}
+
+func shopPaths(ps paths) {
+	ps.add("/shops", http.MethodGet, operation("get_all_shops", tagShops, "Get all shops of the tenant.").
+		params(
+			query("sort", str("Comma separated attributes to sort by, each optionally prefixed with - for descending order. One of npcId, name, recharger, enabled, createdAt or updatedAt.")),
+			query("filter[recharger]", boolean("")),
+			query("filter[enabled]", boolean("")),
+			query("filter[npcId]", str("An NPC id, or an inclusive range min..max with either bound optional and min no greater than max.")),
+			query("filter[shopTemplateId]", id("")),
+			query("page[number]", integer("1 based. Defaults to 1.")),
+			query("page[size]", integer("Between 1 and 500. Defaults to 50.")),
+			param("Include"),
+		).
+		ok(page("Shop", "Commodity")).
+		status(http.StatusBadRequest, "The sort, filter or page parameters are invalid, or the NPC id range is reversed."))
+	ps.add("/shops", http.MethodDelete, operation("delete_all_shops", tagShops, "Delete all shops of the tenant.").
+		status(http.StatusNoContent, "Deleted."))
+	ps.add("/shops/arbitrage", http.MethodGet, operation("get_shop_arbitrage", tagShops, "Get the commodities which can be bought for less than they sell for, most profitable first.").
+		ok(collection("Arbitrage")))
+	ps.add("/shops/sessions", http.MethodGet, operation("get_shop_sessions", tagCharacters, "Get every character in a shop, ordered by shop and then character.").
+		ok(collection("ShopSession")))
+	ps.add("/shops/deleted", http.MethodGet, operation("get_deleted_shops", tagShops, "Get the soft deleted shops of the tenant.").
+		ok(collection("DeletedShop")))
+	ps.add("/shops/deleted", http.MethodDelete, operation("purge_deleted_shops", tagShops, "Permanently delete shops and commodities deleted longer ago than the retention.").
+		params(Parameter{Name: "retention", In: "query", Required: true, Schema: str("A Go duration, such as 720h.")}).
+		status(http.StatusNoContent, "Purged.").
+		status(http.StatusBadRequest, "The retention is invalid."))
+	ps.add("/shops/deleted/{shopId}/restore", http.MethodPost, operation("restore_shop", tagShops, "Restore a soft deleted shop and the commodities deleted with it.").
+		params(param("ShopId")).
+		ok(single("Shop")).
+		status(http.StatusNotFound, "No deleted shop has the id.").
+		status(http.StatusConflict, "The NPC has a shop again."))
+	ps.add("/shops/restore", http.MethodPost, operation("restore_shops_as_of", tagShops, "Restore the shops and commodities deleted since a point in time.").
+		params(Parameter{Name: "asOf", In: "query", Required: true, Schema: dateTime("RFC 3339 time.")}).
+		status(http.StatusNoContent, "Restored.").
+		status(http.StatusBadRequest, "The point in time is invalid."))
+	ps.add("/commodities/deleted", http.MethodGet, operation("get_deleted_commodities", tagCommodities, "Get the soft deleted commodities of the tenant.").
+		ok(collection("DeletedCommodity")))
+	ps.add("/commodities/deleted/{commodityId}/restore", http.MethodPost, operation("restore_commodity", tagCommodities, "Restore a soft deleted commodity.").
+		params(param("CommodityId")).
+		ok(single("Commodity")).
+		status(http.StatusNotFound, "No deleted commodity has the id."))
+	ps.add("/items/{templateId}/vendors", http.MethodGet, operation("get_item_vendors", tagShops, "Get the shops selling an item, cheapest first.").
+		params(param("TemplateId")).
+		ok(collection("Vendor")))
+	ps.add("/shop-templates/{shopTemplateId}/shops", http.MethodGet, operation("get_shop_template_shops", tagTemplates, "Get the shops inheriting from a template.").
+		params(param("ShopTemplateId"), param("Include")).
+		ok(collection("Shop", "Commodity")))
+
+	ps.add("/npcs/{npcId}/shop", http.MethodGet, operation("get_shop", tagShops, "Get the shop of an NPC.").
+		params(param("NpcId"), param("Include"),
+			query("characterId", integer("Restricts included commodities to those the character may buy."))).
+		ok(single("Shop", "Commodity")).
+		header(http.StatusOK, "ETag", "Version of the shop, for conditional writes.").
+		status(http.StatusNotFound, "The NPC has no shop."))
+	ps.add("/npcs/{npcId}/shop", http.MethodPost, operation("create_shop", tagShops, "Create the shop of an NPC with its commodities.").
+		params(param("NpcId")).
+		body(JsonApiMediaType, single("Shop", "Commodity")).
+		respond(http.StatusCreated, "Created.", JsonApiMediaType, single("Shop", "Commodity")).
+		header(http.StatusCreated, "ETag", "Version of the shop, for conditional writes.").
+		status(http.StatusBadRequest, "The document is invalid.").
+		status(http.StatusConflict, "The NPC already has a shop.").
+		errors(http.StatusUnprocessableEntity, "A commodity is invalid."))
+	ps.add("/npcs/{npcId}/shop", http.MethodPut, operation("update_shop", tagShops, "Replace the shop of an NPC and its commodities.").
+		params(param("NpcId"), query("dryRun", boolean("Describe the changes the update would make, without making them. Refused like the update when If-Match is missing or stale."))).
+		body(JsonApiMediaType, single("Shop", "Commodity")).
+		respond(http.StatusOK, "Updated, or the changes of a dry run.", JsonApiMediaType, &Schema{OneOf: []*Schema{single("Shop", "Commodity"), single("ShopDiff")}}).
+		header(http.StatusOK, "ETag", "Version of the shop, for conditional writes.").
+		status(http.StatusBadRequest, "The document is invalid.").
+		errors(http.StatusUnprocessableEntity, "A commodity is invalid.").
+		conditional())
+	ps.add("/npcs/{npcId}/shop/activity", http.MethodGet, operation("get_shop_activity", tagShops, "Stream the operations characters perform in the shop as server-sent events.").
+		params(param("NpcId")).
+		respond(http.StatusOK, "A stream of events named for the operation, each carrying an activity.", EventMediaType, ref("Activity")))
+	ps.add("/npcs/{npcId}/shop/characters", http.MethodGet, operation("get_shop_characters", tagCharacters, "Get the characters in the shop.").
+		params(param("NpcId")).
+		ok(collection("Character")))
+	ps.add("/npcs/{npcId}/shop/characters", http.MethodDelete, operation("exit_shop_characters", tagCharacters, "Force every character out of the shop, emitting an EXITED status event for each.").
+		params(param("NpcId")).
+		status(http.StatusNoContent, "Removed."))
+	ps.add("/npcs/{npcId}/shop/characters/{characterId}", http.MethodDelete, operation("exit_shop_character", tagCharacters, "Force a character out of the shop, emitting an EXITED status event.").
+		params(param("NpcId"), param("CharacterId")).
+		status(http.StatusNoContent, "Removed.").
+		status(http.StatusNotFound, "The character is not in the shop."))
+	ps.add("/npcs/{npcId}/shop/characters/{characterId}/commodities", http.MethodGet, operation("get_shop_character_commodities", tagCharacters, "Get the commodities of the shop as seen by a character.").
+		params(param("NpcId"), param("CharacterId")).
+		ok(collection("CharacterCommodity")).
+		status(http.StatusNotFound, "The NPC has no shop."))
+
+	ps.add("/npcs/{npcId}/shop/relationships/commodities", http.MethodPost, operation("add_commodity", tagCommodities, "Add a commodity to the shop.").
+		params(param("NpcId")).
+		body(JsonApiMediaType, single("Commodity")).
+		respond(http.StatusCreated, "Created.", JsonApiMediaType, single("Commodity")).
+		errors(http.StatusUnprocessableEntity, "The commodity is invalid.").
+		conditional())
+	ps.add("/npcs/{npcId}/shop/relationships/commodities", http.MethodDelete, operation("delete_all_commodities", tagCommodities, "Remove every commodity of the shop.").
+		params(param("NpcId")).
+		status(http.StatusNoContent, "Removed.").
+		conditional())
+	ps.add("/npcs/{npcId}/shop/relationships/commodities/{commodityId}", http.MethodPut, operation("update_commodity", tagCommodities, "Update a commodity of the shop.").
+		params(param("NpcId"), param("CommodityId")).
+		body(JsonApiMediaType, single("Commodity")).
+		ok(single("Commodity")).
+		errors(http.StatusUnprocessableEntity, "The commodity is invalid.").
+		conditional())
+	ps.add("/npcs/{npcId}/shop/relationships/commodities/{commodityId}", http.MethodDelete, operation("remove_commodity", tagCommodities, "Remove a commodity from the shop.").
+		params(param("NpcId"), param("CommodityId")).
+		status(http.StatusNoContent, "Removed.").
+		status(http.StatusNotFound, "The shop has no such commodity.").
+		conditional())
+}
+
+func templatePaths(ps paths) {
+	ps.add("/shop-templates", http.MethodGet, operation("get_shop_templates", tagTemplates, "Get all shop templates of the tenant.").
+		ok(collection("ShopTemplate", "Commodity")))
+	ps.add("/shop-templates", http.MethodPost, operation("create_shop_template", tagTemplates, "Create a shop template with its commodities.").
+		body(JsonApiMediaType, single("ShopTemplate", "Commodity")).
+		respond(http.StatusCreated, "Created.", JsonApiMediaType, single("ShopTemplate", "Commodity")).
+		status(http.StatusBadRequest, "The document is invalid.").
+		errors(http.StatusUnprocessableEntity, "A commodity is invalid."))
+	ps.add("/shop-templates/{shopTemplateId}", http.MethodGet, operation("get_shop_template", tagTemplates, "Get a shop template.").
+		params(param("ShopTemplateId")).
+		ok(single("ShopTemplate", "Commodity")).
+		status(http.StatusNotFound, "No template has the id."))
+	ps.add("/shop-templates/{shopTemplateId}", http.MethodPut, operation("update_shop_template", tagTemplates, "Replace a shop template and its commodities.").
+		params(param("ShopTemplateId")).
+		body(JsonApiMediaType, single("ShopTemplate", "Commodity")).
+		ok(single("ShopTemplate", "Commodity")).
+		status(http.StatusBadRequest, "The document is invalid.").
+		status(http.StatusNotFound, "No template has the id.").
+		errors(http.StatusUnprocessableEntity, "A commodity is invalid."))
+	ps.add("/shop-templates/{shopTemplateId}", http.MethodDelete, operation("delete_shop_template", tagTemplates, "Delete a shop template.").
+		params(param("ShopTemplateId")).
+		status(http.StatusNoContent, "Deleted.").
+		status(http.StatusNotFound, "No template has the id.").
+		status(http.StatusConflict, "Shops still inherit from the template."))
+}
+
+func catalogPaths(ps paths) {
+	ps.add("/shops/export", http.MethodGet, operation("export_shops", tagCatalog, "Export every shop of the tenant with its commodities.").
+		params(query("format", enum("Defaults to jsonapi.", "jsonapi", "csv"))).
+		ok(collection("Shop", "Commodity")).
+		respond(http.StatusOK, "OK.", CsvMediaType, str("One row per commodity.")).
+		status(http.StatusBadRequest, "The format is not supported."))
+	ps.add("/shops/clone", http.MethodPost, operation("clone_shops", tagCatalog, "Copy the shops of another tenant into the tenant.").
+		body(JsonApiMediaType, single("ShopClone")).
+		ok(single("ShopImport")).
+		status(http.StatusBadRequest, "The document is invalid.").
+		respond(http.StatusUnprocessableEntity, "Some shops could not be copied.", JsonApiMediaType, single("ShopImport")))
+	ps.add("/shops/import", http.MethodPost, operation("import_shops", tagCatalog, "Import a catalog of shops into the tenant.").
+		params(query("format", enum("Defaults to the Content-Type, then jsonapi.", "jsonapi", "csv", "emulator"))).
+		body(JsonApiMediaType, collection("Shop", "Commodity")).
+		body(CsvMediaType, str("One row per commodity.")).
+		ok(single("ShopImport")).
+		status(http.StatusBadRequest, "The catalog or format is invalid.").
+		respond(http.StatusUnprocessableEntity, "Some rows could not be imported.", JsonApiMediaType, single("ShopImport")))
+}
+
+func auditPaths(ps paths) {
+	ps.add("/shops/audit", http.MethodGet, operation("get_shop_audit", tagAudit, "Get the changes made to shops, commodities and shop templates, newest first.").
+		params(
+			query("npcId", integer("")),
+			query("commodityId", id("")),
+			query("actor", str("")),
+			query("from", dateTime("RFC 3339 time.")),
+			query("to", dateTime("RFC 3339 time.")),
+		).
+		ok(collection("ShopAudit")).
+		status(http.StatusBadRequest, "A filter is invalid."))
+}
+
+func analyticsPaths(ps paths) {
+	filters := []Parameter{
+		query("npcId", integer("")),
+		query("templateId", integer("")),
+		query("from", dateTime("RFC 3339 time.")),
+		query("to", dateTime("RFC 3339 time.")),
+	}
+	aggregate := func(operationId string, summary string, extra ...Parameter) *operationBuilder {
+		return operation(operationId, tagAnalytics, summary).
+			params(filters...).
+			params(extra...).
+			ok(collection("ShopEconomy")).
+			status(http.StatusBadRequest, "A filter is invalid.")
+	}
+	ps.add("/shops/analytics/shops", http.MethodGet, aggregate("get_shop_analytics_by_shop", "Get shop transaction totals per shop."))
+	ps.add("/shops/analytics/items", http.MethodGet, aggregate("get_shop_analytics_by_item", "Get shop transaction totals per item."))
+	ps.add("/shops/analytics/items/top", http.MethodGet, aggregate("get_shop_analytics_top_items", "Get the items with the highest transaction totals.",
+		query("metric", enum("Defaults to mesoSunk.", "mesoSunk", "mesoPaid", "tokensConsumed", "quantity", "uniqueBuyers", "transactions")),
+		query("limit", integer("Between 1 and 100. Defaults to 10.")),
+	))
+	ps.add("/shops/analytics/days", http.MethodGet, aggregate("get_shop_analytics_by_day", "Get shop transaction totals per day."))
+}
@@ -0,0 +1,21 @@
+package rest
+
+import (
+	"context"
+)
+
+// ActorHeader names the header identifying who is making a request, recorded against the changes it makes.
+const ActorHeader = "ACTOR_ID"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the actor making a request.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by the context, if any.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// ErrorObject is a JSON:API error object.
+type ErrorObject struct {
+	Status string       `json:"status"`
+	Code   string       `json:"code,omitempty"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail,omitempty"`
+	Source *ErrorSource `json:"source,omitempty"`
+}
+
+// ErrorSource locates the part of the request an ErrorObject is about.
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// WriteErrors responds with a JSON:API error document.
+func WriteErrors(l logrus.FieldLogger, w http.ResponseWriter, status int, errs []ErrorObject) {
+	for i := range errs {
+		errs[i].Status = strconv.Itoa(status)
+	}
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(struct {
+		Errors []ErrorObject `json:"errors"`
+	}{Errors: errs})
+	if err != nil {
+		l.WithError(err).Errorf("Writing error response.")
+	}
+}
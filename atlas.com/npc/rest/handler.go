@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/Chronicle20/atlas-rest/server"
 	"github.com/gorilla/mux"
@@ -72,7 +73,10 @@ func RegisterHandler(l logrus.FieldLogger) func(db *gorm.DB) func(si jsonapi.Ser
 				return server.RetrieveSpan(l, handlerName, context.Background(), func(sl logrus.FieldLogger, sctx context.Context) http.HandlerFunc {
 					fl := sl.WithFields(logrus.Fields{"originator": handlerName, "type": "rest_handler"})
 					return server.ParseTenant(fl, sctx, func(tl logrus.FieldLogger, tctx context.Context) http.HandlerFunc {
-						return handler(&HandlerDependency{l: tl, db: db, ctx: tctx}, &HandlerContext{si: si})
+						return func(w http.ResponseWriter, r *http.Request) {
+							actx := WithActor(tctx, r.Header.Get(ActorHeader))
+							handler(&HandlerDependency{l: tl, db: db, ctx: actx}, &HandlerContext{si: si})(w, r)
+						}
 					})
 				})
 			}
@@ -87,7 +91,10 @@ func RegisterInputHandler[M any](l logrus.FieldLogger) func(db *gorm.DB) func(si
 				return server.RetrieveSpan(l, handlerName, context.Background(), func(sl logrus.FieldLogger, sctx context.Context) http.HandlerFunc {
 					fl := sl.WithFields(logrus.Fields{"originator": handlerName, "type": "rest_handler"})
 					return server.ParseTenant(fl, sctx, func(tl logrus.FieldLogger, tctx context.Context) http.HandlerFunc {
-						return ParseInput[M](&HandlerDependency{l: tl, db: db, ctx: tctx}, &HandlerContext{si: si}, handler)
+						return func(w http.ResponseWriter, r *http.Request) {
+							actx := WithActor(tctx, r.Header.Get(ActorHeader))
+							ParseInput[M](&HandlerDependency{l: tl, db: db, ctx: actx}, &HandlerContext{si: si}, handler)(w, r)
+						}
 					})
 				})
 			}
@@ -124,3 +131,95 @@ func ParseCommodityId(l logrus.FieldLogger, next CommodityIdHandler) http.Handle
 		next(commodityId)(w, r)
 	}
 }
+
+type CharacterIdHandler func(characterId uint32) http.HandlerFunc
+
+func ParseCharacterId(l logrus.FieldLogger, next CharacterIdHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		characterId, err := strconv.Atoi(vars["characterId"])
+		if err != nil {
+			l.WithError(err).Errorf("Error parsing characterId as uint32")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(uint32(characterId))(w, r)
+	}
+}
+
+type ShopIdHandler func(shopId uuid.UUID) http.HandlerFunc
+
+func ParseShopId(l logrus.FieldLogger, next ShopIdHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		shopId, err := uuid.Parse(vars["shopId"])
+		if err != nil {
+			l.WithError(err).Errorf("Error parsing shopId as uuid")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(shopId)(w, r)
+	}
+}
+
+type ShopTemplateIdHandler func(shopTemplateId uuid.UUID) http.HandlerFunc
+
+func ParseShopTemplateId(l logrus.FieldLogger, next ShopTemplateIdHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		shopTemplateId, err := uuid.Parse(vars["shopTemplateId"])
+		if err != nil {
+			l.WithError(err).Errorf("Error parsing shopTemplateId as uuid")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(shopTemplateId)(w, r)
+	}
+}
+
+type TemplateIdHandler func(templateId uint32) http.HandlerFunc
+
+func ParseTemplateId(l logrus.FieldLogger, next TemplateIdHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		templateId, err := strconv.ParseUint(vars["templateId"], 10, 32)
+		if err != nil {
+			l.WithError(err).Errorf("Error parsing templateId as uint32")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next(uint32(templateId))(w, r)
+	}
+}
+
+type VersionHandler func(version uint32) http.HandlerFunc
+
+// ParseIfMatch parses the version a write is conditional on from the If-Match header. A wildcard parses as version 0,
+// which applies the write unconditionally. Requests without the header are refused, as are entity tags which are not a
+// version, since they can never match.
+func ParseIfMatch(l logrus.FieldLogger, next VersionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.TrimSpace(r.Header.Get("If-Match"))
+		if tag == "" {
+			l.Errorf("Refusing write without an If-Match header.")
+			w.WriteHeader(http.StatusPreconditionRequired)
+			return
+		}
+		if tag == "*" {
+			next(0)(w, r)
+			return
+		}
+		version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(tag, "W/"), `"`), 10, 32)
+		if err != nil || version == 0 {
+			l.Errorf("Error parsing If-Match [%s] as a version.", tag)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		next(uint32(version))(w, r)
+	}
+}
+
+// ETag formats a version as an entity tag.
+func ETag(version uint32) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
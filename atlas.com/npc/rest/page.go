@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Page locates a page of a collection among every matching resource.
+type Page struct {
+	Number int
+	Size   int
+	Total  int64
+}
+
+// last returns the number of the last page, which is 1 for an empty collection.
+func (p Page) last() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return int((p.Total + int64(p.Size) - 1) / int64(p.Size))
+}
+
+// WritePage responds with a JSON:API document holding a page of a collection. The total number of matching resources is
+// reported in the document meta, and its self, first, last, prev and next links repeat the request with page[number]
+// and page[size] replaced.
+func WritePage(l logrus.FieldLogger, w http.ResponseWriter, si jsonapi.ServerInformation, u *url.URL, page Page, data interface{}) {
+	doc, err := jsonapi.MarshalToStruct(data, si)
+	if err != nil {
+		l.WithError(err).Errorf("Creating page document.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	doc.Meta = map[string]interface{}{
+		"total": page.Total,
+		"page": map[string]int{
+			"number": page.Number,
+			"size":   page.Size,
+			"last":   page.last(),
+		},
+	}
+	doc.Links = jsonapi.Links{
+		"self":  jsonapi.Link{Href: pageLink(si, u, page.Number, page.Size)},
+		"first": jsonapi.Link{Href: pageLink(si, u, 1, page.Size)},
+		"last":  jsonapi.Link{Href: pageLink(si, u, page.last(), page.Size)},
+	}
+	if page.Number > 1 {
+		doc.Links["prev"] = jsonapi.Link{Href: pageLink(si, u, min(page.Number-1, page.last()), page.Size)}
+	}
+	if page.Number < page.last() {
+		doc.Links["next"] = jsonapi.Link{Href: pageLink(si, u, page.Number+1, page.Size)}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(doc)
+	if err != nil {
+		l.WithError(err).Errorf("Writing page response.")
+	}
+}
+
+func pageLink(si jsonapi.ServerInformation, u *url.URL, number int, size int) string {
+	query := u.Query()
+	query.Set("page[number]", strconv.Itoa(number))
+	query.Set("page[size]", strconv.Itoa(size))
+	return si.GetBaseURL() + u.Path + "?" + query.Encode()
+}
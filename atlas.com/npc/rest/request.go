@@ -1,16 +1,36 @@
 package rest
 
 import (
+	"atlas-npc/metrics"
 	"context"
 	"github.com/Chronicle20/atlas-rest/requests"
 	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
 )
 
+// dependencies are the services requested, named by their root url.
+var dependencies = []string{"DATA", "CHARACTERS", "INVENTORY", "QUESTS", "SKILLS"}
+
+// dependencyOf names the service a url belongs to.
+func dependencyOf(url string) string {
+	for _, d := range dependencies {
+		if root := requests.RootUrl(d); root != "" && strings.HasPrefix(url, root) {
+			return strings.ToLower(d)
+		}
+	}
+	return "other"
+}
+
 func MakeGetRequest[A any](url string) requests.Request[A] {
 	return func(l logrus.FieldLogger, ctx context.Context) (A, error) {
 		sd := requests.AddHeaderDecorator(requests.SpanHeaderDecorator(ctx))
 		td := requests.AddHeaderDecorator(requests.TenantHeaderDecorator(ctx))
-		return requests.MakeGetRequest[A](url, sd, td)(l, ctx)
+		start := time.Now()
+		a, err := requests.MakeGetRequest[A](url, sd, td)(l, ctx)
+		metrics.Request(dependencyOf(url), http.MethodGet, err, time.Since(start))
+		return a, err
 	}
 }
 
@@ -18,7 +38,10 @@ func MakePostRequest[A any](url string, i interface{}) requests.Request[A] {
 	return func(l logrus.FieldLogger, ctx context.Context) (A, error) {
 		sd := requests.AddHeaderDecorator(requests.SpanHeaderDecorator(ctx))
 		td := requests.AddHeaderDecorator(requests.TenantHeaderDecorator(ctx))
-		return requests.MakePostRequest[A](url, i, sd, td)(l, ctx)
+		start := time.Now()
+		a, err := requests.MakePostRequest[A](url, i, sd, td)(l, ctx)
+		metrics.Request(dependencyOf(url), http.MethodPost, err, time.Since(start))
+		return a, err
 	}
 }
 
@@ -26,7 +49,10 @@ func MakePatchRequest[A any](url string, i interface{}) requests.Request[A] {
 	return func(l logrus.FieldLogger, ctx context.Context) (A, error) {
 		sd := requests.AddHeaderDecorator(requests.SpanHeaderDecorator(ctx))
 		td := requests.AddHeaderDecorator(requests.TenantHeaderDecorator(ctx))
-		return requests.MakePatchRequest[A](url, i, sd, td)(l, ctx)
+		start := time.Now()
+		a, err := requests.MakePatchRequest[A](url, i, sd, td)(l, ctx)
+		metrics.Request(dependencyOf(url), http.MethodPatch, err, time.Since(start))
+		return a, err
 	}
 }
 
@@ -34,6 +60,9 @@ func MakeDeleteRequest(url string) requests.EmptyBodyRequest {
 	return func(l logrus.FieldLogger, ctx context.Context) error {
 		sd := requests.AddHeaderDecorator(requests.SpanHeaderDecorator(ctx))
 		td := requests.AddHeaderDecorator(requests.TenantHeaderDecorator(ctx))
-		return requests.MakeDeleteRequest(url, sd, td)(l, ctx)
+		start := time.Now()
+		err := requests.MakeDeleteRequest(url, sd, td)(l, ctx)
+		metrics.Request(dependencyOf(url), http.MethodDelete, err, time.Since(start))
+		return err
 	}
 }
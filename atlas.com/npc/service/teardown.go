@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
@@ -14,6 +15,7 @@ type Manager struct {
 	waitGroup *sync.WaitGroup
 	context   context.Context
 	cancel    context.CancelFunc
+	stopping  atomic.Bool
 }
 
 var manager *Manager
@@ -47,11 +49,17 @@ func (m *Manager) TeardownFunc(f func()) {
 
 func (m *Manager) Wait() {
 	<-m.termChan
+	m.stopping.Store(true)
 	close(m.doneChan)
 	m.cancel()
 	m.waitGroup.Wait()
 }
 
+// Stopping reports whether the service has been asked to terminate and is tearing down.
+func (m *Manager) Stopping() bool {
+	return m.stopping.Load()
+}
+
 func (m *Manager) WaitGroup() *sync.WaitGroup {
 	return m.waitGroup
 }
@@ -0,0 +1,139 @@
+package shops
+
+import (
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// activityBuffer is how many activities a slow subscriber may fall behind before further activities are dropped for it.
+const activityBuffer = 64
+
+// Activity is the outcome of a character's command at a shop.
+type Activity struct {
+	npcId       uint32
+	characterId uint32
+	operation   string
+	outcome     string
+	code        string
+	templateId  uint32
+	quantity    uint32
+	occurredAt  time.Time
+}
+
+// NewActivity creates the activity of a character's command at a shop, before its outcome is known.
+func NewActivity(npcId uint32, characterId uint32, operation string) Activity {
+	return Activity{npcId: npcId, characterId: characterId, operation: operation}
+}
+
+// NpcId returns the NPC of the shop
+func (a Activity) NpcId() uint32 {
+	return a.npcId
+}
+
+// CharacterId returns the character who issued the command
+func (a Activity) CharacterId() uint32 {
+	return a.characterId
+}
+
+// Operation returns the command issued, one of the Operation constants
+func (a Activity) Operation() string {
+	return a.operation
+}
+
+// Outcome returns whether the command succeeded, was rejected or failed
+func (a Activity) Outcome() string {
+	return a.outcome
+}
+
+// Code returns the error code sent to the character
+func (a Activity) Code() string {
+	return a.code
+}
+
+// TemplateId returns the item bought or sold, or 0 for other operations
+func (a Activity) TemplateId() uint32 {
+	return a.templateId
+}
+
+// Quantity returns the number of items bought or sold, or 0 for other operations
+func (a Activity) Quantity() uint32 {
+	return a.quantity
+}
+
+// OccurredAt returns when the command was handled
+func (a Activity) OccurredAt() time.Time {
+	return a.occurredAt
+}
+
+// ActivityHub fans the activity of shops out to their subscribers within this process.
+type ActivityHub struct {
+	mutex       sync.RWMutex
+	subscribers map[uuid.UUID]map[uint32]map[chan Activity]struct{}
+}
+
+var activityHub *ActivityHub
+var activityOnce sync.Once
+
+// NewActivityHub creates an ActivityHub without subscribers.
+func NewActivityHub() *ActivityHub {
+	return &ActivityHub{
+		subscribers: make(map[uuid.UUID]map[uint32]map[chan Activity]struct{}),
+	}
+}
+
+func getActivityHub() *ActivityHub {
+	activityOnce.Do(func() {
+		activityHub = NewActivityHub()
+	})
+	return activityHub
+}
+
+// Subscribe returns the activity of a shop as it happens, and a function which ends the subscription.
+func (h *ActivityHub) Subscribe(tenantId uuid.UUID, npcId uint32) (<-chan Activity, func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[tenantId]; !ok {
+		h.subscribers[tenantId] = make(map[uint32]map[chan Activity]struct{})
+	}
+	if _, ok := h.subscribers[tenantId][npcId]; !ok {
+		h.subscribers[tenantId][npcId] = make(map[chan Activity]struct{})
+	}
+	ch := make(chan Activity, activityBuffer)
+	h.subscribers[tenantId][npcId][ch] = struct{}{}
+
+	return ch, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		delete(h.subscribers[tenantId][npcId], ch)
+		if len(h.subscribers[tenantId][npcId]) == 0 {
+			delete(h.subscribers[tenantId], npcId)
+		}
+		if len(h.subscribers[tenantId]) == 0 {
+			delete(h.subscribers, tenantId)
+		}
+	}
+}
+
+// Subscribers returns how many subscribers follow the activity of a shop.
+func (h *ActivityHub) Subscribers(tenantId uuid.UUID, npcId uint32) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.subscribers[tenantId][npcId])
+}
+
+// Publish sends an activity to the subscribers of its shop. Subscribers which have fallen behind miss it, rather than
+// hold up the command.
+func (h *ActivityHub) Publish(tenantId uuid.UUID, a Activity) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for ch := range h.subscribers[tenantId][a.npcId] {
+		select {
+		case ch <- a:
+		default:
+		}
+	}
+}
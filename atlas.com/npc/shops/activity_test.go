@@ -0,0 +1,74 @@
+package shops_test
+
+import (
+	"atlas-npc/shops"
+	"atlas-npc/test"
+	"testing"
+)
+
+func TestActivityHub(t *testing.T) {
+	h := shops.NewActivityHub()
+	ten := test.CreateDefaultMockTenant()
+	other := test.CreateDefaultMockTenant()
+
+	first, unsubscribeFirst := h.Subscribe(ten.Id(), 9000)
+	second, unsubscribeSecond := h.Subscribe(ten.Id(), 9000)
+	elsewhere, unsubscribeElsewhere := h.Subscribe(ten.Id(), 9001)
+	otherTenant, unsubscribeOtherTenant := h.Subscribe(other.Id(), 9000)
+	defer unsubscribeElsewhere()
+	defer unsubscribeOtherTenant()
+
+	if n := h.Subscribers(ten.Id(), 9000); n != 2 {
+		t.Errorf("Expected 2 subscribers to shop [9000], got %d.", n)
+	}
+
+	// Every subscriber to the shop receives its activity, and only its activity
+	h.Publish(ten.Id(), shops.NewActivity(9000, 1, shops.OperationEnter))
+	for name, ch := range map[string]<-chan shops.Activity{"first": first, "second": second} {
+		select {
+		case a := <-ch:
+			if a.NpcId() != 9000 || a.CharacterId() != 1 || a.Operation() != shops.OperationEnter {
+				t.Errorf("Expected %s subscriber to receive enter of character [1] at shop [9000], got %+v.", name, a)
+			}
+		default:
+			t.Errorf("Expected %s subscriber to receive the activity.", name)
+		}
+	}
+	if len(elsewhere) != 0 {
+		t.Errorf("Expected subscriber to another shop to receive nothing, got %d activities.", len(elsewhere))
+	}
+	if len(otherTenant) != 0 {
+		t.Errorf("Expected subscriber of another tenant to receive nothing, got %d activities.", len(otherTenant))
+	}
+
+	// A subscriber which has unsubscribed receives nothing further
+	unsubscribeFirst()
+	if n := h.Subscribers(ten.Id(), 9000); n != 1 {
+		t.Errorf("Expected 1 subscriber to shop [9000] after unsubscribing, got %d.", n)
+	}
+	h.Publish(ten.Id(), shops.NewActivity(9000, 2, shops.OperationExit))
+	if len(first) != 0 {
+		t.Errorf("Expected unsubscribed subscriber to receive nothing, got %d activities.", len(first))
+	}
+	if a := <-second; a.CharacterId() != 2 {
+		t.Errorf("Expected remaining subscriber to receive exit of character [2], got %+v.", a)
+	}
+
+	// A subscriber which falls behind misses activity, rather than holding up the publisher
+	for c := uint32(0); c < 100; c++ {
+		h.Publish(ten.Id(), shops.NewActivity(9000, c, shops.OperationBuy))
+	}
+	if n := len(second); n != cap(second) {
+		t.Errorf("Expected a full buffer of %d activities, got %d.", cap(second), n)
+	}
+	if a := <-second; a.CharacterId() != 0 {
+		t.Errorf("Expected the oldest activity to be kept, got character [%d].", a.CharacterId())
+	}
+
+	// The last subscriber to leave removes the shop
+	unsubscribeSecond()
+	if n := h.Subscribers(ten.Id(), 9000); n != 0 {
+		t.Errorf("Expected no subscribers to shop [9000], got %d.", n)
+	}
+	h.Publish(ten.Id(), shops.NewActivity(9000, 3, shops.OperationEnter))
+}
@@ -5,16 +5,26 @@ import (
 	"github.com/Chronicle20/atlas-model/model"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
 // createShop returns a provider that creates a shop entity
-func createShop(tenantId uuid.UUID, npcId uint32, recharger bool) database.EntityProvider[Entity] {
+func createShop(tenantId uuid.UUID, m Model) database.EntityProvider[Entity] {
 	return func(db *gorm.DB) model.Provider[Entity] {
 		entity := Entity{
-			Id:        uuid.New(),
-			TenantId:  tenantId,
-			NpcId:     npcId,
-			Recharger: recharger,
+			Id:             uuid.New(),
+			TenantId:       tenantId,
+			NpcId:          m.NpcId(),
+			Recharger:      m.Recharger(),
+			Name:           m.Name(),
+			Description:    m.Description(),
+			OpensAt:        m.OpensAt(),
+			ClosesAt:       m.ClosesAt(),
+			TimeZone:       m.TimeZone(),
+			Enabled:        m.Enabled(),
+			ShopTemplateId: m.ShopTemplateId(),
+			ExcludedItems:  m.ExcludedItems(),
+			Version:        1,
 		}
 		err := db.Create(&entity).Error
 		if err != nil {
@@ -25,18 +35,26 @@ func createShop(tenantId uuid.UUID, npcId uint32, recharger bool) database.Entit
 }
 
 // updateShop returns a provider that updates a shop entity
-func updateShop(tenantId uuid.UUID, npcId uint32, recharger bool) database.EntityProvider[Entity] {
+func updateShop(tenantId uuid.UUID, m Model) database.EntityProvider[Entity] {
 	return func(db *gorm.DB) model.Provider[Entity] {
 		var entity Entity
-		err := db.Where(&Entity{TenantId: tenantId, NpcId: npcId}).First(&entity).Error
+		err := db.Where(&Entity{TenantId: tenantId, NpcId: m.NpcId()}).First(&entity).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return createShop(tenantId, npcId, recharger)(db)
+				return createShop(tenantId, m)(db)
 			}
 			return model.ErrorProvider[Entity](err)
 		}
 
-		entity.Recharger = recharger
+		entity.Recharger = m.Recharger()
+		entity.Name = m.Name()
+		entity.Description = m.Description()
+		entity.OpensAt = m.OpensAt()
+		entity.ClosesAt = m.ClosesAt()
+		entity.TimeZone = m.TimeZone()
+		entity.Enabled = m.Enabled()
+		entity.ShopTemplateId = m.ShopTemplateId()
+		entity.ExcludedItems = m.ExcludedItems()
 		err = db.Save(&entity).Error
 		if err != nil {
 			return model.ErrorProvider[Entity](err)
@@ -45,6 +63,22 @@ func updateShop(tenantId uuid.UUID, npcId uint32, recharger bool) database.Entit
 	}
 }
 
+// bumpVersion returns a provider that advances the version of the shop for an NPC. When expected is non-zero the shop
+// is only advanced from that version, and false is returned if the shop is at another version or does not exist.
+func bumpVersion(tenantId uuid.UUID, npcId uint32, expected uint32) database.EntityProvider[bool] {
+	return func(db *gorm.DB) model.Provider[bool] {
+		q := db.Model(&Entity{}).Where("tenant_id = ? AND npc_id = ?", tenantId, npcId)
+		if expected != 0 {
+			q = q.Where("version = ?", expected)
+		}
+		result := q.Update("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return model.ErrorProvider[bool](result.Error)
+		}
+		return model.FixedProvider(expected == 0 || result.RowsAffected > 0)
+	}
+}
+
 // deleteAllShops returns a provider that deletes all shop entities for a tenant
 func deleteAllShops(tenantId uuid.UUID) database.EntityProvider[bool] {
 	return func(db *gorm.DB) model.Provider[bool] {
@@ -55,3 +89,50 @@ func deleteAllShops(tenantId uuid.UUID) database.EntityProvider[bool] {
 		return model.FixedProvider(true)
 	}
 }
+
+// restoreShop returns a provider that clears the deletion of a shop entity
+func restoreShop(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[bool] {
+	return func(db *gorm.DB) model.Provider[bool] {
+		err := db.Unscoped().Model(&Entity{}).
+			Where("tenant_id = ? AND id = ?", tenantId, id).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		return model.FixedProvider(true)
+	}
+}
+
+// restoreShopsAsOf returns a provider that returns a tenant's shops to how they were at the given time, by deleting
+// those created since and restoring those deleted since. Only the latest shop of an NPC is restored, so the NPC is left
+// with a single shop.
+func restoreShopsAsOf(tenantId uuid.UUID, asOf time.Time) database.EntityProvider[bool] {
+	return func(db *gorm.DB) model.Provider[bool] {
+		err := db.Where("tenant_id = ? AND created_at > ?", tenantId, asOf).Delete(&Entity{}).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		err = db.Unscoped().Model(&Entity{}).
+			Where("tenant_id = ? AND deleted_at > ? AND created_at <= ?", tenantId, asOf, asOf).
+			Where("NOT EXISTS (SELECT 1 FROM shops later WHERE later.tenant_id = shops.tenant_id AND later.npc_id = shops.npc_id AND later.id <> shops.id "+
+				"AND (later.deleted_at IS NULL OR (later.deleted_at > ? AND later.created_at <= ? AND later.created_at > shops.created_at)))", asOf, asOf).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		return model.FixedProvider(true)
+	}
+}
+
+// purgeDeletedShops returns a provider that permanently removes shop entities deleted before the given time
+func purgeDeletedShops(tenantId uuid.UUID, before time.Time) database.EntityProvider[int64] {
+	return func(db *gorm.DB) model.Provider[int64] {
+		result := db.Unscoped().
+			Where("tenant_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", tenantId, before).
+			Delete(&Entity{})
+		if result.Error != nil {
+			return model.ErrorProvider[int64](result.Error)
+		}
+		return model.FixedProvider(result.RowsAffected)
+	}
+}
@@ -0,0 +1,161 @@
+package shops
+
+import (
+	"atlas-npc/data/consumable"
+	"atlas-npc/data/equipable"
+	"atlas-npc/data/etc"
+	"atlas-npc/data/setup"
+	"errors"
+	"github.com/Chronicle20/atlas-constants/inventory"
+	"github.com/Chronicle20/atlas-constants/item"
+	"github.com/google/uuid"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// EnvBlockArbitrage, when true, rejects commodities sold for less meso than the shop pays for the item.
+const EnvBlockArbitrage = "SHOP_BLOCK_ARBITRAGE"
+
+var ErrArbitrage = errors.New("commodity sells for less than its sell price")
+
+func blockArbitrage() bool {
+	block, _ := strconv.ParseBool(os.Getenv(EnvBlockArbitrage))
+	return block
+}
+
+// Arbitrage is a commodity which can be bought and sold back to a shop for a profit.
+type Arbitrage struct {
+	npcId              uint32
+	commodityId        uuid.UUID
+	templateId         uint32
+	inherited          bool
+	effectiveMesoPrice uint32
+	sellPrice          uint32
+}
+
+// NpcId returns the NPC of the shop selling the commodity
+func (a Arbitrage) NpcId() uint32 {
+	return a.npcId
+}
+
+// CommodityId returns the commodity, which belongs to the shop template when inherited
+func (a Arbitrage) CommodityId() uuid.UUID {
+	return a.commodityId
+}
+
+// TemplateId returns the item sold
+func (a Arbitrage) TemplateId() uint32 {
+	return a.templateId
+}
+
+// Inherited returns whether the commodity comes from the shop's template
+func (a Arbitrage) Inherited() bool {
+	return a.inherited
+}
+
+// EffectiveMesoPrice returns the meso paid for one unit of the commodity
+func (a Arbitrage) EffectiveMesoPrice() uint32 {
+	return a.effectiveMesoPrice
+}
+
+// SellPrice returns the meso a shop pays for one unit of the item
+func (a Arbitrage) SellPrice() uint32 {
+	return a.sellPrice
+}
+
+// Profit returns the meso made by buying and selling back one unit
+func (a Arbitrage) Profit() uint32 {
+	return a.sellPrice - a.effectiveMesoPrice
+}
+
+// sellPrice returns the meso a shop pays for one unit of the item, from its item data. Items without sell data, such as
+// cash items, are worth nothing.
+func (p *ProcessorImpl) sellPrice(templateId uint32) (uint32, error) {
+	if p.SellPriceFn != nil {
+		return p.SellPriceFn(templateId)
+	}
+
+	it, ok := inventory.TypeFromItemId(item.Id(templateId))
+	if !ok {
+		return 0, nil
+	}
+	switch it {
+	case inventory.TypeValueEquip:
+		em, err := equipable.NewProcessor(p.l, p.ctx).GetById(templateId)
+		if err != nil {
+			return 0, err
+		}
+		return em.Price(), nil
+	case inventory.TypeValueUse:
+		cm, err := consumable.NewProcessor(p.l, p.ctx).GetById(templateId)
+		if err != nil {
+			return 0, err
+		}
+		return cm.Price(), nil
+	case inventory.TypeValueSetup:
+		sm, err := setup.NewProcessor(p.l, p.ctx).GetById(templateId)
+		if err != nil {
+			return 0, err
+		}
+		return sm.Price(), nil
+	case inventory.TypeValueETC:
+		em, err := etc.NewProcessor(p.l, p.ctx).GetById(templateId)
+		if err != nil {
+			return 0, err
+		}
+		return em.Price(), nil
+	}
+	return 0, nil
+}
+
+// GetArbitrage scans the commodities every shop of the tenant sells, including those inherited from shop templates, and
+// returns those sold for less meso than a shop pays for the item, most profitable first. Commodities sold only for
+// tokens are not meso loops, and are skipped.
+func (p *ProcessorImpl) GetArbitrage() ([]Arbitrage, error) {
+	ms, err := p.GetAllShops(p.CommodityDecorator)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[uint32]uint32)
+	results := make([]Arbitrage, 0)
+	for _, m := range ms {
+		for _, c := range m.Commodities() {
+			if c.MesoPrice() == 0 {
+				continue
+			}
+			price, ok := prices[c.TemplateId()]
+			if !ok {
+				price, err = p.sellPrice(c.TemplateId())
+				if err != nil {
+					p.l.WithError(err).Warnf("Unable to get sell price of item [%d] sold by shop [%d].", c.TemplateId(), m.NpcId())
+					continue
+				}
+				prices[c.TemplateId()] = price
+			}
+			if c.EffectiveMesoPrice() >= price {
+				continue
+			}
+			results = append(results, Arbitrage{
+				npcId:              m.NpcId(),
+				commodityId:        c.Id(),
+				templateId:         c.TemplateId(),
+				inherited:          c.Inherited(),
+				effectiveMesoPrice: c.EffectiveMesoPrice(),
+				sellPrice:          price,
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Profit() != results[j].Profit() {
+			return results[i].Profit() > results[j].Profit()
+		}
+		if results[i].npcId != results[j].npcId {
+			return results[i].npcId < results[j].npcId
+		}
+		return results[i].templateId < results[j].templateId
+	})
+	return results, nil
+}
@@ -2,6 +2,7 @@ package shops
 
 import (
 	"atlas-npc/data/consumable"
+	"atlas-npc/metrics"
 	"context"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -41,12 +42,14 @@ func (c *ConsumableCache) GetConsumables(l logrus.FieldLogger, ctx context.Conte
 	c.mutex.RLock()
 	if consumables, ok := c.consumables[tenantId]; ok {
 		c.mutex.RUnlock()
+		metrics.ConsumableCacheHit()
 		// Return a copy of the slice to prevent external modifications
 		result := make([]consumable.Model, len(consumables))
 		copy(result, consumables)
 		return result
 	}
 	c.mutex.RUnlock()
+	metrics.ConsumableCacheMiss()
 
 	// If not in cache, load them from the data service
 	l.Infof("Loading rechargeable consumables for tenant %s", tenantId)
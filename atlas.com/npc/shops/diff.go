@@ -0,0 +1,172 @@
+package shops
+
+import (
+	"atlas-npc/commodities"
+	"github.com/google/uuid"
+	"slices"
+)
+
+// CommodityChange is a commodity whose terms differ between the stored and submitted shop.
+type CommodityChange struct {
+	before commodities.Model
+	after  commodities.Model
+}
+
+// Before returns the stored commodity
+func (c CommodityChange) Before() commodities.Model {
+	return c.before
+}
+
+// After returns the submitted commodity, carrying the id of the stored one
+func (c CommodityChange) After() commodities.Model {
+	return c.after
+}
+
+// Diff describes the changes an update makes to a shop.
+type Diff struct {
+	npcId             uint32
+	created           bool
+	changedAttributes []string
+	added             []commodities.Model
+	updated           []CommodityChange
+	removed           []commodities.Model
+	unchanged         []commodities.Model
+}
+
+// NpcId returns the NPC of the shop
+func (d Diff) NpcId() uint32 {
+	return d.npcId
+}
+
+// Created returns whether the update creates the shop
+func (d Diff) Created() bool {
+	return d.created
+}
+
+// ChangedAttributes returns the names of the shop attributes the update changes
+func (d Diff) ChangedAttributes() []string {
+	return d.changedAttributes
+}
+
+// Added returns the commodities the update inserts
+func (d Diff) Added() []commodities.Model {
+	return d.added
+}
+
+// Updated returns the commodities the update changes in place
+func (d Diff) Updated() []CommodityChange {
+	return d.updated
+}
+
+// Removed returns the commodities the update deletes
+func (d Diff) Removed() []commodities.Model {
+	return d.removed
+}
+
+// Unchanged returns the commodities the update keeps as they are
+func (d Diff) Unchanged() []commodities.Model {
+	return d.unchanged
+}
+
+// Empty returns whether the update changes nothing
+func (d Diff) Empty() bool {
+	return !d.created && len(d.changedAttributes) == 0 && len(d.added) == 0 && len(d.updated) == 0 && len(d.removed) == 0
+}
+
+// diffAttributes names the shop attributes which differ between the stored and submitted shop.
+func diffAttributes(before Model, after Model) []string {
+	changed := make([]string, 0)
+	if before.Recharger() != after.Recharger() {
+		changed = append(changed, "recharger")
+	}
+	if before.Name() != after.Name() {
+		changed = append(changed, "name")
+	}
+	if before.Description() != after.Description() {
+		changed = append(changed, "description")
+	}
+	if before.OpensAt() != after.OpensAt() {
+		changed = append(changed, "opensAt")
+	}
+	if before.ClosesAt() != after.ClosesAt() {
+		changed = append(changed, "closesAt")
+	}
+	if before.TimeZone() != after.TimeZone() {
+		changed = append(changed, "timeZone")
+	}
+	if before.Enabled() != after.Enabled() {
+		changed = append(changed, "enabled")
+	}
+	if before.ShopTemplateId() != after.ShopTemplateId() {
+		changed = append(changed, "shopTemplateId")
+	}
+	if !slices.Equal(before.ExcludedItems(), after.ExcludedItems()) {
+		changed = append(changed, "excludedItems")
+	}
+	return changed
+}
+
+// sameTerms reports whether two commodities would be persisted identically.
+func sameTerms(a commodities.Model, b commodities.Model) bool {
+	return a.TemplateId() == b.TemplateId() &&
+		a.MesoPrice() == b.MesoPrice() &&
+		a.DiscountRate() == b.DiscountRate() &&
+		a.TokenTemplateId() == b.TokenTemplateId() &&
+		a.TokenPrice() == b.TokenPrice() &&
+		a.Period() == b.Period() &&
+		a.LevelLimit() == b.LevelLimit() &&
+		a.JobMask() == b.JobMask() &&
+		a.Gender() == b.Gender() &&
+		a.QuestId() == b.QuestId() &&
+		a.QuestState() == b.QuestState()
+}
+
+// reconcileCommodities matches submitted commodities to stored ones, first by id and then, for submitted commodities
+// without a matching id, by template id. Matched commodities keep their stored id; unmatched submitted commodities are
+// added and unmatched stored commodities removed.
+func reconcileCommodities(diff Diff, existing []commodities.Model, submitted []commodities.Model) Diff {
+	byId := make(map[uuid.UUID]int, len(existing))
+	for i, c := range existing {
+		byId[c.Id()] = i
+	}
+	matched := make([]bool, len(existing))
+	pending := make([]commodities.Model, 0)
+
+	match := func(i int, c commodities.Model) {
+		matched[i] = true
+		stored := existing[i]
+		after := commodities.Clone(c).SetId(stored.Id()).SetNpcId(stored.NpcId()).Build()
+		if sameTerms(stored, after) {
+			diff.unchanged = append(diff.unchanged, stored)
+			return
+		}
+		diff.updated = append(diff.updated, CommodityChange{before: stored, after: after})
+	}
+
+	for _, c := range submitted {
+		if i, ok := byId[c.Id()]; ok && c.Id() != uuid.Nil && !matched[i] {
+			match(i, c)
+			continue
+		}
+		pending = append(pending, c)
+	}
+	for _, c := range pending {
+		found := false
+		for i, ec := range existing {
+			if !matched[i] && ec.TemplateId() == c.TemplateId() {
+				match(i, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff.added = append(diff.added, commodities.Clone(c).SetNpcId(diff.npcId).Build())
+		}
+	}
+	for i, ec := range existing {
+		if !matched[i] {
+			diff.removed = append(diff.removed, ec)
+		}
+	}
+	return diff
+}
@@ -3,15 +3,25 @@ package shops
 import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
 // Entity is the GORM entity for the shops Model
 type Entity struct {
 	gorm.Model
-	Id        uuid.UUID `gorm:"type:uuid;primaryKey"`
-	TenantId  uuid.UUID `gorm:"type:uuid;not null"`
-	NpcId     uint32    `gorm:"not null"`
-	Recharger bool      `gorm:"not null"`
+	Id             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_shops_tenant_npc,where:deleted_at IS NULL"`
+	NpcId          uint32    `gorm:"not null;uniqueIndex:idx_shops_tenant_npc,where:deleted_at IS NULL"`
+	Recharger      bool      `gorm:"not null"`
+	Name           string    `gorm:"not null;default:''"`
+	Description    string    `gorm:"not null;default:''"`
+	OpensAt        string    `gorm:"not null;default:''"`
+	ClosesAt       string    `gorm:"not null;default:''"`
+	TimeZone       string    `gorm:"not null;default:''"`
+	Enabled        bool      `gorm:"not null"`
+	ShopTemplateId uuid.UUID `gorm:"type:uuid;index"`
+	ExcludedItems  []uint32  `gorm:"type:text;serializer:json"`
+	Version        uint32    `gorm:"not null;default:1"`
 }
 
 func (e *Entity) TableName() string {
@@ -22,9 +32,61 @@ func (e *Entity) TableName() string {
 func Make(entity Entity) (Model, error) {
 	return NewBuilder(entity.NpcId).
 		SetRecharger(entity.Recharger).
+		SetName(entity.Name).
+		SetDescription(entity.Description).
+		SetOpensAt(entity.OpensAt).
+		SetClosesAt(entity.ClosesAt).
+		SetTimeZone(entity.TimeZone).
+		SetEnabled(entity.Enabled).
+		SetShopTemplateId(entity.ShopTemplateId).
+		SetExcludedItems(entity.ExcludedItems).
+		SetVersion(entity.Version).
 		Build(), nil
 }
 
+// MakeDeleted converts a soft-deleted Entity to a DeletedModel
+func MakeDeleted(entity Entity) (DeletedModel, error) {
+	m, err := Make(entity)
+	if err != nil {
+		return DeletedModel{}, err
+	}
+	return DeletedModel{
+		id:        entity.Id,
+		shop:      m,
+		deletedAt: entity.DeletedAt.Time,
+	}, nil
+}
+
 func Migration(db *gorm.DB) error {
-	return db.AutoMigrate(&Entity{})
+	if err := deduplicateShops(db); err != nil {
+		return err
+	}
+	if err := addEnabledColumn(db); err != nil {
+		return err
+	}
+	return db.AutoMigrate(&Entity{}, &sessionEntity{})
+}
+
+// deduplicateShops soft deletes all but the latest live shop of each NPC. Shops were not unique per NPC before
+// idx_shops_tenant_npc was added, and the index cannot be created over the duplicates of such a database.
+func deduplicateShops(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Entity{}) || m.HasIndex(&Entity{}, "idx_shops_tenant_npc") {
+		return nil
+	}
+	return db.Model(&Entity{}).
+		Where("EXISTS (SELECT 1 FROM shops later WHERE later.tenant_id = shops.tenant_id AND later.npc_id = shops.npc_id AND later.deleted_at IS NULL "+
+			"AND (later.created_at > shops.created_at OR (later.created_at = shops.created_at AND later.id > shops.id)))").
+		Update("deleted_at", time.Now()).Error
+}
+
+// addEnabledColumn adds the enabled column to a shops table created before shops could be disabled, enabling every
+// existing shop. The entity declares no default for the column, as gorm would write the default in place of false and
+// so create a disabled shop as enabled.
+func addEnabledColumn(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Entity{}) || m.HasColumn(&Entity{}, "enabled") {
+		return nil
+	}
+	return db.Exec("ALTER TABLE shops ADD COLUMN enabled boolean NOT NULL DEFAULT true").Error
 }
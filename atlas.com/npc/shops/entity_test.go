@@ -0,0 +1,84 @@
+package shops_test
+
+import (
+	"atlas-npc/shops"
+	"atlas-npc/test"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// TestMigrationDeduplicatesShops migrates a database created before shops were unique per NPC.
+func TestMigrationDeduplicatesShops(t *testing.T) {
+	db := test.SetupTestDB(t, shops.Migration)
+	defer test.CleanupTestDB(t, db)
+	if err := db.Migrator().DropIndex(&shops.Entity{}, "idx_shops_tenant_npc"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+
+	tenantId := uuid.New()
+	created := time.Now().Add(-time.Hour)
+	older := shops.Entity{Id: uuid.New(), TenantId: tenantId, NpcId: 9000, Name: "Older"}
+	older.CreatedAt = created
+	latest := shops.Entity{Id: uuid.New(), TenantId: tenantId, NpcId: 9000, Name: "Latest"}
+	latest.CreatedAt = created.Add(time.Minute)
+	other := shops.Entity{Id: uuid.New(), TenantId: tenantId, NpcId: 9001, Name: "Other"}
+	other.CreatedAt = created
+	for _, e := range []*shops.Entity{&older, &latest, &other} {
+		if err := db.Create(e).Error; err != nil {
+			t.Fatalf("Failed to create shop: %v", err)
+		}
+	}
+
+	if err := shops.Migration(db); err != nil {
+		t.Fatalf("Failed to migrate shops with duplicates: %v", err)
+	}
+	if !db.Migrator().HasIndex(&shops.Entity{}, "idx_shops_tenant_npc") {
+		t.Errorf("Expected the unique index to be created")
+	}
+
+	var live []shops.Entity
+	if err := db.Where("tenant_id = ?", tenantId).Order("npc_id").Find(&live).Error; err != nil {
+		t.Fatalf("Failed to find shops: %v", err)
+	}
+	if len(live) != 2 || live[0].Id != latest.Id || live[1].Id != other.Id {
+		t.Errorf("Expected the latest shop of each NPC to remain, got %+v", live)
+	}
+}
+
+// TestMigrationEnablesExistingShops migrates a database created before shops could be disabled.
+func TestMigrationEnablesExistingShops(t *testing.T) {
+	db := test.SetupTestDB(t, shops.Migration)
+	defer test.CleanupTestDB(t, db)
+	if err := db.Migrator().DropColumn(&shops.Entity{}, "enabled"); err != nil {
+		t.Fatalf("Failed to drop column: %v", err)
+	}
+	existing := uuid.New()
+	if err := db.Exec("INSERT INTO shops (id, tenant_id, npc_id, recharger, version) VALUES (?, ?, ?, ?, ?)", existing, uuid.New(), 9000, false, 1).Error; err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	if err := shops.Migration(db); err != nil {
+		t.Fatalf("Failed to migrate shops without the enabled column: %v", err)
+	}
+	var e shops.Entity
+	if err := db.Where("id = ?", existing).First(&e).Error; err != nil {
+		t.Fatalf("Failed to find shop: %v", err)
+	}
+	if !e.Enabled {
+		t.Errorf("Expected an existing shop to be enabled")
+	}
+
+	// A disabled shop is written as disabled
+	disabled := shops.Entity{Id: uuid.New(), TenantId: uuid.New(), NpcId: 9001}
+	if err := db.Create(&disabled).Error; err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	var d shops.Entity
+	if err := db.Where("id = ?", disabled.Id).First(&d).Error; err != nil {
+		t.Fatalf("Failed to find shop: %v", err)
+	}
+	if d.Enabled {
+		t.Errorf("Expected a shop created disabled to remain disabled")
+	}
+}
@@ -0,0 +1,43 @@
+package shops
+
+import (
+	"os"
+	"time"
+)
+
+// EnvIdleTimeout is how long a character may stay in a shop without buying, selling or recharging before it is
+// removed, as a Go duration. 0 disables expiry.
+const EnvIdleTimeout = "SHOP_SESSION_IDLE_TIMEOUT"
+
+// DefaultIdleTimeout is used when EnvIdleTimeout is not set or invalid.
+const DefaultIdleTimeout = 30 * time.Minute
+
+func idleTimeout() time.Duration {
+	d, err := time.ParseDuration(os.Getenv(EnvIdleTimeout))
+	if err != nil || d < 0 {
+		return DefaultIdleTimeout
+	}
+	return d
+}
+
+// touch records activity of the character in its shop, postponing its expiry.
+func (p *ProcessorImpl) touch(characterId uint32) {
+	if err := p.registry.Touch(p.t.Id(), characterId); err != nil {
+		p.l.WithError(err).Warnf("Unable to record activity of character [%d] in shop.", characterId)
+	}
+}
+
+// ExpireIdleSessionsAndEmit removes characters of the tenant which have been idle in a shop for longer than the idle
+// timeout, as though they had exited it.
+func (p *ProcessorImpl) ExpireIdleSessionsAndEmit(now time.Time) error {
+	if p.idleTimeout == 0 {
+		return nil
+	}
+	for _, s := range p.registry.GetIdleSessions(p.t.Id(), now.Add(-p.idleTimeout)) {
+		p.l.Infof("Character [%d] has been idle in shop [%d] since [%s]. Expiring session.", s.CharacterId(), s.NpcId(), s.LastActivity())
+		if err := p.ExitAndEmit(s.CharacterId()); err != nil {
+			p.l.WithError(err).Errorf("Unable to expire session of character [%d] in shop [%d].", s.CharacterId(), s.NpcId())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package shops
+
+import (
+	"atlas-npc/kafka/message"
+	"atlas-npc/kafka/message/shops"
+	"atlas-npc/metrics"
+	"encoding/json"
+	"time"
+)
+
+const (
+	OperationEnter    = "enter"
+	OperationExit     = "exit"
+	OperationBuy      = "buy"
+	OperationSell     = "sell"
+	OperationRecharge = "recharge"
+)
+
+// observed counts the outcome of a shop command and publishes it as activity of the shop. A command is rejected when
+// it buffers an error status event for the character, labelled with the event's error code, and failed when it returns
+// an error.
+func (p *ProcessorImpl) observed(a Activity, f func(mb *message.Buffer) error) func(mb *message.Buffer) error {
+	return func(mb *message.Buffer) error {
+		err := f(mb)
+		a.outcome, a.code = metrics.OutcomeSuccess, shops.ErrorOk
+		if err != nil {
+			a.outcome, a.code = metrics.OutcomeFailed, ""
+		} else if code, ok := rejection(mb); ok {
+			a.outcome, a.code = metrics.OutcomeRejected, code
+		}
+		metrics.ShopOperation(a.operation, a.outcome, a.code)
+		if a.npcId != 0 {
+			a.occurredAt = time.Now()
+			getActivityHub().Publish(p.t.Id(), a)
+		}
+		return err
+	}
+}
+
+// rejection returns the error code of the error status event buffered, if any.
+func rejection(mb *message.Buffer) (string, bool) {
+	for _, m := range mb.GetAll()[shops.EnvStatusEventTopic] {
+		var e shops.StatusEvent[shops.StatusEventErrorBody]
+		if err := json.Unmarshal(m.Value, &e); err != nil {
+			continue
+		}
+		if e.Type == shops.StatusEventTypeError {
+			return e.Body.Error, true
+		}
+	}
+	return "", false
+}
+
+// recorded reports an operation which took place but could not be recorded for the economy analytics. The operation is
+// not undone, as the character has already been charged or paid.
+func (p *ProcessorImpl) recorded(operation string, characterId uint32, err error) {
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to record %s of character [%d].", operation, characterId)
+		metrics.TransactionRecordFailure(operation)
+	}
+}
@@ -1,11 +1,25 @@
 package shops
 
-import "atlas-npc/commodities"
+import (
+	"atlas-npc/commodities"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
 
 type Model struct {
-	npcId       uint32
-	commodities []commodities.Model
-	recharger   bool
+	npcId          uint32
+	commodities    []commodities.Model
+	recharger      bool
+	name           string
+	description    string
+	opensAt        string
+	closesAt       string
+	timeZone       string
+	enabled        bool
+	shopTemplateId uuid.UUID
+	excludedItems  []uint32
+	version        uint32
 }
 
 // NpcId returns a pointer to the model's npcId
@@ -23,18 +37,141 @@ func (m *Model) Recharger() bool {
 	return m.recharger
 }
 
+// Name returns the display name of the shop
+func (m *Model) Name() string {
+	return m.name
+}
+
+// Description returns the description of the shop
+func (m *Model) Description() string {
+	return m.description
+}
+
+// OpensAt returns the local time of day (HH:MM) the shop opens. Empty when the shop has no schedule.
+func (m *Model) OpensAt() string {
+	return m.opensAt
+}
+
+// ClosesAt returns the local time of day (HH:MM) the shop closes. Empty when the shop has no schedule.
+func (m *Model) ClosesAt() string {
+	return m.closesAt
+}
+
+// TimeZone returns the IANA time zone the schedule is expressed in. Empty means UTC.
+func (m *Model) TimeZone() string {
+	return m.timeZone
+}
+
+// Enabled returns whether the shop is enabled
+func (m *Model) Enabled() bool {
+	return m.enabled
+}
+
+// ShopTemplateId returns the template the shop inherits commodities from. uuid.Nil when the shop has no template.
+func (m *Model) ShopTemplateId() uuid.UUID {
+	return m.shopTemplateId
+}
+
+// ExcludedItems returns the item template ids inherited from the shop template which the shop does not sell
+func (m *Model) ExcludedItems() []uint32 {
+	return m.excludedItems
+}
+
+// Version returns the revision of the shop, which advances on every change to the shop or its commodities
+func (m *Model) Version() uint32 {
+	return m.version
+}
+
+// IsOpen returns whether the shop is enabled and within its opening hours at the given instant
+func (m *Model) IsOpen(now time.Time) bool {
+	if !m.enabled {
+		return false
+	}
+	if m.opensAt == "" || m.closesAt == "" {
+		return true
+	}
+
+	loc, err := loadLocation(m.timeZone)
+	if err != nil {
+		return false
+	}
+	opens, err := parseTimeOfDay(m.opensAt)
+	if err != nil {
+		return false
+	}
+	closes, err := parseTimeOfDay(m.closesAt)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	current := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if opens == closes {
+		return true
+	}
+	if opens < closes {
+		return current >= opens && current < closes
+	}
+	// Schedule wraps past midnight (e.g. 22:00 - 06:00)
+	return current >= opens || current < closes
+}
+
+// ValidateSchedule verifies the opening hours and time zone can be interpreted
+func (m *Model) ValidateSchedule() error {
+	if (m.opensAt == "") != (m.closesAt == "") {
+		return fmt.Errorf("%w: opensAt and closesAt must be provided together", ErrInvalidSchedule)
+	}
+	if m.opensAt != "" {
+		if _, err := parseTimeOfDay(m.opensAt); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+		}
+		if _, err := parseTimeOfDay(m.closesAt); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+		}
+	}
+	if _, err := loadLocation(m.timeZone); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+	}
+	return nil
+}
+
+func loadLocation(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(timeZone)
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day [%s]: %w", value, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 // NewBuilder is used to initialize a new ModelBuilder
 func NewBuilder(npcId uint32) *ModelBuilder {
 	return &ModelBuilder{
-		npcId: npcId,
+		npcId:   npcId,
+		enabled: true,
 	}
 }
 
 // ModelBuilder is used to build Model instances
 type ModelBuilder struct {
-	npcId       uint32
-	commodities []commodities.Model
-	recharger   bool
+	npcId          uint32
+	commodities    []commodities.Model
+	recharger      bool
+	name           string
+	description    string
+	opensAt        string
+	closesAt       string
+	timeZone       string
+	enabled        bool
+	shopTemplateId uuid.UUID
+	excludedItems  []uint32
+	version        uint32
 }
 
 // SetNpcId sets the npcId for the ModelBuilder
@@ -61,20 +198,114 @@ func (b *ModelBuilder) SetRecharger(recharger bool) *ModelBuilder {
 	return b
 }
 
+// SetName sets the display name for the ModelBuilder
+func (b *ModelBuilder) SetName(name string) *ModelBuilder {
+	b.name = name
+	return b
+}
+
+// SetDescription sets the description for the ModelBuilder
+func (b *ModelBuilder) SetDescription(description string) *ModelBuilder {
+	b.description = description
+	return b
+}
+
+// SetOpensAt sets the local opening time of day (HH:MM) for the ModelBuilder
+func (b *ModelBuilder) SetOpensAt(opensAt string) *ModelBuilder {
+	b.opensAt = opensAt
+	return b
+}
+
+// SetClosesAt sets the local closing time of day (HH:MM) for the ModelBuilder
+func (b *ModelBuilder) SetClosesAt(closesAt string) *ModelBuilder {
+	b.closesAt = closesAt
+	return b
+}
+
+// SetTimeZone sets the IANA time zone of the schedule for the ModelBuilder
+func (b *ModelBuilder) SetTimeZone(timeZone string) *ModelBuilder {
+	b.timeZone = timeZone
+	return b
+}
+
+// SetEnabled sets whether the shop is enabled for the ModelBuilder
+func (b *ModelBuilder) SetEnabled(enabled bool) *ModelBuilder {
+	b.enabled = enabled
+	return b
+}
+
+// SetShopTemplateId sets the template the shop inherits commodities from
+func (b *ModelBuilder) SetShopTemplateId(shopTemplateId uuid.UUID) *ModelBuilder {
+	b.shopTemplateId = shopTemplateId
+	return b
+}
+
+// SetExcludedItems sets the inherited item template ids the shop does not sell
+func (b *ModelBuilder) SetExcludedItems(excludedItems []uint32) *ModelBuilder {
+	b.excludedItems = excludedItems
+	return b
+}
+
+// SetVersion sets the revision of the shop
+func (b *ModelBuilder) SetVersion(version uint32) *ModelBuilder {
+	b.version = version
+	return b
+}
+
 // Build creates a new Model instance with the builder's values
 func (b *ModelBuilder) Build() Model {
 	return Model{
-		npcId:       b.npcId,
-		commodities: b.commodities,
-		recharger:   b.recharger,
+		npcId:          b.npcId,
+		commodities:    b.commodities,
+		recharger:      b.recharger,
+		name:           b.name,
+		description:    b.description,
+		opensAt:        b.opensAt,
+		closesAt:       b.closesAt,
+		timeZone:       b.timeZone,
+		enabled:        b.enabled,
+		shopTemplateId: b.shopTemplateId,
+		excludedItems:  b.excludedItems,
+		version:        b.version,
 	}
 }
 
 // Clone creates a new ModelBuilder with values from the given Model
 func Clone(model Model) *ModelBuilder {
 	return &ModelBuilder{
-		npcId:       model.npcId,
-		commodities: model.commodities,
-		recharger:   model.recharger,
+		npcId:          model.npcId,
+		commodities:    model.commodities,
+		recharger:      model.recharger,
+		name:           model.name,
+		description:    model.description,
+		opensAt:        model.opensAt,
+		closesAt:       model.closesAt,
+		timeZone:       model.timeZone,
+		enabled:        model.enabled,
+		shopTemplateId: model.shopTemplateId,
+		excludedItems:  model.excludedItems,
+		version:        model.version,
 	}
 }
+
+// DeletedModel is a soft-deleted shop which may be restored
+type DeletedModel struct {
+	id        uuid.UUID
+	shop      Model
+	deletedAt time.Time
+}
+
+// Id returns the id of the deleted shop record
+func (m DeletedModel) Id() uuid.UUID {
+	return m.id
+}
+
+// Shop returns the deleted shop
+func (m DeletedModel) Shop() Model {
+	return m.shop
+}
+
+// DeletedAt returns when the shop was deleted
+func (m DeletedModel) DeletedAt() time.Time {
+	return m.deletedAt
+}
@@ -0,0 +1,57 @@
+package shops_test
+
+import (
+	"atlas-npc/shops"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShopIsOpen(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		shop     shops.Model
+		now      time.Time
+		expected bool
+	}{
+		{"no schedule", shops.NewBuilder(1).Build(), at(3, 0), true},
+		{"disabled", shops.NewBuilder(1).SetEnabled(false).Build(), at(12, 0), false},
+		{"within hours", shops.NewBuilder(1).SetOpensAt("09:00").SetClosesAt("17:00").Build(), at(12, 0), true},
+		{"at closing time", shops.NewBuilder(1).SetOpensAt("09:00").SetClosesAt("17:00").Build(), at(17, 0), false},
+		{"before opening", shops.NewBuilder(1).SetOpensAt("09:00").SetClosesAt("17:00").Build(), at(8, 59), false},
+		{"overnight late", shops.NewBuilder(1).SetOpensAt("22:00").SetClosesAt("06:00").Build(), at(23, 30), true},
+		{"overnight early", shops.NewBuilder(1).SetOpensAt("22:00").SetClosesAt("06:00").Build(), at(5, 0), true},
+		{"overnight midday", shops.NewBuilder(1).SetOpensAt("22:00").SetClosesAt("06:00").Build(), at(12, 0), false},
+		{"time zone", shops.NewBuilder(1).SetOpensAt("09:00").SetClosesAt("17:00").SetTimeZone("Asia/Seoul").Build(), at(1, 0), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.shop.IsOpen(tc.now); got != tc.expected {
+				t.Errorf("Expected IsOpen %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestShopValidateSchedule(t *testing.T) {
+	invalid := []shops.Model{
+		shops.NewBuilder(1).SetOpensAt("09:00").Build(),
+		shops.NewBuilder(1).SetOpensAt("9am").SetClosesAt("17:00").Build(),
+		shops.NewBuilder(1).SetTimeZone("Not/AZone").Build(),
+	}
+	for _, m := range invalid {
+		if err := m.ValidateSchedule(); !errors.Is(err, shops.ErrInvalidSchedule) {
+			t.Errorf("Expected ErrInvalidSchedule for opensAt [%s] closesAt [%s] timeZone [%s], got %v", m.OpensAt(), m.ClosesAt(), m.TimeZone(), err)
+		}
+	}
+
+	valid := shops.NewBuilder(1).SetOpensAt("09:00").SetClosesAt("17:00").SetTimeZone("America/New_York").Build()
+	if err := valid.ValidateSchedule(); err != nil {
+		t.Errorf("Expected valid schedule, got %v", err)
+	}
+}
@@ -1,19 +1,20 @@
 package shops
 
 import (
+	"atlas-npc/audit"
 	"atlas-npc/character"
+	"atlas-npc/character/quest"
 	"atlas-npc/character/skill"
 	"atlas-npc/commodities"
 	"atlas-npc/compartment"
 	"atlas-npc/data/consumable"
-	"atlas-npc/data/equipable"
-	"atlas-npc/data/etc"
-	"atlas-npc/data/setup"
 	"atlas-npc/database"
 	inventory2 "atlas-npc/inventory"
 	"atlas-npc/kafka/message"
 	"atlas-npc/kafka/message/shops"
 	"atlas-npc/kafka/producer"
+	"atlas-npc/templates"
+	"atlas-npc/transactions"
 	"context"
 	"errors"
 	"github.com/Chronicle20/atlas-constants/inventory"
@@ -25,19 +26,47 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"math"
+	"sort"
+	"time"
 )
 
 type Processor interface {
 	CommodityDecorator(m Model) Model
+	AvailableToDecorator(c character.Model) model.Decorator[Model]
+	GetCommodityViews(npcId uint32, characterId uint32) ([]CommodityView, error)
+	WithTransaction(tx *gorm.DB) Processor
+	WithTemplateValidator(validate func(templateId uint32) error) Processor
+	WithExpectedVersion(version uint32) Processor
+	ValidateCommodities(cms []commodities.Model) error
+	CreateShopTemplate(m templates.Model) (templates.Model, error)
+	UpdateShopTemplate(m templates.Model) (templates.Model, error)
+	GetDeletedShops() ([]DeletedModel, error)
+	DeletedShopsProvider() model.Provider[[]DeletedModel]
+	RestoreShop(id uuid.UUID) (Model, error)
+	GetDeletedCommodities() ([]commodities.DeletedModel, error)
+	RestoreCommodity(id uuid.UUID) (commodities.Model, error)
+	RestoreAsOf(asOf time.Time) error
+	PurgeDeleted(before time.Time) (int64, error)
 	RechargeableConsumablesDecorator(m Model) Model
 	GetByNpcId(decorators ...model.Decorator[Model]) func(npcId uint32) (Model, error)
 	ByNpcIdProvider(decorators ...model.Decorator[Model]) func(npcId uint32) model.Provider[Model]
 	GetAllShops(decorators ...model.Decorator[Model]) ([]Model, error)
+	GetByShopTemplateId(decorators ...model.Decorator[Model]) func(shopTemplateId uuid.UUID) ([]Model, error)
+	ByShopTemplateIdProvider(decorators ...model.Decorator[Model]) func(shopTemplateId uuid.UUID) model.Provider[[]Model]
 	AllShopsProvider(decorators ...model.Decorator[Model]) model.Provider[[]Model]
-	CreateShop(npcId uint32, recharger bool, commodities []commodities.Model) (Model, error)
-	UpdateShop(npcId uint32, recharger bool, commodities []commodities.Model) (Model, error)
-	AddCommodity(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (commodities.Model, error)
-	UpdateCommodity(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (commodities.Model, error)
+	GetShops(q Query, decorators ...model.Decorator[Model]) ([]Model, error)
+	ShopsProvider(q Query, decorators ...model.Decorator[Model]) model.Provider[[]Model]
+	CountShops(q Query) (int64, error)
+	GetVendors(templateId uint32) ([]Vendor, error)
+	GetArbitrage() ([]Arbitrage, error)
+	GetCatalog() ([]Model, error)
+	IsEmpty() (bool, error)
+	CatalogProvider() model.Provider[[]Model]
+	CreateShop(m Model) (Model, error)
+	UpdateShop(m Model) (Model, error)
+	DiffShop(m Model) (Diff, error)
+	AddCommodity(npcId uint32, m commodities.Model) (commodities.Model, error)
+	UpdateCommodity(id uuid.UUID, m commodities.Model) (commodities.Model, error)
 	RemoveCommodity(id uuid.UUID) error
 	DeleteAllCommoditiesByNpcId(npcId uint32) error
 	DeleteAllShops() error
@@ -45,6 +74,10 @@ type Processor interface {
 	Enter(mb *message.Buffer) func(characterId uint32) func(npcId uint32) error
 	ExitAndEmit(characterId uint32) error
 	Exit(mb *message.Buffer) func(characterId uint32) error
+	ExitAllAndEmit(npcId uint32) error
+	ExitAll(mb *message.Buffer) func(npcId uint32) error
+	EjectFromClosedShopsAndEmit(now time.Time) error
+	ExpireIdleSessionsAndEmit(now time.Time) error
 	BuyAndEmit(characterId uint32, slot uint16, itemTemplateId uint32, quantity uint32, discountPrice uint32) error
 	Buy(mb *message.Buffer) func(characterId uint32) func(slot uint16, itemTemplateId uint32, quantity uint32, discountPrice uint32) error
 	SellAndEmit(characterId uint32, slot int16, itemTemplateId uint32, quantity uint32) error
@@ -52,9 +85,26 @@ type Processor interface {
 	RechargeAndEmit(characterId uint32, slot uint16) error
 	Recharge(mb *message.Buffer) func(characterId uint32) func(slot uint16) error
 	GetCharactersInShop(shopId uint32) []uint32
+	GetSessions() []Session
+	ExitFromShopAndEmit(npcId uint32, characterId uint32) error
+	SubscribeActivity(npcId uint32) (<-chan Activity, func())
 }
 
 var ErrNotFound = errors.New("not found")
+var ErrInvalidSchedule = errors.New("invalid schedule")
+var ErrUnknownShopTemplate = errors.New("unknown shop template")
+var ErrCharacterNotFound = errors.New("character not found")
+var ErrShopExists = errors.New("shop already exists")
+var ErrVersionConflict = errors.New("shop version conflict")
+var ErrNotInShop = errors.New("character not in shop")
+
+const (
+	ReasonShopDisabled     = "This shop is currently unavailable."
+	ReasonShopClosed       = "This shop is closed right now."
+	ReasonJobRestricted    = "This item cannot be purchased by your job."
+	ReasonGenderRestricted = "This item cannot be purchased by your gender."
+	ReasonQuestRestricted  = "You have not met the quest requirement for this item."
+)
 
 type ProcessorImpl struct {
 	l                                  logrus.FieldLogger
@@ -64,8 +114,19 @@ type ProcessorImpl struct {
 	GetByNpcIdFn                       func(decorators ...model.Decorator[Model]) func(npcId uint32) (Model, error)
 	GetAllShopsFn                      func(decorators ...model.Decorator[Model]) ([]Model, error)
 	RechargeableConsumablesDecoratorFn func(m Model) Model
+	ValidateTemplateIdFn               func(templateId uint32) error
+	SellPriceFn                        func(templateId uint32) (uint32, error)
+	rejectCashItems                    bool
+	blockArbitrage                     bool
+	idleTimeout                        time.Duration
+	expectedVersion                    uint32
+	registry                           Registry
 	cp                                 commodities.Processor
+	ap                                 audit.Processor
+	tp                                 templates.Processor
+	xp                                 transactions.Processor
 	charP                              character.Processor
+	questP                             quest.Processor
 	compP                              compartment.Processor
 	invP                               inventory2.Processor
 	kp                                 producer.Provider
@@ -73,27 +134,299 @@ type ProcessorImpl struct {
 
 func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
 	p := &ProcessorImpl{
-		l:     l,
-		ctx:   ctx,
-		db:    db,
-		t:     tenant.MustFromContext(ctx),
-		cp:    commodities.NewProcessor(l, ctx, db),
-		charP: character.NewProcessor(l, ctx),
-		compP: compartment.NewProcessor(l, ctx),
-		invP:  inventory2.NewProcessor(l, ctx),
-		kp:    producer.ProviderImpl(l)(ctx),
+		l:               l,
+		ctx:             ctx,
+		db:              db,
+		t:               tenant.MustFromContext(ctx),
+		rejectCashItems: rejectCashItems(),
+		blockArbitrage:  blockArbitrage(),
+		idleTimeout:     idleTimeout(),
+		registry:        getRegistry(l, db),
+		cp:              commodities.NewProcessor(l, ctx, db),
+		ap:              audit.NewProcessor(l, ctx, db),
+		tp:              templates.NewProcessor(l, ctx, db),
+		xp:              transactions.NewProcessor(l, ctx, db),
+		charP:           character.NewProcessor(l, ctx),
+		questP:          quest.NewProcessor(l, ctx),
+		compP:           compartment.NewProcessor(l, ctx),
+		invP:            inventory2.NewProcessor(l, ctx),
+		kp:              producer.ProviderImpl(l)(ctx),
 	}
 	return p
 }
 
+func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:                                  p.l,
+		ctx:                                p.ctx,
+		db:                                 tx,
+		t:                                  p.t,
+		GetByNpcIdFn:                       p.GetByNpcIdFn,
+		GetAllShopsFn:                      p.GetAllShopsFn,
+		RechargeableConsumablesDecoratorFn: p.RechargeableConsumablesDecoratorFn,
+		ValidateTemplateIdFn:               p.ValidateTemplateIdFn,
+		SellPriceFn:                        p.SellPriceFn,
+		rejectCashItems:                    p.rejectCashItems,
+		blockArbitrage:                     p.blockArbitrage,
+		idleTimeout:                        p.idleTimeout,
+		expectedVersion:                    p.expectedVersion,
+		registry:                           p.registry,
+		cp:                                 p.cp.WithTransaction(tx),
+		ap:                                 p.ap.WithTransaction(tx),
+		tp:                                 p.tp.WithTransaction(tx),
+		xp:                                 p.xp.WithTransaction(tx),
+		charP:                              p.charP,
+		questP:                             p.questP,
+		compP:                              p.compP,
+		invP:                               p.invP,
+		kp:                                 p.kp,
+	}
+}
+
+// WithCharacterProcessor returns a processor which retrieves characters and changes their meso through charP.
+func (p *ProcessorImpl) WithCharacterProcessor(charP character.Processor) *ProcessorImpl {
+	np := p.WithTransaction(p.db).(*ProcessorImpl)
+	np.charP = charP
+	return np
+}
+
+// WithCompartmentProcessor returns a processor which requests the creation and destruction of items through compP.
+func (p *ProcessorImpl) WithCompartmentProcessor(compP compartment.Processor) *ProcessorImpl {
+	np := p.WithTransaction(p.db).(*ProcessorImpl)
+	np.compP = compP
+	return np
+}
+
+// WithProducer returns a processor which emits the status events of shop commands through kp.
+func (p *ProcessorImpl) WithProducer(kp producer.Provider) *ProcessorImpl {
+	np := p.WithTransaction(p.db).(*ProcessorImpl)
+	np.kp = kp
+	return np
+}
+
+// WithTemplateValidator returns a processor which validates item templates with validate, allowing a bulk write to share
+// lookups across shops.
+func (p *ProcessorImpl) WithTemplateValidator(validate func(templateId uint32) error) Processor {
+	np := p.WithTransaction(p.db).(*ProcessorImpl)
+	np.ValidateTemplateIdFn = validate
+	return np
+}
+
+// WithExpectedVersion returns a processor whose changes to a shop or its commodities fail with ErrVersionConflict unless
+// the shop is at the given version. A version of zero applies changes unconditionally.
+func (p *ProcessorImpl) WithExpectedVersion(version uint32) Processor {
+	np := p.WithTransaction(p.db).(*ProcessorImpl)
+	np.expectedVersion = version
+	return np
+}
+
+// bumpVersion advances the version of the shop for an NPC, as part of a change to it or its commodities.
+func (p *ProcessorImpl) bumpVersion(tx *gorm.DB, npcId uint32) error {
+	ok, err := bumpVersion(p.t.Id(), npcId, p.expectedVersion)(tx)()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// checkVersion refuses with ErrVersionConflict, as bumpVersion would, when the shop for an NPC is not at the expected
+// version, without advancing it.
+func (p *ProcessorImpl) checkVersion(tx *gorm.DB, npcId uint32) error {
+	if p.expectedVersion == 0 {
+		return nil
+	}
+	e, err := getByNpcId(p.t.Id(), npcId)(tx)()
+	if errors.Is(err, ErrNotFound) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+	if e.Version != p.expectedVersion {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// record audits a change to a shop. A nil before or after marks the shop as created or deleted. Commodities are
+// audited by the commodities processor as they change.
+func (p *ProcessorImpl) record(tx *gorm.DB, action string, before *Model, after *Model) error {
+	var npcId uint32
+	var bv, av any
+	if before != nil {
+		rm, err := Transform(*before)
+		if err != nil {
+			return err
+		}
+		npcId, bv = before.NpcId(), rm
+	}
+	if after != nil {
+		rm, err := Transform(*after)
+		if err != nil {
+			return err
+		}
+		npcId, av = after.NpcId(), rm
+	}
+	return p.ap.WithTransaction(tx).Record(action, npcId, uuid.Nil, bv, av)
+}
+
 func (p *ProcessorImpl) CommodityDecorator(m Model) Model {
-	cms, err := p.cp.GetByNpcId(m.NpcId())
+	cms, err := p.resolveCommodities(m)
 	if err != nil {
 		return m
 	}
 	return Clone(m).SetCommodities(cms).Build()
 }
 
+// AvailableToDecorator removes commodities the character is not allowed to buy due to job, gender or quest restrictions.
+func (p *ProcessorImpl) AvailableToDecorator(c character.Model) model.Decorator[Model] {
+	return func(m Model) Model {
+		quests, questsOk := p.questsFor(c.Id(), m.Commodities())
+		cms := make([]commodities.Model, 0, len(m.Commodities()))
+		for _, cm := range m.Commodities() {
+			if !cm.AvailableTo(c.JobId(), c.Gender()) {
+				continue
+			}
+			if cm.RequiresQuest() && (!questsOk || !cm.AllowsQuestState(byte(quest.GetState(quests, cm.QuestId())))) {
+				continue
+			}
+			cms = append(cms, cm)
+		}
+		return Clone(m).SetCommodities(cms).Build()
+	}
+}
+
+// GetCommodityViews evaluates every commodity of the shop for the character, including those they may not buy.
+func (p *ProcessorImpl) GetCommodityViews(npcId uint32, characterId uint32) ([]CommodityView, error) {
+	s, err := p.GetByNpcId(p.CommodityDecorator)(npcId)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.charP.GetById()(characterId)
+	if err != nil {
+		p.l.WithError(err).Errorf("Cannot locate character [%d].", characterId)
+		return nil, ErrCharacterNotFound
+	}
+	quests, questsOk := p.questsFor(characterId, s.Commodities())
+
+	views := make([]CommodityView, 0, len(s.Commodities()))
+	for _, cm := range s.Commodities() {
+		views = append(views, NewCommodityView(c, cm, quests, questsOk))
+	}
+	return views, nil
+}
+
+// questsFor retrieves the character's quest progress, only when one of the commodities is quest gated. Gated
+// commodities should be treated as unavailable when the quest service cannot be reached.
+func (p *ProcessorImpl) questsFor(characterId uint32, cms []commodities.Model) ([]quest.Model, bool) {
+	for _, cm := range cms {
+		if !cm.RequiresQuest() {
+			continue
+		}
+		quests, err := p.questP.GetByCharacterId(characterId)
+		if err != nil {
+			p.l.WithError(err).Errorf("Unable to retrieve quests for character [%d].", characterId)
+			return nil, false
+		}
+		return quests, true
+	}
+	return nil, true
+}
+
+// resolveCommodities returns the commodities the shop sells, merging those inherited from its template with its own.
+func (p *ProcessorImpl) resolveCommodities(m Model) ([]commodities.Model, error) {
+	own, err := p.cp.GetByNpcId(m.NpcId())
+	if err != nil {
+		return nil, err
+	}
+	if m.ShopTemplateId() == uuid.Nil {
+		return own, nil
+	}
+
+	tm, err := p.tp.GetById(p.tp.CommodityDecorator)(m.ShopTemplateId())
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to retrieve shop template [%s] for shop [%d]. Using shop commodities only.", m.ShopTemplateId(), m.NpcId())
+		return own, nil
+	}
+	return mergeCommodities(m.NpcId(), tm.Commodities(), own, m.ExcludedItems()), nil
+}
+
+// mergeCommodities overlays a shop's own commodities on those inherited from its template. Shop entries replace
+// template entries for the same item, excluded items are dropped, and remaining shop entries are appended.
+func mergeCommodities(npcId uint32, inherited []commodities.Model, own []commodities.Model, excluded []uint32) []commodities.Model {
+	excludedSet := make(map[uint32]bool, len(excluded))
+	for _, id := range excluded {
+		excludedSet[id] = true
+	}
+	ownByTemplateId := make(map[uint32]commodities.Model, len(own))
+	for _, c := range own {
+		ownByTemplateId[c.TemplateId()] = c
+	}
+
+	result := make([]commodities.Model, 0, len(inherited)+len(own))
+	used := make(map[uint32]bool, len(own))
+	for _, ic := range inherited {
+		if oc, ok := ownByTemplateId[ic.TemplateId()]; ok {
+			result = append(result, oc)
+			used[ic.TemplateId()] = true
+			continue
+		}
+		if excludedSet[ic.TemplateId()] {
+			continue
+		}
+		result = append(result, commodities.Clone(ic).SetNpcId(npcId).SetInherited(true).Build())
+	}
+	for _, oc := range own {
+		if !used[oc.TemplateId()] {
+			result = append(result, oc)
+		}
+	}
+	return result
+}
+
+// validateShopTemplate verifies the template referenced by the shop exists for the tenant.
+func (p *ProcessorImpl) validateShopTemplate(tx *gorm.DB, m Model) error {
+	if m.ShopTemplateId() == uuid.Nil {
+		return nil
+	}
+	_, err := p.tp.WithTransaction(tx).GetById()(m.ShopTemplateId())
+	if errors.Is(err, templates.ErrNotFound) {
+		return ErrUnknownShopTemplate
+	}
+	return err
+}
+
+// CreateShopTemplate creates a shop template, provided each of its commodities can be sold. Shops inheriting from the
+// template sell them, so they are held to the same checks as commodities of a shop.
+func (p *ProcessorImpl) CreateShopTemplate(m templates.Model) (templates.Model, error) {
+	if err := p.ValidateCommodities(m.Commodities()); err != nil {
+		return templates.Model{}, err
+	}
+	return p.tp.Create(m)
+}
+
+// UpdateShopTemplate replaces a shop template and its commodities, provided each of them can be sold.
+func (p *ProcessorImpl) UpdateShopTemplate(m templates.Model) (templates.Model, error) {
+	if err := p.ValidateCommodities(m.Commodities()); err != nil {
+		return templates.Model{}, err
+	}
+	return p.tp.Update(m)
+}
+
+// ownCommodities drops commodities resolved from the shop template so they are not persisted as shop overrides.
+func ownCommodities(cms []commodities.Model) []commodities.Model {
+	result := make([]commodities.Model, 0, len(cms))
+	for _, c := range cms {
+		if !c.Inherited() {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
 func (p *ProcessorImpl) GetByNpcId(decorators ...model.Decorator[Model]) func(npcId uint32) (Model, error) {
 	return func(npcId uint32) (Model, error) {
 		if p.GetByNpcIdFn != nil {
@@ -132,102 +465,243 @@ func (p *ProcessorImpl) ByNpcIdProvider(decorators ...model.Decorator[Model]) fu
 	}
 }
 
-func (p *ProcessorImpl) AddCommodity(npcId uint32, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (commodities.Model, error) {
-	return p.cp.CreateCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+func (p *ProcessorImpl) AddCommodity(npcId uint32, m commodities.Model) (commodities.Model, error) {
+	if err := p.ValidateCommodities([]commodities.Model{m}); err != nil {
+		return commodities.Model{}, err
+	}
+	var result commodities.Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		err := p.bumpVersion(tx, npcId)
+		if err != nil {
+			return err
+		}
+		result, err = p.cp.WithTransaction(tx).CreateCommodity(npcId, m)
+		return err
+	})
+	if txErr != nil {
+		return commodities.Model{}, txErr
+	}
+	return result, nil
 }
 
-func (p *ProcessorImpl) UpdateCommodity(id uuid.UUID, templateId uint32, mesoPrice uint32, discountRate byte, tokenTemplateId uint32, tokenPrice uint32, period uint32, levelLimited uint32) (commodities.Model, error) {
-	return p.cp.UpdateCommodity(id, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+func (p *ProcessorImpl) UpdateCommodity(id uuid.UUID, m commodities.Model) (commodities.Model, error) {
+	if err := p.ValidateCommodities([]commodities.Model{m}); err != nil {
+		return commodities.Model{}, err
+	}
+	var result commodities.Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		var err error
+		result, err = p.cp.WithTransaction(tx).UpdateCommodity(id, m)
+		if err != nil {
+			return err
+		}
+		return p.bumpVersion(tx, result.NpcId())
+	})
+	if txErr != nil {
+		return commodities.Model{}, txErr
+	}
+	return result, nil
 }
 
 func (p *ProcessorImpl) RemoveCommodity(id uuid.UUID) error {
-	return p.cp.DeleteCommodity(id)
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		cp := p.cp.WithTransaction(tx)
+		c, err := cp.GetById(id)
+		if err != nil {
+			return err
+		}
+		err = p.bumpVersion(tx, c.NpcId())
+		if err != nil {
+			return err
+		}
+		return cp.DeleteCommodity(id)
+	})
 }
 
-func (p *ProcessorImpl) CreateShop(npcId uint32, recharger bool, commodities []commodities.Model) (Model, error) {
-	shopEntity, err := createShop(p.t.Id(), npcId, recharger)(p.db)()
-	if err != nil {
+// CreateShop creates the shop of an NPC with its own commodities. It fails with ErrShopExists when the NPC has one.
+func (p *ProcessorImpl) CreateShop(m Model) (Model, error) {
+	if err := m.ValidateSchedule(); err != nil {
+		return Model{}, err
+	}
+	if err := p.validateShopTemplate(p.db, m); err != nil {
+		return Model{}, err
+	}
+
+	npcId := m.NpcId()
+	own := ownCommodities(m.Commodities())
+	if err := p.ValidateCommodities(own); err != nil {
 		return Model{}, err
 	}
 
-	// For each commodity, create it in the database
-	for _, commodity := range commodities {
-		_, err := p.cp.CreateCommodity(
-			npcId,
-			commodity.TemplateId(),
-			commodity.MesoPrice(),
-			commodity.DiscountRate(),
-			commodity.TokenTemplateId(),
-			commodity.TokenPrice(),
-			commodity.Period(),
-			commodity.LevelLimit(),
-		)
+	var result Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		exists, err := existsByNpcId(p.t.Id(), npcId)(tx)()
 		if err != nil {
-			return Model{}, err
+			return err
+		}
+		if exists {
+			return ErrShopExists
+		}
+
+		shopEntity, err := createShop(p.t.Id(), m)(tx)()
+		if err != nil {
+			return err
+		}
+
+		// For each commodity, create it in the database
+		cp := p.cp.WithTransaction(tx)
+		created := make([]commodities.Model, 0, len(own))
+		for _, commodity := range own {
+			c, err := cp.CreateCommodity(npcId, commodity)
+			if err != nil {
+				return err
+			}
+			created = append(created, c)
 		}
+
+		// Convert entity to model and add commodities
+		shop, err := Make(shopEntity)
+		if err != nil {
+			return err
+		}
+		result = Clone(shop).SetCommodities(created).Build()
+		return p.record(tx, audit.ActionCreateShop, nil, &result)
+	})
+	if txErr != nil {
+		return Model{}, txErr
 	}
+	return result, nil
+}
 
-	// Convert entity to model and add commodities
-	shop, err := Make(shopEntity)
+// DiffShop computes the changes UpdateShop would make to the shop, without making them. Like UpdateShop, it fails with
+// ErrVersionConflict when the shop is not at the expected version.
+func (p *ProcessorImpl) DiffShop(m Model) (Diff, error) {
+	if err := p.checkVersion(p.db, m.NpcId()); err != nil {
+		return Diff{}, err
+	}
+	if err := m.ValidateSchedule(); err != nil {
+		return Diff{}, err
+	}
+	if err := p.validateShopTemplate(p.db, m); err != nil {
+		return Diff{}, err
+	}
+	if err := p.ValidateCommodities(ownCommodities(m.Commodities())); err != nil {
+		return Diff{}, err
+	}
+	return p.diffShop(p.db, m)
+}
+
+// diffShop compares the submitted shop with the one stored for its NPC.
+func (p *ProcessorImpl) diffShop(tx *gorm.DB, m Model) (Diff, error) {
+	diff := Diff{
+		npcId:             m.NpcId(),
+		changedAttributes: make([]string, 0),
+		added:             make([]commodities.Model, 0),
+		updated:           make([]CommodityChange, 0),
+		removed:           make([]commodities.Model, 0),
+		unchanged:         make([]commodities.Model, 0),
+	}
+
+	e, err := getByNpcId(p.t.Id(), m.NpcId())(tx)()
+	if errors.Is(err, ErrNotFound) {
+		diff.created = true
+	} else if err != nil {
+		return Diff{}, err
+	} else {
+		stored, err := Make(e)
+		if err != nil {
+			return Diff{}, err
+		}
+		diff.changedAttributes = diffAttributes(stored, m)
+	}
+
+	existing, err := p.cp.WithTransaction(tx).GetByNpcId(m.NpcId())
 	if err != nil {
-		return Model{}, err
+		return Diff{}, err
 	}
-	return Clone(shop).SetCommodities(commodities).Build(), nil
+	return reconcileCommodities(diff, existing, ownCommodities(m.Commodities())), nil
 }
 
-func (p *ProcessorImpl) UpdateShop(npcId uint32, recharger bool, commodities []commodities.Model) (Model, error) {
-	p.l.Debugf("Updating shop for NPC [%d] with [%d] commodities.", npcId, len(commodities))
+// UpdateShop replaces the settings and commodities of the shop, creating it if needed. Commodities are reconciled with
+// those stored, so commodities which are kept retain their id.
+func (p *ProcessorImpl) UpdateShop(m Model) (Model, error) {
+	npcId := m.NpcId()
+	p.l.Debugf("Updating shop for NPC [%d] with [%d] commodities.", npcId, len(m.Commodities()))
+
+	if err := m.ValidateSchedule(); err != nil {
+		return Model{}, err
+	}
+	if err := p.ValidateCommodities(ownCommodities(m.Commodities())); err != nil {
+		return Model{}, err
+	}
 
 	var shop Model
 	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
-		// Update or create the shop entity with the provided recharger value
-		var shopEntity Entity
-		var err error
-		shopEntity, err = updateShop(p.t.Id(), npcId, recharger)(tx)()
+		err := p.validateShopTemplate(tx, m)
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to update/create shop entity for NPC [%d].", npcId)
 			return err
 		}
-		p.l.Debugf("Updated/created shop entity for NPC [%d] with recharger=[%t].", npcId, recharger)
 
-		// Get existing commodities for the NPC ID
-		existingCommodities, err := p.cp.WithTransaction(tx).GetByNpcId(npcId)
+		// Advance the version first, so concurrent updates are refused before any change is made
+		err = p.bumpVersion(tx, npcId)
 		if err != nil {
-			p.l.WithError(err).Errorf("Failed to retrieve existing commodities for NPC [%d].", npcId)
 			return err
 		}
-		p.l.Debugf("Found [%d] existing commodities for NPC [%d].", len(existingCommodities), npcId)
 
-		// Delete all existing commodities
-		for i, commodity := range existingCommodities {
-			p.l.Debugf("Deleting commodity [%d/%d] with ID [%s] for NPC [%d].", i+1, len(existingCommodities), commodity.Id(), npcId)
-			err = p.cp.WithTransaction(tx).DeleteCommodity(commodity.Id())
+		var before *Model
+		e, err := getByNpcId(p.t.Id(), npcId)(tx)()
+		if err == nil {
+			stored, err := Make(e)
 			if err != nil {
-				p.l.WithError(err).Errorf("Failed to delete commodity [%s] for NPC [%d].", commodity.Id(), npcId)
 				return err
 			}
+			before = &stored
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
 		}
-		p.l.Debugf("Successfully deleted all [%d] existing commodities for NPC [%d].", len(existingCommodities), npcId)
 
-		// For each commodity, create it in the database
-		for i, commodity := range commodities {
-			p.l.Debugf("Creating commodity [%d/%d] with template ID [%d] for NPC [%d].", i+1, len(commodities), commodity.TemplateId(), npcId)
-			_, err = p.cp.WithTransaction(tx).CreateCommodity(
-				npcId,
-				commodity.TemplateId(),
-				commodity.MesoPrice(),
-				commodity.DiscountRate(),
-				commodity.TokenTemplateId(),
-				commodity.TokenPrice(),
-				commodity.Period(),
-				commodity.LevelLimit(),
-			)
+		diff, err := p.diffShop(tx, m)
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to compute changes to shop for NPC [%d].", npcId)
+			return err
+		}
+
+		// Update or create the shop entity with the provided settings
+		shopEntity, err := updateShop(p.t.Id(), m)(tx)()
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to update/create shop entity for NPC [%d].", npcId)
+			return err
+		}
+		p.l.Debugf("Updated/created shop entity for NPC [%d] with recharger=[%t] enabled=[%t].", npcId, m.Recharger(), m.Enabled())
+
+		cp := p.cp.WithTransaction(tx)
+		for _, c := range diff.Removed() {
+			err = cp.DeleteCommodity(c.Id())
+			if err != nil {
+				p.l.WithError(err).Errorf("Failed to delete commodity [%s] for NPC [%d].", c.Id(), npcId)
+				return err
+			}
+		}
+
+		result := append(make([]commodities.Model, 0, len(m.Commodities())), diff.Unchanged()...)
+		for _, cc := range diff.Updated() {
+			c := cc.After()
+			uc, err := cp.UpdateCommodity(c.Id(), c)
+			if err != nil {
+				p.l.WithError(err).Errorf("Failed to update commodity [%s] for NPC [%d].", c.Id(), npcId)
+				return err
+			}
+			result = append(result, uc)
+		}
+		for _, c := range diff.Added() {
+			ac, err := cp.CreateCommodity(npcId, c)
 			if err != nil {
-				p.l.WithError(err).Errorf("Failed to create commodity with template ID [%d] for NPC [%d].", commodity.TemplateId(), npcId)
+				p.l.WithError(err).Errorf("Failed to create commodity with template ID [%d] for NPC [%d].", c.TemplateId(), npcId)
 				return err
 			}
+			result = append(result, ac)
 		}
-		p.l.Debugf("Successfully created all [%d] new commodities for NPC [%d].", len(commodities), npcId)
+		p.l.Debugf("Reconciled commodities for NPC [%d]: [%d] added, [%d] updated, [%d] removed, [%d] unchanged.", npcId, len(diff.Added()), len(diff.Updated()), len(diff.Removed()), len(diff.Unchanged()))
 
 		// Convert entity to model and add commodities
 		shopModel, err := Make(shopEntity)
@@ -235,69 +709,191 @@ func (p *ProcessorImpl) UpdateShop(npcId uint32, recharger bool, commodities []c
 			p.l.WithError(err).Errorf("Failed to convert shop entity to model for NPC [%d].", npcId)
 			return err
 		}
-		shop = Clone(shopModel).SetCommodities(commodities).Build()
-		p.l.Debugf("Created shop model for NPC [%d].", npcId)
-
-		return nil
+		shop = Clone(shopModel).SetCommodities(result).Build()
+		if before == nil {
+			return p.record(tx, audit.ActionCreateShop, nil, &shop)
+		}
+		return p.record(tx, audit.ActionUpdateShop, before, &shop)
 	})
 	if txErr != nil {
 		p.l.WithError(txErr).Errorf("Transaction failed while updating shop for NPC [%d].", npcId)
 		return Model{}, txErr
 	}
-	p.l.Debugf("Successfully updated shop for NPC [%d] with [%d] commodities.", npcId, len(commodities))
+	p.l.Debugf("Successfully updated shop for NPC [%d] with [%d] commodities.", npcId, len(shop.Commodities()))
+
+	if !shop.IsOpen(time.Now()) {
+		err := p.ExitAllAndEmit(npcId)
+		if err != nil {
+			p.l.WithError(err).Errorf("Unable to eject characters from shop [%d] after it was closed.", npcId)
+		}
+	}
 	return shop, nil
 }
 
 func (p *ProcessorImpl) EnterAndEmit(characterId uint32, npcId uint32) error {
-	return message.Emit(p.kp)(model.Flip(model.Flip(p.Enter)(characterId))(npcId))
+	a := Activity{npcId: npcId, characterId: characterId, operation: OperationEnter}
+	return message.Emit(p.kp)(p.observed(a, model.Flip(model.Flip(p.Enter)(characterId))(npcId)))
 }
 
 func (p *ProcessorImpl) Enter(mb *message.Buffer) func(characterId uint32) func(npcId uint32) error {
 	return func(characterId uint32) func(npcId uint32) error {
 		return func(npcId uint32) error {
 			p.l.Debugf("Character [%d] attempting to enter shop [%d].", characterId, npcId)
-			_, err := p.GetByNpcId(p.CommodityDecorator)(npcId)
+			s, err := p.GetByNpcId(p.CommodityDecorator)(npcId)
 			if err != nil {
 				p.l.WithError(err).Errorf("Cannot locate shop [%d] character [%d] is attempting to enter.", npcId, characterId)
 				return err
 			}
-			getRegistry().AddCharacter(p.t.Id(), characterId, npcId)
-			return mb.Put(shops.EnvStatusEventTopic, enteredEventProvider(characterId, npcId))
+			if !s.Enabled() {
+				p.l.Debugf("Character [%d] attempting to enter disabled shop [%d].", characterId, npcId)
+				return mb.Put(shops.EnvStatusEventTopic, reasonErrorEventProvider(characterId, shops.ErrorGenericErrorWithReason, ReasonShopDisabled))
+			}
+			if !s.IsOpen(time.Now()) {
+				p.l.Debugf("Character [%d] attempting to enter shop [%d] outside of its opening hours.", characterId, npcId)
+				return mb.Put(shops.EnvStatusEventTopic, reasonErrorEventProvider(characterId, shops.ErrorGenericErrorWithReason, ReasonShopClosed))
+			}
+			c, err := p.charP.GetById()(characterId)
+			if err != nil {
+				p.l.WithError(err).Errorf("Cannot locate character [%d] attempting to enter shop [%d].", characterId, npcId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			s = p.AvailableToDecorator(c)(s)
+			if err = p.registry.AddCharacter(p.t, characterId, npcId); err != nil {
+				p.l.WithError(err).Errorf("Unable to register character [%d] in shop [%d].", characterId, npcId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			return mb.Put(shops.EnvStatusEventTopic, enteredEventProvider(characterId, npcId, s.Commodities()))
 		}
 	}
 }
 
 func (p *ProcessorImpl) ExitAndEmit(characterId uint32) error {
-	return message.Emit(p.kp)(model.Flip(p.Exit)(characterId))
+	npcId, _ := p.registry.GetShop(p.t.Id(), characterId)
+	a := Activity{npcId: npcId, characterId: characterId, operation: OperationExit}
+	return message.Emit(p.kp)(p.observed(a, model.Flip(p.Exit)(characterId)))
 }
 
 func (p *ProcessorImpl) Exit(mb *message.Buffer) func(characterId uint32) error {
 	return func(characterId uint32) error {
 		p.l.Debugf("Character [%d] attempting to exit shop.", characterId)
-		_, inShop := getRegistry().GetShop(p.t.Id(), characterId)
-		getRegistry().RemoveCharacter(p.t.Id(), characterId)
-		if inShop {
+		// Only the exit which removed the character reports it, so a character exiting as its session expires, or on
+		// another replica, is not told twice.
+		removed, err := p.registry.RemoveCharacter(p.t.Id(), characterId)
+		if err != nil {
+			p.l.WithError(err).Errorf("Unable to remove character [%d] from shop.", characterId)
+			return err
+		}
+		if removed {
 			return mb.Put(shops.EnvStatusEventTopic, exitedEventProvider(characterId))
 		}
 		return nil
 	}
 }
 
+func (p *ProcessorImpl) ExitAllAndEmit(npcId uint32) error {
+	return message.Emit(p.kp)(model.Flip(p.ExitAll)(npcId))
+}
+
+func (p *ProcessorImpl) ExitAll(mb *message.Buffer) func(npcId uint32) error {
+	return func(npcId uint32) error {
+		characterIds := p.registry.GetCharactersInShop(p.t.Id(), npcId)
+		p.l.Debugf("Removing [%d] characters from shop [%d].", len(characterIds), npcId)
+		for _, characterId := range characterIds {
+			a := Activity{npcId: npcId, characterId: characterId, operation: OperationExit}
+			err := p.observed(a, model.Flip(p.Exit)(characterId))(mb)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// EjectFromClosedShopsAndEmit removes characters from every occupied shop of the tenant which is disabled or outside its opening hours.
+func (p *ProcessorImpl) EjectFromClosedShopsAndEmit(now time.Time) error {
+	for _, npcId := range p.registry.GetOccupiedShops(p.t.Id()) {
+		e, err := getByNpcId(p.t.Id(), npcId)(p.db)()
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			p.l.WithError(err).Errorf("Unable to retrieve shop [%d] while checking opening hours.", npcId)
+			continue
+		}
+		if err == nil {
+			s, err := Make(e)
+			if err == nil && s.IsOpen(now) {
+				continue
+			}
+		}
+		p.l.Infof("Shop [%d] has closed. Ejecting characters.", npcId)
+		err = p.ExitAllAndEmit(npcId)
+		if err != nil {
+			p.l.WithError(err).Errorf("Unable to eject characters from shop [%d].", npcId)
+		}
+	}
+	return nil
+}
+
 func (p *ProcessorImpl) GetCharactersInShop(shopId uint32) []uint32 {
-	return getRegistry().GetCharactersInShop(p.t.Id(), shopId)
+	return p.registry.GetCharactersInShop(p.t.Id(), shopId)
+}
+
+// GetSessions returns every character in a shop for the tenant, ordered by shop and then character.
+func (p *ProcessorImpl) GetSessions() []Session {
+	ss := p.registry.GetSessions(p.t.Id())
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].NpcId() != ss[j].NpcId() {
+			return ss[i].NpcId() < ss[j].NpcId()
+		}
+		return ss[i].CharacterId() < ss[j].CharacterId()
+	})
+	return ss
+}
+
+// ExitFromShopAndEmit removes the character from the shop of the NPC, as though it had exited it. Characters not in
+// that shop are refused with ErrNotInShop.
+func (p *ProcessorImpl) ExitFromShopAndEmit(npcId uint32, characterId uint32) error {
+	if shopId, inShop := p.registry.GetShop(p.t.Id(), characterId); !inShop || shopId != npcId {
+		return ErrNotInShop
+	}
+	return p.ExitAndEmit(characterId)
+}
+
+// SubscribeActivity returns the activity of a shop as it happens, and a function which ends the subscription.
+func (p *ProcessorImpl) SubscribeActivity(npcId uint32) (<-chan Activity, func()) {
+	return getActivityHub().Subscribe(p.t.Id(), npcId)
 }
 
 func (p *ProcessorImpl) DeleteAllCommoditiesByNpcId(npcId uint32) error {
-	commoditiesProcessor := commodities.NewProcessor(p.l, p.ctx, p.db)
-	return commoditiesProcessor.DeleteAllCommoditiesByNpcId(npcId)
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		err := p.bumpVersion(tx, npcId)
+		if err != nil {
+			return err
+		}
+		commoditiesProcessor := commodities.NewProcessor(p.l, p.ctx, tx)
+		return commoditiesProcessor.DeleteAllCommoditiesByNpcId(npcId)
+	})
 }
 
 func (p *ProcessorImpl) DeleteAllShops() error {
 	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
-		_, err := deleteAllShops(p.t.Id())(tx)()
+		// Shops and their commodities are deleted at the same instant, so restoring a shop can tell the commodities
+		// deleted with it from those removed before.
+		now := time.Now()
+		tx = tx.Session(&gorm.Session{NowFunc: func() time.Time { return now }})
+
+		ms, err := model.SliceMap(Make)(getAllShops(p.t.Id())(tx))(model.ParallelMap())()
+		if err != nil {
+			return err
+		}
+		_, err = deleteAllShops(p.t.Id())(tx)()
 		if err != nil {
 			return err
 		}
+		for _, m := range ms {
+			err = p.record(tx, audit.ActionDeleteShop, &m, nil)
+			if err != nil {
+				return err
+			}
+		}
 		return p.cp.WithTransaction(tx).DeleteAllCommodities()
 	})
 
@@ -327,7 +923,7 @@ func (p *ProcessorImpl) AllShopsProvider(decorators ...model.Decorator[Model]) m
 				continue
 			}
 			if !shopExists {
-				_, err = createShop(p.t.Id(), npcId, true)(p.db)()
+				_, err = createShop(p.t.Id(), NewBuilder(npcId).SetRecharger(true).Build())(p.db)()
 				if err != nil {
 					continue
 				}
@@ -349,10 +945,129 @@ func (p *ProcessorImpl) AllShopsProvider(decorators ...model.Decorator[Model]) m
 	return model.SliceMap(model.Decorate(append(decorators, p.RechargeableConsumablesDecorator)))(sbp)(model.ParallelMap())
 }
 
+// GetShops returns the shops selected by the query. Filtering, sorting and paging happen in the database, so only the
+// selected shops are decorated.
+func (p *ProcessorImpl) GetShops(q Query, decorators ...model.Decorator[Model]) ([]Model, error) {
+	return p.ShopsProvider(q, decorators...)()
+}
+
+func (p *ProcessorImpl) ShopsProvider(q Query, decorators ...model.Decorator[Model]) model.Provider[[]Model] {
+	sbp := model.SliceMap(Make)(getShops(p.t.Id(), q)(p.db))(model.ParallelMap())
+	return model.SliceMap(model.Decorate(append(decorators, p.RechargeableConsumablesDecorator)))(sbp)(model.ParallelMap())
+}
+
+// CountShops returns the number of shops matching the filters of the query, regardless of its page.
+func (p *ProcessorImpl) CountShops(q Query) (int64, error) {
+	return countMatchingShops(p.t.Id(), q)(p.db)()
+}
+
+// GetVendors returns the enabled shops selling an item, either as their own commodity or inherited from their shop
+// template, cheapest first.
+func (p *ProcessorImpl) GetVendors(templateId uint32) ([]Vendor, error) {
+	own, err := p.cp.GetByTemplateId(templateId)
+	if err != nil {
+		return nil, err
+	}
+	npcIds := make([]uint32, 0, len(own))
+	for _, c := range own {
+		npcIds = append(npcIds, c.NpcId())
+	}
+	oss, err := model.SliceMap(Make)(getByNpcIds(p.t.Id(), npcIds)(p.db))(model.ParallelMap())()
+	if err != nil {
+		return nil, err
+	}
+	ownShops := make(map[uint32]Model, len(oss))
+	for _, s := range oss {
+		ownShops[s.NpcId()] = s
+	}
+
+	inherited, err := p.tp.GetCommoditiesByTemplateId(templateId)
+	if err != nil {
+		return nil, err
+	}
+	shopTemplateIds := make([]uuid.UUID, 0, len(inherited))
+	for id := range inherited {
+		shopTemplateIds = append(shopTemplateIds, id)
+	}
+	inheritingShops, err := model.SliceMap(Make)(getByShopTemplateIds(p.t.Id(), shopTemplateIds)(p.db))(model.ParallelMap())()
+	if err != nil {
+		return nil, err
+	}
+	return vendorsOf(templateId, own, ownShops, inherited, inheritingShops), nil
+}
+
+func (p *ProcessorImpl) GetCatalog() ([]Model, error) {
+	return p.CatalogProvider()()
+}
+
+// CatalogProvider returns the tenant's shops ordered by NPC, each with only the commodities stored for it. Unlike
+// AllShopsProvider, nothing is inherited from templates or added for recharging, so the result describes the shops as
+// persisted.
+func (p *ProcessorImpl) CatalogProvider() model.Provider[[]Model] {
+	shopEntities, err := getAllShops(p.t.Id())(p.db)()
+	if err != nil {
+		return model.ErrorProvider[[]Model](err)
+	}
+	cms, err := p.cp.GetAllByTenant()
+	if err != nil {
+		return model.ErrorProvider[[]Model](err)
+	}
+	byNpcId := make(map[uint32][]commodities.Model)
+	for _, c := range cms {
+		byNpcId[c.NpcId()] = append(byNpcId[c.NpcId()], c)
+	}
+
+	results := make([]Model, 0, len(shopEntities))
+	for _, e := range shopEntities {
+		m, err := Make(e)
+		if err != nil {
+			return model.ErrorProvider[[]Model](err)
+		}
+		results = append(results, Clone(m).SetCommodities(byNpcId[m.NpcId()]).Build())
+		delete(byNpcId, m.NpcId())
+	}
+	// Commodities without a shop row predate shop settings, and are served as recharger shops.
+	for npcId, ncms := range byNpcId {
+		results = append(results, NewBuilder(npcId).SetRecharger(true).SetCommodities(ncms).Build())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].NpcId() < results[j].NpcId()
+	})
+	return model.FixedProvider(results)
+}
+
+// IsEmpty reports whether the tenant has neither shops nor commodities.
+func (p *ProcessorImpl) IsEmpty() (bool, error) {
+	count, err := countShops(p.t.Id())(p.db)()
+	if err != nil || count > 0 {
+		return false, err
+	}
+	npcIds, err := p.cp.GetDistinctNpcIds()
+	if err != nil {
+		return false, err
+	}
+	return len(npcIds) == 0, nil
+}
+
+func (p *ProcessorImpl) GetByShopTemplateId(decorators ...model.Decorator[Model]) func(shopTemplateId uuid.UUID) ([]Model, error) {
+	return func(shopTemplateId uuid.UUID) ([]Model, error) {
+		return p.ByShopTemplateIdProvider(decorators...)(shopTemplateId)()
+	}
+}
+
+func (p *ProcessorImpl) ByShopTemplateIdProvider(decorators ...model.Decorator[Model]) func(shopTemplateId uuid.UUID) model.Provider[[]Model] {
+	return func(shopTemplateId uuid.UUID) model.Provider[[]Model] {
+		sbp := model.SliceMap(Make)(getByShopTemplateId(p.t.Id(), shopTemplateId)(p.db))(model.ParallelMap())
+		return model.SliceMap(model.Decorate(decorators))(sbp)(model.ParallelMap())
+	}
+}
+
 func (p *ProcessorImpl) BuyAndEmit(characterId uint32, slot uint16, itemTemplateId uint32, quantity uint32, discountPrice uint32) error {
-	return message.Emit(p.kp)(func(mb *message.Buffer) error {
+	npcId, _ := p.registry.GetShop(p.t.Id(), characterId)
+	a := Activity{npcId: npcId, characterId: characterId, operation: OperationBuy, templateId: itemTemplateId, quantity: quantity}
+	return message.Emit(p.kp)(p.observed(a, func(mb *message.Buffer) error {
 		return p.Buy(mb)(characterId)(slot, itemTemplateId, quantity, discountPrice)
-	})
+	}))
 }
 
 func (p *ProcessorImpl) Buy(mb *message.Buffer) func(characterId uint32) func(slot uint16, itemTemplateId uint32, quantity uint32, discountPrice uint32) error {
@@ -360,13 +1075,24 @@ func (p *ProcessorImpl) Buy(mb *message.Buffer) func(characterId uint32) func(sl
 		return func(slot uint16, itemTemplateId uint32, quantity uint32, discountPrice uint32) error {
 			p.l.Debugf("Character [%d] attempting to buy item [%d] from slot [%d].", characterId, itemTemplateId, slot)
 
-			shopId, inShop := getRegistry().GetShop(p.t.Id(), characterId)
+			shopId, inShop := p.registry.GetShop(p.t.Id(), characterId)
 			if !inShop {
 				p.l.Errorf("Character [%d] is not in a shop.", characterId)
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
+			p.touch(characterId)
 
-			cms, err := p.cp.GetByNpcId(shopId)
+			se, err := getByNpcId(p.t.Id(), shopId)(p.db)()
+			if err != nil {
+				p.l.WithError(err).Errorf("Cannot locate shop [%d] character [%d] is attempting to buy from.", shopId, characterId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			sm, err := Make(se)
+			if err != nil {
+				p.l.WithError(err).Errorf("Cannot locate shop [%d] character [%d] is attempting to buy from.", shopId, characterId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			cms, err := p.resolveCommodities(sm)
 			if err != nil {
 				p.l.WithError(err).Errorf("Cannot locate shop [%d] character [%d] is attempting to buy from.", shopId, characterId)
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
@@ -393,6 +1119,26 @@ func (p *ProcessorImpl) Buy(mb *message.Buffer) func(characterId uint32) func(sl
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
 
+			if !cm.AllowsJob(c.JobId()) {
+				p.l.Debugf("Character [%d] with job [%d] is attempting to buy job restricted item [%d].", characterId, c.JobId(), itemTemplateId)
+				return mb.Put(shops.EnvStatusEventTopic, reasonErrorEventProvider(characterId, shops.ErrorGenericErrorWithReason, ReasonJobRestricted))
+			}
+			if !cm.AllowsGender(c.Gender()) {
+				p.l.Debugf("Character [%d] with gender [%d] is attempting to buy gender restricted item [%d].", characterId, c.Gender(), itemTemplateId)
+				return mb.Put(shops.EnvStatusEventTopic, reasonErrorEventProvider(characterId, shops.ErrorGenericErrorWithReason, ReasonGenderRestricted))
+			}
+			if cm.RequiresQuest() {
+				quests, err := p.questP.GetByCharacterId(characterId)
+				if err != nil {
+					p.l.WithError(err).Errorf("Unable to retrieve quests for character [%d].", characterId)
+					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+				}
+				if !cm.AllowsQuestState(byte(quest.GetState(quests, cm.QuestId()))) {
+					p.l.Debugf("Character [%d] has not met quest [%d] requirement to buy item [%d].", characterId, cm.QuestId(), itemTemplateId)
+					return mb.Put(shops.EnvStatusEventTopic, reasonErrorEventProvider(characterId, shops.ErrorGenericErrorWithReason, ReasonQuestRestricted))
+				}
+			}
+
 			if cm.MesoPrice() > 0 {
 				totalCost := cm.MesoPrice() * quantity
 
@@ -410,8 +1156,17 @@ func (p *ProcessorImpl) Buy(mb *message.Buffer) func(characterId uint32) func(sl
 					p.l.WithError(err).Errorf("Cannot locate free slot for character [%d].", characterId)
 					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorInventoryFull))
 				}
-				_ = p.charP.RequestChangeMeso(c.WorldId(), c.Id(), c.Id(), "SHOP", -int32(totalCost))
-				_ = p.compP.RequestCreateItem(c.Id(), itemTemplateId, quantity)
+				err = p.charP.RequestChangeMeso(c.WorldId(), c.Id(), c.Id(), "SHOP", -int32(totalCost))
+				if err != nil {
+					p.l.WithError(err).Errorf("Unable to decrement meso for character [%d].", characterId)
+					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+				}
+				err = p.compP.RequestCreateItem(c.Id(), itemTemplateId, quantity)
+				if err != nil {
+					p.l.WithError(err).Errorf("Unable to create item [%d] for character [%d].", itemTemplateId, characterId)
+					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+				}
+				p.recorded(OperationBuy, characterId, p.xp.RecordBuy(c.Id(), shopId, itemTemplateId, quantity, totalCost, 0, 0))
 				p.l.Debugf("Character [%d] bought item [%d].", characterId, itemTemplateId)
 				return nil
 			}
@@ -423,9 +1178,11 @@ func (p *ProcessorImpl) Buy(mb *message.Buffer) func(characterId uint32) func(sl
 }
 
 func (p *ProcessorImpl) SellAndEmit(characterId uint32, slot int16, itemTemplateId uint32, quantity uint32) error {
-	return message.Emit(p.kp)(func(mb *message.Buffer) error {
+	npcId, _ := p.registry.GetShop(p.t.Id(), characterId)
+	a := Activity{npcId: npcId, characterId: characterId, operation: OperationSell, templateId: itemTemplateId, quantity: quantity}
+	return message.Emit(p.kp)(p.observed(a, func(mb *message.Buffer) error {
 		return p.Sell(mb)(characterId)(slot, itemTemplateId, quantity)
-	})
+	}))
 }
 
 func (p *ProcessorImpl) Sell(mb *message.Buffer) func(characterId uint32) func(slot int16, itemTemplateId uint32, quantity uint32) error {
@@ -433,11 +1190,12 @@ func (p *ProcessorImpl) Sell(mb *message.Buffer) func(characterId uint32) func(s
 		return func(slot int16, itemTemplateId uint32, quantity uint32) error {
 			p.l.Debugf("Character [%d] attempting to sell [%d] item [%d] from slot [%d].", characterId, quantity, itemTemplateId, slot)
 
-			_, inShop := getRegistry().GetShop(p.t.Id(), characterId)
+			shopId, inShop := p.registry.GetShop(p.t.Id(), characterId)
 			if !inShop {
 				p.l.Errorf("Character [%d] is not in a shop.", characterId)
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
+			p.touch(characterId)
 
 			// TODO: this needs better transaction handling.
 
@@ -465,44 +1223,24 @@ func (p *ProcessorImpl) Sell(mb *message.Buffer) func(characterId uint32) func(s
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorNeedMoreItems))
 			}
 
-			price := uint32(0)
-			if it == inventory.TypeValueEquip {
-				var em equipable.Model
-				em, err = equipable.NewProcessor(p.l, p.ctx).GetById(itemTemplateId)
-				if err != nil {
-					p.l.WithError(err).Errorf("Unable to get item template [%d].", itemTemplateId)
-					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
-				}
-				price = em.Price()
-			} else if it == inventory.TypeValueUse {
-				var cm consumable.Model
-				cm, err = consumable.NewProcessor(p.l, p.ctx).GetById(itemTemplateId)
-				if err != nil {
-					p.l.WithError(err).Errorf("Unable to get item template [%d].", itemTemplateId)
-					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
-				}
-				price = cm.Price()
-			} else if it == inventory.TypeValueSetup {
-				var sm setup.Model
-				sm, err = setup.NewProcessor(p.l, p.ctx).GetById(itemTemplateId)
-				if err != nil {
-					p.l.WithError(err).Errorf("Unable to get item template [%d].", itemTemplateId)
-					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
-				}
-				price = sm.Price()
-			} else if it == inventory.TypeValueETC {
-				var em etc.Model
-				em, err = etc.NewProcessor(p.l, p.ctx).GetById(itemTemplateId)
-				if err != nil {
-					p.l.WithError(err).Errorf("Unable to get item template [%d].", itemTemplateId)
-					return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
-				}
-				price = em.Price()
+			price, err := p.sellPrice(itemTemplateId)
+			if err != nil {
+				p.l.WithError(err).Errorf("Unable to get item template [%d].", itemTemplateId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
 			price = price * quantity
 
-			_ = p.charP.RequestChangeMeso(c.WorldId(), c.Id(), c.Id(), "SHOP", int32(price))
-			_ = p.compP.RequestDestroyItem(characterId, it, slot, quantity)
+			err = p.charP.RequestChangeMeso(c.WorldId(), c.Id(), c.Id(), "SHOP", int32(price))
+			if err != nil {
+				p.l.WithError(err).Errorf("Unable to increment meso for character [%d].", characterId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			err = p.compP.RequestDestroyItem(characterId, it, slot, quantity)
+			if err != nil {
+				p.l.WithError(err).Errorf("Unable to destroy item [%d] in slot [%d] for character [%d].", itemTemplateId, slot, characterId)
+				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
+			}
+			p.recorded(OperationSell, characterId, p.xp.RecordSell(c.Id(), shopId, itemTemplateId, quantity, price))
 
 			p.l.Debugf("Character [%d] sold [%d] item [%d] from slot [%d].", characterId, quantity, itemTemplateId, slot)
 			return nil
@@ -511,9 +1249,11 @@ func (p *ProcessorImpl) Sell(mb *message.Buffer) func(characterId uint32) func(s
 }
 
 func (p *ProcessorImpl) RechargeAndEmit(characterId uint32, slot uint16) error {
-	return message.Emit(p.kp)(func(mb *message.Buffer) error {
+	npcId, _ := p.registry.GetShop(p.t.Id(), characterId)
+	a := Activity{npcId: npcId, characterId: characterId, operation: OperationRecharge}
+	return message.Emit(p.kp)(p.observed(a, func(mb *message.Buffer) error {
 		return p.Recharge(mb)(characterId)(slot)
-	})
+	}))
 }
 
 func (p *ProcessorImpl) Recharge(mb *message.Buffer) func(characterId uint32) func(slot uint16) error {
@@ -521,11 +1261,12 @@ func (p *ProcessorImpl) Recharge(mb *message.Buffer) func(characterId uint32) fu
 		return func(slot uint16) error {
 			p.l.Debugf("Character [%d] attempting to recharge item from slot [%d].", characterId, slot)
 
-			shopId, inShop := getRegistry().GetShop(p.t.Id(), characterId)
+			shopId, inShop := p.registry.GetShop(p.t.Id(), characterId)
 			if !inShop {
 				p.l.Errorf("Character [%d] is not in a shop.", characterId)
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
+			p.touch(characterId)
 
 			// Check if the shop allows recharging
 			shopEntity, err := getByNpcId(p.t.Id(), shopId)(p.db)()
@@ -592,6 +1333,8 @@ func (p *ProcessorImpl) Recharge(mb *message.Buffer) func(characterId uint32) fu
 				return mb.Put(shops.EnvStatusEventTopic, errorEventProvider(characterId, shops.ErrorGenericError))
 			}
 
+			p.recorded(OperationRecharge, characterId, p.xp.RecordRecharge(c.Id(), shopId, rim.TemplateId(), quantityToAdd, uint32(price)))
+
 			p.l.Debugf("Character [%d] recharged item [%d] in slot [%d] with [%d] quantity.", characterId, rim.TemplateId(), slot, quantityToAdd)
 			return nil
 		}
@@ -651,3 +1394,100 @@ func findRechargeable(templateId uint32, rechargeables []consumable.Model) *cons
 	}
 	return nil
 }
+
+func (p *ProcessorImpl) GetDeletedShops() ([]DeletedModel, error) {
+	return p.DeletedShopsProvider()()
+}
+
+func (p *ProcessorImpl) DeletedShopsProvider() model.Provider[[]DeletedModel] {
+	return model.SliceMap(MakeDeleted)(getDeleted(p.t.Id())(p.db))(model.ParallelMap())
+}
+
+// RestoreShop restores a soft-deleted shop with the commodities deleted together with it, provided no other shop has
+// since been created for the NPC.
+func (p *ProcessorImpl) RestoreShop(id uuid.UUID) (Model, error) {
+	var result Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		e, err := getDeletedById(p.t.Id(), id)(tx)()
+		if err != nil {
+			return err
+		}
+		exists, err := existsByNpcId(p.t.Id(), e.NpcId)(tx)()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrShopExists
+		}
+		_, err = restoreShop(p.t.Id(), id)(tx)()
+		if err != nil {
+			return err
+		}
+		cs, err := p.cp.WithTransaction(tx).RestoreDeletedAt(e.NpcId, e.DeletedAt.Time)
+		if err != nil {
+			return err
+		}
+		result, err = Make(e)
+		if err != nil {
+			return err
+		}
+		result = Clone(result).SetCommodities(cs).Build()
+		return p.record(tx, audit.ActionRestoreShop, nil, &result)
+	})
+	if txErr != nil {
+		return Model{}, txErr
+	}
+	p.l.Infof("Restored shop [%d].", result.NpcId())
+	return result, nil
+}
+
+func (p *ProcessorImpl) GetDeletedCommodities() ([]commodities.DeletedModel, error) {
+	return p.cp.GetDeleted()
+}
+
+func (p *ProcessorImpl) RestoreCommodity(id uuid.UUID) (commodities.Model, error) {
+	return p.cp.RestoreCommodity(id)
+}
+
+// RestoreAsOf returns the tenant's shops and commodities to how they were at the given time. Changes made in place
+// (such as shop attribute updates) are not reverted.
+func (p *ProcessorImpl) RestoreAsOf(asOf time.Time) error {
+	p.l.Infof("Restoring shops and commodities as of [%s].", asOf.Format(time.RFC3339))
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		_, err := restoreShopsAsOf(p.t.Id(), asOf)(tx)()
+		if err != nil {
+			return err
+		}
+		err = p.ap.WithTransaction(tx).Record(audit.ActionRestoreShopsAsOf, 0, uuid.Nil, nil, map[string]any{"asOf": asOf})
+		if err != nil {
+			return err
+		}
+		return p.cp.WithTransaction(tx).RestoreAsOf(asOf)
+	})
+}
+
+// PurgeDeleted permanently removes shops and commodities which were deleted before the given time.
+func (p *ProcessorImpl) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		shopCount, err := purgeDeletedShops(p.t.Id(), before)(tx)()
+		if err != nil {
+			return err
+		}
+		err = p.ap.WithTransaction(tx).Record(audit.ActionPurgeShops, 0, uuid.Nil, nil, map[string]any{"before": before, "purged": shopCount})
+		if err != nil {
+			return err
+		}
+		commodityCount, err := p.cp.WithTransaction(tx).PurgeDeleted(before)
+		if err != nil {
+			return err
+		}
+		purged = shopCount + commodityCount
+		return nil
+	})
+	if txErr != nil {
+		return 0, txErr
+	}
+	p.l.Infof("Purged [%d] shops and commodities deleted before [%s].", purged, before.Format(time.RFC3339))
+	return purged, nil
+}
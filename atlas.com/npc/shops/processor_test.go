@@ -1,15 +1,41 @@
 package shops_test
 
 import (
+	"atlas-npc/character"
 	"atlas-npc/commodities"
 	"atlas-npc/data/consumable"
+	shops2 "atlas-npc/kafka/message/shops"
+	"atlas-npc/metrics"
+	"atlas-npc/rest"
 	"atlas-npc/shops"
+	"atlas-npc/templates"
 	"atlas-npc/test"
+	"atlas-npc/transactions"
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Chronicle20/atlas-constants/inventory"
+	"github.com/Chronicle20/atlas-constants/world"
+	"github.com/Chronicle20/atlas-kafka/producer"
+	"github.com/Chronicle20/atlas-model/model"
+	tenant "github.com/Chronicle20/atlas-tenant"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // mockConsumableCache is a mock implementation of the ConsumableCacheInterface
@@ -30,6 +56,11 @@ func (c *mockConsumableCache) SetConsumables(tenantId uuid.UUID, consumables []c
 	c.consumables[tenantId] = consumables
 }
 
+// acceptTemplateId stands in for the data service, knowing every item template
+func acceptTemplateId(templateId uint32) error {
+	return nil
+}
+
 // originalCache stores the original cache instance
 var originalCache shops.ConsumableCacheInterface
 
@@ -43,6 +74,8 @@ func TestShopsProcessor(t *testing.T) {
 		p.RechargeableConsumablesDecoratorFn = func(m shops.Model) shops.Model {
 			return m
 		}
+		// Item templates are resolved through the data service, which is not available to tests
+		p.ValidateTemplateIdFn = acceptTemplateId
 	}
 
 	// Run tests
@@ -70,9 +103,82 @@ func TestShopsProcessor(t *testing.T) {
 		testUpdateShop(t, processor, db)
 	})
 
+	t.Run("TestUpdateShopPreservesCommodityIds", func(t *testing.T) {
+		testUpdateShopPreservesCommodityIds(t, processor, db)
+	})
+
+	t.Run("TestOptimisticConcurrency", func(t *testing.T) {
+		testOptimisticConcurrency(t, processor, db)
+	})
+
+	t.Run("TestGetShopsQuery", func(t *testing.T) {
+		testGetShopsQuery(t, processor)
+	})
+
 	t.Run("TestDeleteAllShops", func(t *testing.T) {
 		testDeleteAllShops(t, processor, db)
 	})
+
+	t.Run("TestUpdateShopDryRunIfMatch", func(t *testing.T) {
+		testUpdateShopDryRunIfMatch(t, db)
+	})
+
+	t.Run("TestGetShopsPage", func(t *testing.T) {
+		testGetShopsPage(t, db)
+	})
+
+	t.Run("TestShopTemplateInheritance", func(t *testing.T) {
+		testShopTemplateInheritance(t, processor, db)
+	})
+
+	t.Run("TestShopTemplateUpdateReconcilesCommodities", func(t *testing.T) {
+		testShopTemplateUpdateReconcilesCommodities(t, db)
+	})
+
+	t.Run("TestGetVendors", func(t *testing.T) {
+		testGetVendors(t, db)
+	})
+
+	t.Run("TestAvailableToDecorator", func(t *testing.T) {
+		testAvailableToDecorator(t, processor)
+	})
+
+	t.Run("TestQuestGatedCommodities", func(t *testing.T) {
+		testQuestGatedCommodities(t, processor)
+	})
+
+	t.Run("TestRestoreDeleted", func(t *testing.T) {
+		testRestoreDeleted(t, processor, db)
+	})
+
+	t.Run("TestRestoreAsOf", func(t *testing.T) {
+		testRestoreAsOf(t, processor, db)
+	})
+
+	t.Run("TestRestoreAsOfRecreated", func(t *testing.T) {
+		testRestoreAsOfRecreated(t, db)
+	})
+
+	t.Run("TestCommodityValidation", func(t *testing.T) {
+		testCommodityValidation(t, db)
+	})
+
+	t.Run("TestArbitrage", func(t *testing.T) {
+		testArbitrage(t, db)
+	})
+
+	t.Run("TestBuy", func(t *testing.T) {
+		testBuy(t, db)
+	})
+	t.Run("TestIdleSessionExpiry", func(t *testing.T) {
+		testIdleSessionExpiry(t, db)
+	})
+	t.Run("TestForceExit", func(t *testing.T) {
+		testForceExit(t, db)
+	})
+	t.Run("TestActivityStream", func(t *testing.T) {
+		testActivityStream(t, db)
+	})
 }
 
 func testGetByNpcId(t *testing.T, processor shops.Processor, db *gorm.DB) {
@@ -89,13 +195,13 @@ func testGetByNpcId(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
 
 	// Create the shop entity with the commodity
-	_, err = processor.CreateShop(npcId, recharger, []commodities.Model{commodity})
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(recharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop: %v", err)
 	}
@@ -148,7 +254,7 @@ func testAddCommodity(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to add commodity to shop: %v", err)
 	}
@@ -193,7 +299,7 @@ func testUpdateCommodity(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to add test commodity: %v", err)
 	}
@@ -204,7 +310,7 @@ func testUpdateCommodity(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	updatedTokenTemplateId := uint32(0)
 	updatedPeriod := uint32(0)
 	updatedLevelLimited := uint32(0)
-	updatedCommodity, err := processor.UpdateCommodity(commodity.Id(), updatedTemplateId, updatedMesoPrice, updatedDiscountRate, updatedTokenTemplateId, updatedTokenPrice, updatedPeriod, updatedLevelLimited)
+	updatedCommodity, err := processor.UpdateCommodity(commodity.Id(), (&commodities.ModelBuilder{}).SetTemplateId(updatedTemplateId).SetMesoPrice(updatedMesoPrice).SetDiscountRate(updatedDiscountRate).SetTokenTemplateId(updatedTokenTemplateId).SetTokenPrice(updatedTokenPrice).SetPeriod(updatedPeriod).SetLevelLimit(updatedLevelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to update commodity: %v", err)
 	}
@@ -250,7 +356,7 @@ func testRemoveCommodity(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to add test commodity: %v", err)
 	}
@@ -282,13 +388,13 @@ func testCreateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
 
 	// Create shop with the commodity and recharger value
-	shop, err := processor.CreateShop(npcId, recharger, []commodities.Model{commodity})
+	shop, err := processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(recharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop: %v", err)
 	}
@@ -319,13 +425,13 @@ func testCreateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	recharger = false
 
 	// Create another commodity for the second shop
-	commodity, err = processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err = processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
 
 	// Create shop with recharger set to false
-	shop, err = processor.CreateShop(npcId, recharger, []commodities.Model{commodity})
+	shop, err = processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(recharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop: %v", err)
 	}
@@ -344,6 +450,15 @@ func testCreateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	if count != 1 {
 		t.Errorf("Expected 1 shop entity in database, got %d", count)
 	}
+
+	// Creating a shop for an NPC which already has one is refused
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(true).Build())
+	if !errors.Is(err, shops.ErrShopExists) {
+		t.Errorf("Expected ErrShopExists creating a second shop, got %v", err)
+	}
+	if shop, err = processor.GetByNpcId()(npcId); err != nil || shop.Recharger() != recharger {
+		t.Errorf("Expected the existing shop to be unchanged, got recharger [%t] and error %v", shop.Recharger(), err)
+	}
 }
 
 func testUpdateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
@@ -360,19 +475,19 @@ func testUpdateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	tokenTemplateId := uint32(0)
 	period := uint32(0)
 	levelLimited := uint32(0)
-	commodity, err := processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
 
 	// Create shop with initial recharger value
-	_, err = processor.CreateShop(npcId, initialRecharger, []commodities.Model{commodity})
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(initialRecharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop: %v", err)
 	}
 
 	// Update shop with new recharger value
-	updatedShop, err := processor.UpdateShop(npcId, updatedRecharger, []commodities.Model{commodity})
+	updatedShop, err := processor.UpdateShop(shops.NewBuilder(npcId).SetRecharger(updatedRecharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to update shop: %v", err)
 	}
@@ -413,13 +528,13 @@ func testUpdateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	updatedRecharger = true
 
 	// Create a commodity for the new shop
-	commodity, err = processor.AddCommodity(npcId, templateId, mesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+	commodity, err = processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(templateId).SetMesoPrice(mesoPrice).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity: %v", err)
 	}
 
 	// Update non-existent shop (should create a new one)
-	newShop, err := processor.UpdateShop(npcId, updatedRecharger, []commodities.Model{commodity})
+	newShop, err := processor.UpdateShop(shops.NewBuilder(npcId).SetRecharger(updatedRecharger).SetCommodities([]commodities.Model{commodity}).Build())
 	if err != nil {
 		t.Fatalf("Failed to update/create shop: %v", err)
 	}
@@ -452,6 +567,359 @@ func testUpdateShop(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	}
 }
 
+func testUpdateShopPreservesCommodityIds(t *testing.T, processor shops.Processor, db *gorm.DB) {
+	npcId := uint32(2009)
+
+	// Create a shop selling three items
+	created, err := processor.CreateShop(shops.NewBuilder(npcId).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(100).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2000002).SetMesoPrice(150).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	ids := make(map[uint32]uuid.UUID)
+	for _, c := range created.Commodities() {
+		ids[c.TemplateId()] = c.Id()
+	}
+
+	// Keep the first item, reprice the second by template, drop the third and add a fourth
+	submitted := shops.NewBuilder(npcId).SetRecharger(true).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetId(ids[2000000]).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(120).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2000003).SetMesoPrice(200).Build(),
+	}).Build()
+
+	// A dry run reports the changes without making them
+	diff, err := processor.DiffShop(submitted)
+	if err != nil {
+		t.Fatalf("Failed to diff shop: %v", err)
+	}
+	if diff.Created() {
+		t.Errorf("Expected an existing shop to be diffed")
+	}
+	if len(diff.ChangedAttributes()) != 1 || diff.ChangedAttributes()[0] != "recharger" {
+		t.Errorf("Expected only recharger to change, got %v", diff.ChangedAttributes())
+	}
+	if len(diff.Unchanged()) != 1 || len(diff.Updated()) != 1 || len(diff.Added()) != 1 || len(diff.Removed()) != 1 {
+		t.Fatalf("Expected 1 unchanged, updated, added and removed commodity, got %d, %d, %d, %d", len(diff.Unchanged()), len(diff.Updated()), len(diff.Added()), len(diff.Removed()))
+	}
+	change := diff.Updated()[0]
+	before, after := change.Before(), change.After()
+	if before.MesoPrice() != 100 || after.MesoPrice() != 120 || after.Id() != ids[2000001] {
+		t.Errorf("Expected item 2000001 to be repriced from 100 to 120 in place, got %d to %d", before.MesoPrice(), after.MesoPrice())
+	}
+	removed := diff.Removed()[0]
+	if removed.Id() != ids[2000002] {
+		t.Errorf("Expected item 2000002 to be removed, got %d", removed.TemplateId())
+	}
+	unchanged, err := processor.GetByNpcId(processor.CommodityDecorator)(npcId)
+	if err != nil {
+		t.Fatalf("Failed to retrieve shop: %v", err)
+	}
+	if unchanged.Recharger() || len(unchanged.Commodities()) != 3 {
+		t.Errorf("Expected a dry run to leave the shop untouched")
+	}
+
+	// A dry run is refused, like the update, when the shop has moved on from the version it is based on
+	if _, err = processor.WithExpectedVersion(created.Version() + 1).DiffShop(submitted); !errors.Is(err, shops.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict diffing against a stale version, got %v", err)
+	}
+	if _, err = processor.WithExpectedVersion(created.Version()).DiffShop(submitted); err != nil {
+		t.Errorf("Expected a dry run against the current version to succeed, got %v", err)
+	}
+
+	// Applying the update keeps the ids of retained commodities
+	_, err = processor.UpdateShop(submitted)
+	if err != nil {
+		t.Fatalf("Failed to update shop: %v", err)
+	}
+	updated, err := processor.GetByNpcId(processor.CommodityDecorator)(npcId)
+	if err != nil {
+		t.Fatalf("Failed to retrieve shop: %v", err)
+	}
+	if !updated.Recharger() {
+		t.Errorf("Expected recharger to be updated")
+	}
+	got := make(map[uint32]commodities.Model)
+	for _, c := range updated.Commodities() {
+		got[c.TemplateId()] = c
+	}
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 commodities, got %d", len(got))
+	}
+	for _, templateId := range []uint32{2000000, 2000001} {
+		c, ok := got[templateId]
+		if !ok || c.Id() != ids[templateId] {
+			t.Errorf("Expected item %d to keep id %s", templateId, ids[templateId])
+		}
+	}
+	repriced := got[2000001]
+	if repriced.MesoPrice() != 120 {
+		t.Errorf("Expected item 2000001 to cost 120, got %d", repriced.MesoPrice())
+	}
+	if _, ok := got[2000002]; ok {
+		t.Errorf("Expected item 2000002 to be removed")
+	}
+	if _, ok := got[2000003]; !ok {
+		t.Errorf("Expected item 2000003 to be added")
+	}
+}
+
+func testUpdateShopDryRunIfMatch(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2066)
+	ctx := test.CreateTestContext()
+	processor := shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(acceptTemplateId)
+	created, err := processor.CreateShop(shops.NewBuilder(npcId).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	rm, err := shops.Transform(shops.Clone(created).SetRecharger(true).Build())
+	if err != nil {
+		t.Fatalf("Failed to create REST model: %v", err)
+	}
+	body, err := jsonapi.Marshal(rm)
+	if err != nil {
+		t.Fatalf("Failed to marshal shop: %v", err)
+	}
+
+	ten := tenant.MustFromContext(ctx)
+	router := mux.NewRouter()
+	shops.InitResource(GetServer())(db)(router, logrus.New())
+	put := func(ifMatch string) int {
+		r := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/npcs/%d/shop?dryRun=true", npcId), bytes.NewReader(body))
+		r.Header.Set("TENANT_ID", ten.Id().String())
+		r.Header.Set("REGION", ten.Region())
+		r.Header.Set("MAJOR_VERSION", strconv.Itoa(int(ten.MajorVersion())))
+		r.Header.Set("MINOR_VERSION", strconv.Itoa(int(ten.MinorVersion())))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+	}{
+		{"Current", rest.ETag(created.Version()), http.StatusOK},
+		{"Stale", rest.ETag(created.Version() + 1), http.StatusPreconditionFailed},
+		{"Missing", "", http.StatusPreconditionRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := put(tt.ifMatch); status != tt.status {
+				t.Errorf("Expected status %d for a dry run, got %d", tt.status, status)
+			}
+		})
+	}
+}
+
+func testOptimisticConcurrency(t *testing.T, processor shops.Processor, db *gorm.DB) {
+	npcId := uint32(2010)
+
+	created, err := processor.CreateShop(shops.NewBuilder(npcId).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	if created.Version() != 1 {
+		t.Fatalf("Expected a new shop to be at version 1, got %d", created.Version())
+	}
+
+	// An update from the current version succeeds and advances the version
+	updated, err := processor.WithExpectedVersion(1).UpdateShop(shops.NewBuilder(npcId).SetRecharger(true).SetCommodities(created.Commodities()).Build())
+	if err != nil {
+		t.Fatalf("Failed to update shop: %v", err)
+	}
+	if updated.Version() != 2 {
+		t.Errorf("Expected shop to be at version 2, got %d", updated.Version())
+	}
+
+	// A second update from the stale version is refused
+	_, err = processor.WithExpectedVersion(1).UpdateShop(shops.NewBuilder(npcId).SetName("Stale").Build())
+	if !errors.Is(err, shops.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale update, got %v", err)
+	}
+	_, err = processor.WithExpectedVersion(1).AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(100).Build())
+	if !errors.Is(err, shops.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale commodity addition, got %v", err)
+	}
+	retrieved, err := processor.GetByNpcId()(npcId)
+	if err != nil {
+		t.Fatalf("Failed to retrieve shop: %v", err)
+	}
+	if retrieved.Name() == "Stale" || retrieved.Version() != 2 {
+		t.Errorf("Expected refused changes to leave the shop at version 2, got %d", retrieved.Version())
+	}
+	var count int64
+	db.Model(&commodities.Entity{}).Where("npc_id = ? AND template_id = ?", npcId, 2000001).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected a refused commodity addition to write nothing, got %d", count)
+	}
+
+	// Commodity changes advance the version of their shop
+	commodity, err := processor.WithExpectedVersion(2).AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(100).Build())
+	if err != nil {
+		t.Fatalf("Failed to add commodity: %v", err)
+	}
+	_, err = processor.WithExpectedVersion(3).UpdateCommodity(commodity.Id(), (&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(120).Build())
+	if err != nil {
+		t.Fatalf("Failed to update commodity: %v", err)
+	}
+	if err = processor.WithExpectedVersion(3).RemoveCommodity(commodity.Id()); !errors.Is(err, shops.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale commodity removal, got %v", err)
+	}
+	if err = processor.WithExpectedVersion(4).RemoveCommodity(commodity.Id()); err != nil {
+		t.Fatalf("Failed to remove commodity: %v", err)
+	}
+	retrieved, err = processor.GetByNpcId()(npcId)
+	if err != nil {
+		t.Fatalf("Failed to retrieve shop: %v", err)
+	}
+	if retrieved.Version() != 5 {
+		t.Errorf("Expected shop to be at version 5, got %d", retrieved.Version())
+	}
+}
+
+func testGetShopsQuery(t *testing.T, processor shops.Processor) {
+	// Shops 2100 to 2105, where even NPCs are rechargers
+	for npcId := uint32(2100); npcId <= 2105; npcId++ {
+		_, err := processor.CreateShop(shops.NewBuilder(npcId).SetRecharger(npcId%2 == 0).Build())
+		if err != nil {
+			t.Fatalf("Failed to create shop: %v", err)
+		}
+	}
+	lo, hi, err := shops.ParseNpcIdRange("2100..2105")
+	if err != nil {
+		t.Fatalf("Failed to parse NPC id range: %v", err)
+	}
+	recharger := true
+	sort, err := shops.ParseSort("-npcId")
+	if err != nil {
+		t.Fatalf("Failed to parse sort: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    shops.Query
+		expected []uint32
+		total    int64
+	}{
+		{"range", shops.Query{NpcIdMin: lo, NpcIdMax: hi}, []uint32{2100, 2101, 2102, 2103, 2104, 2105}, 6},
+		{"filtered", shops.Query{NpcIdMin: lo, NpcIdMax: hi, Recharger: &recharger}, []uint32{2100, 2102, 2104}, 3},
+		{"sorted", shops.Query{NpcIdMin: lo, NpcIdMax: hi, Sort: sort}, []uint32{2105, 2104, 2103, 2102, 2101, 2100}, 6},
+		{"paged", shops.Query{NpcIdMin: lo, NpcIdMax: hi, Sort: sort, PageNumber: 2, PageSize: 4}, []uint32{2101, 2100}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := processor.GetShops(tt.query)
+			if err != nil {
+				t.Fatalf("Failed to get shops: %v", err)
+			}
+			got := make([]uint32, 0, len(ms))
+			for _, m := range ms {
+				got = append(got, m.NpcId())
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected shops %v, got %v", tt.expected, got)
+			}
+			total, err := processor.CountShops(tt.query)
+			if err != nil {
+				t.Fatalf("Failed to count shops: %v", err)
+			}
+			if total != tt.total {
+				t.Errorf("Expected %d matching shops, got %d", tt.total, total)
+			}
+		})
+	}
+
+	if _, err = shops.ParseSort("price"); !errors.Is(err, shops.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an unknown sort attribute, got %v", err)
+	}
+	if _, _, err = shops.ParseNpcIdRange("2105..2100"); !errors.Is(err, shops.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for a reversed NPC id range, got %v", err)
+	}
+}
+
+func testGetShopsPage(t *testing.T, db *gorm.DB) {
+	ctx := test.CreateTestContext()
+	processor := shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(acceptTemplateId)
+	for npcId := uint32(2200); npcId <= 2202; npcId++ {
+		if _, err := processor.CreateShop(shops.NewBuilder(npcId).Build()); err != nil {
+			t.Fatalf("Failed to create shop: %v", err)
+		}
+	}
+
+	ten := tenant.MustFromContext(ctx)
+	router := mux.NewRouter()
+	shops.InitResource(GetServer())(db)(router, logrus.New())
+	get := func(target string) (int, []string, float64, map[string]string) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("TENANT_ID", ten.Id().String())
+		r.Header.Set("REGION", ten.Region())
+		r.Header.Set("MAJOR_VERSION", strconv.Itoa(int(ten.MajorVersion())))
+		r.Header.Set("MINOR_VERSION", strconv.Itoa(int(ten.MinorVersion())))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var doc struct {
+			Data []struct {
+				Id string `json:"id"`
+			} `json:"data"`
+			Meta struct {
+				Total float64 `json:"total"`
+			} `json:"meta"`
+			Links map[string]string `json:"links"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+		ids := make([]string, 0, len(doc.Data))
+		for _, d := range doc.Data {
+			ids = append(ids, d.Id)
+		}
+		return w.Code, ids, doc.Meta.Total, doc.Links
+	}
+
+	// Without page parameters the first page of the default size is returned
+	code, ids, total, links := get("/shops")
+	if code != http.StatusOK || len(ids) != 3 || total != 3 {
+		t.Errorf("Expected 3 of 3 shops, got status %d with %d of %v", code, len(ids), total)
+	}
+	if _, ok := links["next"]; ok {
+		t.Errorf("Expected no next link on the only page, got %v", links)
+	}
+
+	// The total and pagination links are returned in the document
+	code, ids, total, links = get("/shops?page[size]=2")
+	if code != http.StatusOK || len(ids) != 2 || total != 3 {
+		t.Errorf("Expected 2 of 3 shops, got status %d with %d of %v", code, len(ids), total)
+	}
+	next, err := url.Parse(links["next"])
+	if err != nil || next.Query().Get("page[number]") != "2" || next.Query().Get("page[size]") != "2" {
+		t.Errorf("Expected a next link to page 2, got [%s]", links["next"])
+	}
+	if _, ok := links["prev"]; ok {
+		t.Errorf("Expected no prev link on the first page, got %v", links)
+	}
+	code, ids, _, links = get(links["next"])
+	if code != http.StatusOK || len(ids) != 1 || links["prev"] == "" {
+		t.Errorf("Expected the last shop with a prev link, got status %d with %d shops and %v", code, len(ids), links)
+	}
+
+	// A reversed NPC id range is rejected
+	if code, _, _, _ = get("/shops?filter[npcId]=2202..2200"); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a reversed NPC id range, got %d", http.StatusBadRequest, code)
+	}
+}
+
 func testDeleteAllShops(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	// Test data for first shop
 	npcId1 := uint32(3001)
@@ -474,23 +942,23 @@ func testDeleteAllShops(t *testing.T, processor shops.Processor, db *gorm.DB) {
 	levelLimited := uint32(0)
 
 	// Create commodities for the shops
-	commodity1, err := processor.AddCommodity(npcId1, templateId1, mesoPrice1, discountRate, tokenTemplateId, tokenPrice1, period, levelLimited)
+	commodity1, err := processor.AddCommodity(npcId1, (&commodities.ModelBuilder{}).SetTemplateId(templateId1).SetMesoPrice(mesoPrice1).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice1).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity 1: %v", err)
 	}
 
-	commodity2, err := processor.AddCommodity(npcId2, templateId2, mesoPrice2, discountRate, tokenTemplateId, tokenPrice2, period, levelLimited)
+	commodity2, err := processor.AddCommodity(npcId2, (&commodities.ModelBuilder{}).SetTemplateId(templateId2).SetMesoPrice(mesoPrice2).SetDiscountRate(discountRate).SetTokenTemplateId(tokenTemplateId).SetTokenPrice(tokenPrice2).SetPeriod(period).SetLevelLimit(levelLimited).Build())
 	if err != nil {
 		t.Fatalf("Failed to create test commodity 2: %v", err)
 	}
 
 	// Create shops with the commodities
-	_, err = processor.CreateShop(npcId1, recharger1, []commodities.Model{commodity1})
+	_, err = processor.CreateShop(shops.NewBuilder(npcId1).SetRecharger(recharger1).SetCommodities([]commodities.Model{commodity1}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop 1: %v", err)
 	}
 
-	_, err = processor.CreateShop(npcId2, recharger2, []commodities.Model{commodity2})
+	_, err = processor.CreateShop(shops.NewBuilder(npcId2).SetRecharger(recharger2).SetCommodities([]commodities.Model{commodity2}).Build())
 	if err != nil {
 		t.Fatalf("Failed to create shop 2: %v", err)
 	}
@@ -540,3 +1008,1085 @@ func testDeleteAllShops(t *testing.T, processor shops.Processor, db *gorm.DB) {
 		t.Errorf("Expected 0 commodity entities in database after deletion, got %d", commodityCount)
 	}
 }
+
+func testShopTemplateInheritance(t *testing.T, processor shops.Processor, db *gorm.DB) {
+	// Test data
+	npcId := uint32(2010)
+	overriddenTemplateId := uint32(2000000)
+	excludedTemplateId := uint32(2000001)
+	inheritedTemplateId := uint32(2000002)
+	ownTemplateId := uint32(2000003)
+
+	// Shop templates are tenant scoped, so the template and shop are managed within the same tenant
+	ctx := test.CreateTestContext()
+	processor = shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(acceptTemplateId)
+
+	// Create a shop template with three commodities
+	tp := templates.NewProcessor(logrus.New(), ctx, db)
+	tm, err := tp.Create(templates.NewBuilder(uuid.Nil).
+		SetName("Potion Shop").
+		SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(overriddenTemplateId).SetMesoPrice(50).Build(),
+			(&commodities.ModelBuilder{}).SetTemplateId(excludedTemplateId).SetMesoPrice(100).Build(),
+			(&commodities.ModelBuilder{}).SetTemplateId(inheritedTemplateId).SetMesoPrice(150).Build(),
+		}).
+		Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+
+	// Create a shop which overrides one commodity, excludes another and adds its own
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).
+		SetShopTemplateId(tm.Id()).
+		SetExcludedItems([]uint32{excludedTemplateId}).
+		SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(overriddenTemplateId).SetMesoPrice(40).Build(),
+			(&commodities.ModelBuilder{}).SetTemplateId(ownTemplateId).SetMesoPrice(200).Build(),
+		}).
+		Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	// Verify the merged commodity list
+	shop, err := processor.GetByNpcId(processor.CommodityDecorator)(npcId)
+	if err != nil {
+		t.Fatalf("Failed to get shop: %v", err)
+	}
+	expected := []struct {
+		templateId uint32
+		mesoPrice  uint32
+		inherited  bool
+	}{
+		{overriddenTemplateId, 40, false},
+		{inheritedTemplateId, 150, true},
+		{ownTemplateId, 200, false},
+	}
+	if len(shop.Commodities()) != len(expected) {
+		t.Fatalf("Expected %d commodities, got %d", len(expected), len(shop.Commodities()))
+	}
+	for i, e := range expected {
+		c := shop.Commodities()[i]
+		if c.TemplateId() != e.templateId || c.MesoPrice() != e.mesoPrice || c.Inherited() != e.inherited {
+			t.Errorf("Expected commodity %d to be (%d, %d, %v), got (%d, %d, %v)", i, e.templateId, e.mesoPrice, e.inherited, c.TemplateId(), c.MesoPrice(), c.Inherited())
+		}
+	}
+
+	// Verify inherited commodities were not persisted as shop commodities
+	var count int64
+	result := db.Model(&commodities.Entity{}).Where("npc_id = ?", npcId).Count(&count)
+	if result.Error != nil {
+		t.Fatalf("Failed to count commodity entities in database: %v", result.Error)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 commodity entities in database, got %d", count)
+	}
+
+	// Verify the shop is listed as inheriting from the template
+	inheriting, err := processor.GetByShopTemplateId()(tm.Id())
+	if err != nil {
+		t.Fatalf("Failed to get shops by shop template: %v", err)
+	}
+	if len(inheriting) != 1 || inheriting[0].NpcId() != npcId {
+		t.Errorf("Expected shop %d to inherit from the template, got %d shops", npcId, len(inheriting))
+	}
+
+	// Verify updating the template advances the version of the shop, so a stale If-Match is refused
+	if _, err = tp.Update(templates.Clone(tm).SetName("Elixir Shop").Build()); err != nil {
+		t.Fatalf("Failed to update shop template: %v", err)
+	}
+	updated, err := processor.GetByNpcId()(npcId)
+	if err != nil {
+		t.Fatalf("Failed to get shop: %v", err)
+	}
+	if updated.Version() != shop.Version()+1 {
+		t.Errorf("Expected version %d after the template update, got %d", shop.Version()+1, updated.Version())
+	}
+	_, err = processor.WithExpectedVersion(shop.Version()).UpdateShop(shops.Clone(updated).SetName("Stale").Build())
+	if !errors.Is(err, shops.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict updating with the version read before the template update, got %v", err)
+	}
+
+	// Verify the template cannot be deleted while inherited
+	if err = tp.Delete(tm.Id()); !errors.Is(err, templates.ErrInUse) {
+		t.Errorf("Expected ErrInUse deleting an inherited template, got %v", err)
+	}
+
+	// Verify an unknown template is rejected
+	_, err = processor.CreateShop(shops.NewBuilder(npcId + 1).SetShopTemplateId(uuid.New()).Build())
+	if !errors.Is(err, shops.ErrUnknownShopTemplate) {
+		t.Errorf("Expected ErrUnknownShopTemplate, got %v", err)
+	}
+}
+
+func testShopTemplateUpdateReconcilesCommodities(t *testing.T, db *gorm.DB) {
+	// Test data
+	keptTemplateId := uint32(2000010)
+	repricedTemplateId := uint32(2000011)
+	removedTemplateId := uint32(2000012)
+	addedTemplateId := uint32(2000013)
+
+	tp := templates.NewProcessor(logrus.New(), test.CreateTestContext(), db)
+	tm, err := tp.Create(templates.NewBuilder(uuid.Nil).
+		SetName("Scroll Shop").
+		SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(keptTemplateId).SetMesoPrice(10).Build(),
+			(&commodities.ModelBuilder{}).SetTemplateId(repricedTemplateId).SetMesoPrice(20).Build(),
+			(&commodities.ModelBuilder{}).SetTemplateId(removedTemplateId).SetMesoPrice(30).Build(),
+		}).
+		Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+	ids := make(map[uint32]uuid.UUID)
+	for _, c := range tm.Commodities() {
+		ids[c.TemplateId()] = c.Id()
+	}
+
+	// Submit one commodity by id, one by template id only with a new price, and a new one
+	updated, err := tp.Update(templates.Clone(tm).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetId(ids[keptTemplateId]).SetTemplateId(keptTemplateId).SetMesoPrice(10).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(repricedTemplateId).SetMesoPrice(25).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(addedTemplateId).SetMesoPrice(40).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to update shop template: %v", err)
+	}
+	if len(updated.Commodities()) != 3 {
+		t.Fatalf("Expected 3 commodities, got %d", len(updated.Commodities()))
+	}
+
+	stored, err := tp.GetById(tp.CommodityDecorator)(tm.Id())
+	if err != nil {
+		t.Fatalf("Failed to get shop template: %v", err)
+	}
+	got := make(map[uint32]commodities.Model)
+	for _, c := range stored.Commodities() {
+		got[c.TemplateId()] = c
+	}
+	if c, ok := got[keptTemplateId]; !ok || c.Id() != ids[keptTemplateId] {
+		t.Errorf("Expected commodity %d to keep id %s", keptTemplateId, ids[keptTemplateId])
+	}
+	if c, ok := got[repricedTemplateId]; !ok || c.Id() != ids[repricedTemplateId] || c.MesoPrice() != 25 {
+		t.Errorf("Expected commodity %d to keep id %s and be repriced to 25", repricedTemplateId, ids[repricedTemplateId])
+	}
+	if _, ok := got[removedTemplateId]; ok {
+		t.Errorf("Expected commodity %d to be removed", removedTemplateId)
+	}
+	if c, ok := got[addedTemplateId]; !ok || c.Id() == uuid.Nil {
+		t.Errorf("Expected commodity %d to be added", addedTemplateId)
+	}
+}
+
+func testGetVendors(t *testing.T, db *gorm.DB) {
+	// Test data
+	itemId := uint32(2000100)
+	otherItemId := uint32(2000101)
+
+	// Shop templates are tenant scoped, so the template and shops are managed within the same tenant
+	ctx := test.CreateTestContext()
+	processor := shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(acceptTemplateId)
+
+	tp := templates.NewProcessor(logrus.New(), ctx, db)
+	tm, err := tp.Create(templates.NewBuilder(uuid.Nil).
+		SetName("General Store").
+		SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(itemId).SetMesoPrice(300).Build(),
+		}).
+		Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+
+	shopsToCreate := []shops.Model{
+		// Sells the item itself
+		shops.NewBuilder(3001).SetName("Own").SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(itemId).SetMesoPrice(400).Build(),
+		}).Build(),
+		// Sells the item itself at a discount, undercutting the template
+		shops.NewBuilder(3002).SetName("Discounted").SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(itemId).SetMesoPrice(400).SetDiscountRate(50).Build(),
+		}).Build(),
+		// Inherits the item from the template
+		shops.NewBuilder(3003).SetName("Inheriting").SetShopTemplateId(tm.Id()).Build(),
+		// Overrides the inherited commodity with its own
+		shops.NewBuilder(3004).SetName("Overriding").SetShopTemplateId(tm.Id()).SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(itemId).SetMesoPrice(100).Build(),
+		}).Build(),
+		// Excludes the inherited item
+		shops.NewBuilder(3005).SetName("Excluding").SetShopTemplateId(tm.Id()).SetExcludedItems([]uint32{itemId}).Build(),
+		// Disabled shops sell nothing
+		shops.NewBuilder(3006).SetName("Disabled").SetEnabled(false).SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(itemId).SetMesoPrice(1).Build(),
+		}).Build(),
+		// Sells a different item
+		shops.NewBuilder(3007).SetName("Other").SetCommodities([]commodities.Model{
+			(&commodities.ModelBuilder{}).SetTemplateId(otherItemId).SetMesoPrice(1).Build(),
+		}).Build(),
+	}
+	for _, s := range shopsToCreate {
+		if _, err = processor.CreateShop(s); err != nil {
+			t.Fatalf("Failed to create shop: %v", err)
+		}
+	}
+
+	vendors, err := processor.GetVendors(itemId)
+	if err != nil {
+		t.Fatalf("Failed to get vendors: %v", err)
+	}
+	expected := []struct {
+		npcId     uint32
+		price     uint32
+		inherited bool
+	}{
+		{3004, 100, false},
+		{3002, 200, false},
+		{3003, 300, true},
+		{3001, 400, false},
+	}
+	if len(vendors) != len(expected) {
+		t.Fatalf("Expected %d vendors, got %d", len(expected), len(vendors))
+	}
+	for i, e := range expected {
+		c := vendors[i].Commodity()
+		if vendors[i].NpcId() != e.npcId || c.EffectiveMesoPrice() != e.price || c.Inherited() != e.inherited {
+			t.Errorf("Expected vendor %d to be (%d, %d, %v), got (%d, %d, %v)", i, e.npcId, e.price, e.inherited, vendors[i].NpcId(), c.EffectiveMesoPrice(), c.Inherited())
+		}
+		if c.NpcId() != e.npcId || c.TemplateId() != itemId {
+			t.Errorf("Expected vendor %d commodity to belong to NPC %d and sell %d, got %d and %d", i, e.npcId, itemId, c.NpcId(), c.TemplateId())
+		}
+	}
+
+	// Items nobody sells have no vendors
+	vendors, err = processor.GetVendors(2000199)
+	if err != nil {
+		t.Fatalf("Failed to get vendors: %v", err)
+	}
+	if len(vendors) != 0 {
+		t.Errorf("Expected no vendors, got %d", len(vendors))
+	}
+}
+
+func testAvailableToDecorator(t *testing.T, processor shops.Processor) {
+	// A shop selling an unrestricted item, a warrior/thief item and a female-only item
+	shop := shops.NewBuilder(2020).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(1302000).SetJobMask(commodities.JobFamilyWarrior | commodities.JobFamilyThief).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(1051000).SetGender(commodities.GenderFemale).Build(),
+	}).Build()
+
+	tests := []struct {
+		name     string
+		jobId    uint16
+		gender   byte
+		expected []uint32
+	}{
+		{"male beginner", 0, 0, []uint32{2000000}},
+		{"male fighter", 110, 0, []uint32{2000000, 1302000}},
+		{"female assassin", 410, 1, []uint32{2000000, 1302000, 1051000}},
+		{"female dawn warrior", 1110, 1, []uint32{2000000, 1302000, 1051000}},
+		{"male magician", 200, 0, []uint32{2000000}},
+		{"female gm", 900, 1, []uint32{2000000, 1051000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := character.NewModelBuilder().SetJobId(tt.jobId).SetGender(tt.gender).Build()
+			result := processor.AvailableToDecorator(c)(shop)
+			if len(result.Commodities()) != len(tt.expected) {
+				t.Fatalf("Expected %d commodities, got %d", len(tt.expected), len(result.Commodities()))
+			}
+			for i, templateId := range tt.expected {
+				if result.Commodities()[i].TemplateId() != templateId {
+					t.Errorf("Expected commodity %d to be item %d, got %d", i, templateId, result.Commodities()[i].TemplateId())
+				}
+			}
+		})
+	}
+}
+
+// newQuestService starts an HTTP stand-in for the quest service, serving the given quest states for a character.
+func newQuestService(t *testing.T, characterId uint32, states map[uint32]byte, status int) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/characters/%d/quests", characterId) || status != http.StatusOK {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data := ""
+		for questId, state := range states {
+			if data != "" {
+				data += ","
+			}
+			data += fmt.Sprintf(`{"type":"quests","id":"%d","attributes":{"state":%d}}`, questId, state)
+		}
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		_, _ = fmt.Fprintf(w, `{"data":[%s]}`, data)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("QUESTS_BASE_URL", srv.URL+"/")
+	t.Setenv("BASE_SERVICE_URL", srv.URL+"/")
+}
+
+func testQuestGatedCommodities(t *testing.T, processor shops.Processor) {
+	characterId := uint32(5000)
+	completedQuestId := uint32(1000)
+	startedQuestId := uint32(2000)
+
+	// A shop selling an ungated item, an item requiring a completed quest and an item requiring a started quest
+	shop := shops.NewBuilder(2030).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2030000).SetQuestId(completedQuestId).SetQuestState(2).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(4031000).SetQuestId(startedQuestId).SetQuestState(1).Build(),
+	}).Build()
+	c := character.NewModelBuilder().SetId(characterId).Build()
+
+	tests := []struct {
+		name     string
+		states   map[uint32]byte
+		status   int
+		expected []uint32
+	}{
+		{"no quest progress", map[uint32]byte{}, http.StatusOK, []uint32{2000000}},
+		{"completed quest", map[uint32]byte{completedQuestId: 2}, http.StatusOK, []uint32{2000000, 2030000}},
+		{"started and completed quests", map[uint32]byte{completedQuestId: 2, startedQuestId: 1}, http.StatusOK, []uint32{2000000, 2030000, 4031000}},
+		{"quest started but not completed", map[uint32]byte{completedQuestId: 1, startedQuestId: 2}, http.StatusOK, []uint32{2000000}},
+		{"quest service unavailable", map[uint32]byte{completedQuestId: 2}, http.StatusInternalServerError, []uint32{2000000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newQuestService(t, characterId, tt.states, tt.status)
+
+			result := processor.AvailableToDecorator(c)(shop)
+			if len(result.Commodities()) != len(tt.expected) {
+				t.Fatalf("Expected %d commodities, got %d", len(tt.expected), len(result.Commodities()))
+			}
+			for i, templateId := range tt.expected {
+				if result.Commodities()[i].TemplateId() != templateId {
+					t.Errorf("Expected commodity %d to be item %d, got %d", i, templateId, result.Commodities()[i].TemplateId())
+				}
+			}
+		})
+	}
+}
+
+func testRestoreDeleted(t *testing.T, processor shops.Processor, db *gorm.DB) {
+	npcId := uint32(2040)
+	commodity, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build())
+	if err != nil {
+		t.Fatalf("Failed to create test commodity: %v", err)
+	}
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	removed, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(2000001).SetMesoPrice(50).Build())
+	if err != nil {
+		t.Fatalf("Failed to create test commodity: %v", err)
+	}
+	if err = processor.RemoveCommodity(removed.Id()); err != nil {
+		t.Fatalf("Failed to remove commodity: %v", err)
+	}
+
+	// Soft-delete every shop and commodity
+	if err = processor.DeleteAllShops(); err != nil {
+		t.Fatalf("Failed to delete all shops: %v", err)
+	}
+
+	// Verify the shop is listed as deleted
+	ds, err := processor.GetDeletedShops()
+	if err != nil {
+		t.Fatalf("Failed to get deleted shops: %v", err)
+	}
+	var deleted *shops.DeletedModel
+	for i := range ds {
+		if s := ds[i].Shop(); s.NpcId() == npcId {
+			deleted = &ds[i]
+		}
+	}
+	if deleted == nil {
+		t.Fatalf("Expected shop %d to be listed as deleted", npcId)
+	}
+
+	// Restore the shop, which restores the commodities deleted with it but not those removed before
+	if _, err = processor.RestoreShop(deleted.Id()); err != nil {
+		t.Fatalf("Failed to restore shop: %v", err)
+	}
+	shop, err := processor.GetByNpcId(processor.CommodityDecorator)(npcId)
+	if err != nil {
+		t.Fatalf("Expected shop %d to be restored, got %v", npcId, err)
+	}
+	if len(shop.Commodities()) != 1 || shop.Commodities()[0].Id() != commodity.Id() {
+		t.Errorf("Expected the restored shop to sell only commodity %s, got %v", commodity.Id(), shop.Commodities())
+	}
+	if _, err = processor.RestoreShop(deleted.Id()); !errors.Is(err, shops.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound restoring an active shop, got %v", err)
+	}
+	if _, err = processor.RestoreCommodity(commodity.Id()); !errors.Is(err, commodities.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound restoring a commodity restored with its shop, got %v", err)
+	}
+	restored, err := processor.RestoreCommodity(removed.Id())
+	if err != nil {
+		t.Fatalf("Failed to restore commodity: %v", err)
+	}
+	if restored.TemplateId() != removed.TemplateId() {
+		t.Errorf("Expected restored commodity template %d, got %d", removed.TemplateId(), restored.TemplateId())
+	}
+
+	// Purge everything still deleted
+	if _, err = processor.PurgeDeleted(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to purge deleted shops: %v", err)
+	}
+	var count int64
+	if err = db.Unscoped().Model(&shops.Entity{}).Where("deleted_at IS NOT NULL").Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count deleted shop entities: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no deleted shop entities after purge, got %d", count)
+	}
+	if _, err = processor.GetByNpcId()(npcId); err != nil {
+		t.Errorf("Expected restored shop %d to survive the purge, got %v", npcId, err)
+	}
+}
+
+func testRestoreAsOf(t *testing.T, processor shops.Processor, db *gorm.DB) {
+	keptNpcId := uint32(2050)
+	newNpcId := uint32(2051)
+	commodity, err := processor.AddCommodity(keptNpcId, (&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build())
+	if err != nil {
+		t.Fatalf("Failed to create test commodity: %v", err)
+	}
+	_, err = processor.CreateShop(shops.NewBuilder(keptNpcId).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	// Change the tenant's shops after the restore point
+	if err = processor.RemoveCommodity(commodity.Id()); err != nil {
+		t.Fatalf("Failed to remove commodity: %v", err)
+	}
+	_, err = processor.CreateShop(shops.NewBuilder(newNpcId).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	if err = processor.RestoreAsOf(asOf); err != nil {
+		t.Fatalf("Failed to restore as of %s: %v", asOf, err)
+	}
+
+	// Verify the removed commodity is back and the new shop is gone
+	var count int64
+	if err = db.Model(&commodities.Entity{}).Where("npc_id = ?", keptNpcId).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count commodity entities: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 commodity for shop %d, got %d", keptNpcId, count)
+	}
+	if _, err = processor.GetByNpcId()(newNpcId); !errors.Is(err, shops.ErrNotFound) {
+		t.Errorf("Expected shop %d created after the restore point to be deleted, got %v", newNpcId, err)
+	}
+}
+
+func testRestoreAsOfRecreated(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2065)
+	processor := shops.NewProcessor(logrus.New(), test.CreateTestContext(), db).WithTemplateValidator(acceptTemplateId)
+	_, err := processor.CreateShop(shops.NewBuilder(npcId).SetName("Original").Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	// Delete the shop and create another for the same NPC after the restore point
+	if err = processor.DeleteAllShops(); err != nil {
+		t.Fatalf("Failed to delete shops: %v", err)
+	}
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).SetName("Replacement").Build())
+	if err != nil {
+		t.Fatalf("Failed to recreate shop: %v", err)
+	}
+
+	if err = processor.RestoreAsOf(asOf); err != nil {
+		t.Fatalf("Failed to restore as of %s: %v", asOf, err)
+	}
+
+	// Verify the NPC has the shop it had at the restore point, and only that one
+	shop, err := processor.GetByNpcId()(npcId)
+	if err != nil {
+		t.Fatalf("Failed to get shop by NPC ID: %v", err)
+	}
+	if shop.Name() != "Original" {
+		t.Errorf("Expected the shop at the restore point to be restored, got [%s]", shop.Name())
+	}
+	var count int64
+	if err = db.Model(&shops.Entity{}).Where("npc_id = ?", npcId).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count shop entities: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 shop for NPC %d, got %d", npcId, count)
+	}
+}
+
+func testCommodityValidation(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2045)
+	unknownTemplateId := uint32(2999999)
+	cashTemplateId := uint32(5000000)
+
+	t.Setenv(shops.EnvRejectCashItems, "true")
+	processor := shops.NewProcessor(logrus.New(), test.CreateTestContext(), db).WithTemplateValidator(func(templateId uint32) error {
+		if templateId == unknownTemplateId {
+			return fmt.Errorf("%w [%d]", commodities.ErrUnknownTemplate, templateId)
+		}
+		return nil
+	})
+
+	// Unknown items are rejected when added individually
+	_, err := processor.AddCommodity(npcId, (&commodities.ModelBuilder{}).SetTemplateId(unknownTemplateId).SetMesoPrice(100).Build())
+	if !errors.Is(err, shops.ErrInvalidCommodity) || !errors.Is(err, commodities.ErrUnknownTemplate) {
+		t.Errorf("Expected ErrInvalidCommodity for an unknown template, got %v", err)
+	}
+
+	// Every rejected commodity of a shop is reported, and nothing is written
+	_, err = processor.CreateShop(shops.NewBuilder(npcId).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(unknownTemplateId).SetMesoPrice(50).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(cashTemplateId).SetMesoPrice(50).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(cashTemplateId).SetTokenTemplateId(4000000).SetTokenPrice(5).Build(),
+		(&commodities.ModelBuilder{}).SetTemplateId(2000001).SetTokenTemplateId(unknownTemplateId).SetTokenPrice(5).Build(),
+	}).Build())
+	var ces shops.CommodityErrors
+	if !errors.As(err, &ces) {
+		t.Fatalf("Expected CommodityErrors, got %v", err)
+	}
+	expected := []struct {
+		index     int
+		attribute string
+		err       error
+	}{
+		{1, "templateId", commodities.ErrUnknownTemplate},
+		{2, "templateId", shops.ErrCashItem},
+		{4, "tokenTemplateId", commodities.ErrUnknownTemplate},
+	}
+	if len(ces) != len(expected) {
+		t.Fatalf("Expected %d rejected commodities, got %v", len(expected), ces)
+	}
+	for i, e := range expected {
+		if ces[i].Index != e.index || ces[i].Attribute != e.attribute || !errors.Is(ces[i], e.err) {
+			t.Errorf("Expected commodity %d to be rejected for %s (%v), got %v", e.index, e.attribute, e.err, ces[i])
+		}
+	}
+	var count int64
+	db.Model(&commodities.Entity{}).Where("npc_id = ?", npcId).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no commodities to be written, got %d", count)
+	}
+
+	// Commodities of a shop template are held to the same checks
+	_, err = processor.CreateShopTemplate(templates.NewBuilder(uuid.Nil).SetName("Rejected Template").SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(unknownTemplateId).SetMesoPrice(50).Build(),
+	}).Build())
+	if !errors.As(err, &ces) || len(ces) != 1 || !errors.Is(ces[0], commodities.ErrUnknownTemplate) {
+		t.Errorf("Expected an unknown template to be rejected creating a shop template, got %v", err)
+	}
+	db.Model(&templates.Entity{}).Where("name = ?", "Rejected Template").Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no shop template to be written, got %d", count)
+	}
+
+	tm, err := processor.CreateShopTemplate(templates.NewBuilder(uuid.Nil).SetName("Validated Template").SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(2000000).SetMesoPrice(50).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop template: %v", err)
+	}
+	_, err = processor.UpdateShopTemplate(templates.Clone(tm).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(cashTemplateId).SetMesoPrice(50).Build(),
+	}).Build())
+	if !errors.As(err, &ces) || len(ces) != 1 || !errors.Is(ces[0], shops.ErrCashItem) {
+		t.Errorf("Expected a cash item to be rejected updating a shop template, got %v", err)
+	}
+	db.Model(&templates.CommodityEntity{}).Where("shop_template_id = ? AND template_id = ?", tm.Id(), cashTemplateId).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the shop template commodities to be unchanged, got %d cash items", count)
+	}
+}
+
+func testArbitrage(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2050)
+	potionId := uint32(2000000)
+	elixirId := uint32(2000004)
+	swordId := uint32(1302000)
+
+	// Stands in for the item data of the data service
+	sellPrices := map[uint32]uint32{potionId: 25, elixirId: 1500, swordId: 600}
+	sellPrice := func(templateId uint32) (uint32, error) {
+		return sellPrices[templateId], nil
+	}
+
+	processor := shops.NewProcessor(logrus.New(), test.CreateTestContext(), db).WithTemplateValidator(acceptTemplateId)
+	processor.(*shops.ProcessorImpl).SellPriceFn = sellPrice
+	_, err := processor.CreateShop(shops.NewBuilder(npcId).SetCommodities([]commodities.Model{
+		// Priced above the sell price
+		(&commodities.ModelBuilder{}).SetTemplateId(potionId).SetMesoPrice(50).Build(),
+		// Priced below the sell price once discounted
+		(&commodities.ModelBuilder{}).SetTemplateId(elixirId).SetMesoPrice(2000).SetDiscountRate(50).Build(),
+		// Priced below the sell price
+		(&commodities.ModelBuilder{}).SetTemplateId(swordId).SetMesoPrice(500).Build(),
+		// Sold only for tokens
+		(&commodities.ModelBuilder{}).SetTemplateId(swordId).SetTokenTemplateId(4000000).SetTokenPrice(1).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	// Profitable loops are reported, most profitable first
+	as, err := processor.GetArbitrage()
+	if err != nil {
+		t.Fatalf("Failed to scan for arbitrage: %v", err)
+	}
+	expected := []struct {
+		templateId uint32
+		profit     uint32
+	}{
+		{elixirId, 500},
+		{swordId, 100},
+	}
+	if len(as) != len(expected) {
+		t.Fatalf("Expected %d arbitrage loops, got %d", len(expected), len(as))
+	}
+	for i, e := range expected {
+		if as[i].NpcId() != npcId || as[i].TemplateId() != e.templateId || as[i].Profit() != e.profit {
+			t.Errorf("Expected loop %d to be item %d for %d profit, got item %d for %d profit", i, e.templateId, e.profit, as[i].TemplateId(), as[i].Profit())
+		}
+	}
+
+	// When blocking, commodities sold below their sell price are rejected on write
+	t.Setenv(shops.EnvBlockArbitrage, "true")
+	processor = shops.NewProcessor(logrus.New(), test.CreateTestContext(), db).WithTemplateValidator(acceptTemplateId)
+	processor.(*shops.ProcessorImpl).SellPriceFn = sellPrice
+	_, err = processor.AddCommodity(npcId+1, (&commodities.ModelBuilder{}).SetTemplateId(swordId).SetMesoPrice(500).Build())
+	if !errors.Is(err, shops.ErrInvalidCommodity) || !errors.Is(err, shops.ErrArbitrage) {
+		t.Errorf("Expected ErrArbitrage for a commodity sold below its sell price, got %v", err)
+	}
+	if _, err = processor.AddCommodity(npcId+1, (&commodities.ModelBuilder{}).SetTemplateId(swordId).SetMesoPrice(600).Build()); err != nil {
+		t.Errorf("Expected a commodity sold at its sell price to be accepted, got %v", err)
+	}
+}
+
+// shopFloor is a processor whose character service, character and compartment requests, and Kafka producer are stood
+// in for, recording the meso it charges, the items it creates and the status events it emits.
+// shopFloor stands in for the services a character's shop commands reach: the character service, the compartment
+// service and the Kafka producer.
+type shopFloor struct {
+	processor  shops.Processor
+	characters []character.Model
+	chargeErr  error
+	charged    []int32
+	created    []uint32
+	events     []shops2.StatusEvent[shops2.StatusEventErrorBody]
+}
+
+func newShopFloor(ctx context.Context, db *gorm.DB, characters ...character.Model) *shopFloor {
+	f := &shopFloor{characters: characters}
+	p := shops.NewProcessor(logrus.New(), ctx, db).WithTemplateValidator(acceptTemplateId).(*shops.ProcessorImpl).
+		WithCharacterProcessor(f).
+		WithCompartmentProcessor(f).
+		WithProducer(f.producer)
+	p.RechargeableConsumablesDecoratorFn = func(m shops.Model) shops.Model {
+		return m
+	}
+	f.processor = p
+	return f
+}
+
+func (f *shopFloor) GetById(_ ...model.Decorator[character.Model]) func(characterId uint32) (character.Model, error) {
+	return func(characterId uint32) (character.Model, error) {
+		for _, c := range f.characters {
+			if c.Id() == characterId {
+				return c, nil
+			}
+		}
+		return character.Model{}, errors.New("character not found")
+	}
+}
+
+func (f *shopFloor) ByNameProvider(_ ...model.Decorator[character.Model]) func(name string) model.Provider[[]character.Model] {
+	return func(name string) model.Provider[[]character.Model] {
+		return model.FixedProvider([]character.Model{})
+	}
+}
+
+func (f *shopFloor) GetByName(_ ...model.Decorator[character.Model]) func(name string) (character.Model, error) {
+	return func(name string) (character.Model, error) {
+		return character.Model{}, errors.New("character not found")
+	}
+}
+
+func (f *shopFloor) IdByNameProvider(name string) model.Provider[uint32] {
+	return model.ErrorProvider[uint32](errors.New("character not found"))
+}
+
+func (f *shopFloor) InventoryDecorator(m character.Model) character.Model {
+	return m
+}
+
+func (f *shopFloor) RequestChangeMeso(_ world.Id, _ uint32, _ uint32, _ string, amount int32) error {
+	if f.chargeErr != nil {
+		return f.chargeErr
+	}
+	f.charged = append(f.charged, amount)
+	return nil
+}
+
+func (f *shopFloor) RequestCreateItem(_ uint32, templateId uint32, _ uint32) error {
+	f.created = append(f.created, templateId)
+	return nil
+}
+
+func (f *shopFloor) RequestDestroyItem(_ uint32, _ inventory.Type, _ int16, _ uint32) error {
+	return nil
+}
+
+func (f *shopFloor) RequestRechargeItem(_ uint32, _ inventory.Type, _ int16, _ uint32) error {
+	return nil
+}
+
+// producer records the status events emitted to characters.
+func (f *shopFloor) producer(token string) producer.MessageProducer {
+	return func(provider model.Provider[[]kafka.Message]) error {
+		ms, err := provider()
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			var e shops2.StatusEvent[shops2.StatusEventErrorBody]
+			if token == shops2.EnvStatusEventTopic && json.Unmarshal(m.Value, &e) == nil {
+				f.events = append(f.events, e)
+			}
+		}
+		return nil
+	}
+}
+
+// operationCount scrapes the number of shop operations counted with the given labels.
+func operationCount(t *testing.T, operation string, outcome string, code string) float64 {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	series := fmt.Sprintf(`atlas_npc_shop_operations_total{code="%s",operation="%s",outcome="%s"} `, code, operation, outcome)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, series); ok {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatalf("Failed to parse metric [%s]: %v", line, err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// lastEvent returns the type and error code of the last status event emitted, and clears the recorded events.
+func (f *shopFloor) lastEvent() (string, string) {
+	if len(f.events) == 0 {
+		return "", ""
+	}
+	e := f.events[len(f.events)-1]
+	f.events = nil
+	return e.Type, e.Body.Error
+}
+
+func testBuy(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2060)
+	potionId := uint32(2000000)
+	c := character.NewModelBuilder().SetId(6000).SetMeso(1000).Build()
+
+	f := newShopFloor(test.CreateTestContext(), db, c)
+	_, err := f.processor.CreateShop(shops.NewBuilder(npcId).SetCommodities([]commodities.Model{
+		(&commodities.ModelBuilder{}).SetTemplateId(potionId).SetMesoPrice(100).SetSlotMax(100).Build(),
+	}).Build())
+	if err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	if err = f.processor.EnterAndEmit(c.Id(), npcId); err != nil {
+		t.Fatalf("Failed to enter shop: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != shops2.StatusEventTypeEntered {
+		t.Fatalf("Expected an ENTERED event, got [%s]", typ)
+	}
+
+	price := uint32(100)
+
+	// The character is charged the price of the commodity
+	if err = f.processor.BuyAndEmit(c.Id(), 0, potionId, 4, 0); err != nil {
+		t.Fatalf("Failed to buy: %v", err)
+	}
+	if len(f.charged) != 1 || f.charged[0] != -int32(price*4) {
+		t.Errorf("Expected to be charged [%d], got %v", -int32(price*4), f.charged)
+	}
+	if len(f.created) != 1 || f.created[0] != potionId {
+		t.Errorf("Expected item [%d] to be created, got %v", potionId, f.created)
+	}
+
+	// The character can afford as many as their meso covers at that price, and no more
+	affordable := c.Meso() / price
+	f.charged = nil
+	rejected := operationCount(t, shops.OperationBuy, metrics.OutcomeRejected, shops2.ErrorNotEnoughMoney)
+	if err = f.processor.BuyAndEmit(c.Id(), 0, potionId, affordable+1, 0); err != nil {
+		t.Fatalf("Failed to buy: %v", err)
+	}
+	if typ, code := f.lastEvent(); typ != shops2.StatusEventTypeError || code != shops2.ErrorNotEnoughMoney {
+		t.Errorf("Expected a NOT_ENOUGH_MONEY error buying more than the character can afford, got [%s] [%s]", typ, code)
+	}
+	if n := operationCount(t, shops.OperationBuy, metrics.OutcomeRejected, shops2.ErrorNotEnoughMoney); n != rejected+1 {
+		t.Errorf("Expected the rejected purchase to be counted with its error code, got %v counted, was %v", n, rejected)
+	}
+	if err = f.processor.BuyAndEmit(c.Id(), 0, potionId, affordable, 0); err != nil {
+		t.Fatalf("Failed to buy: %v", err)
+	}
+	if len(f.charged) != 1 || f.charged[0] != -int32(c.Meso()) {
+		t.Errorf("Expected to be charged [%d], got %v", -int32(c.Meso()), f.charged)
+	}
+
+	// Only the purchases the character was charged for are recorded
+	var count int64
+	if err = db.Model(&transactions.Entity{}).Where("npc_id = ?", npcId).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count transactions: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 recorded purchases, got %d", count)
+	}
+
+	// A purchase the character could not be charged for is refused, and neither fulfilled nor recorded
+	f.created = nil
+	f.chargeErr = errors.New("character service unavailable")
+	if err = f.processor.BuyAndEmit(c.Id(), 0, potionId, 1, 0); err != nil {
+		t.Fatalf("Failed to buy: %v", err)
+	}
+	if typ, code := f.lastEvent(); typ != shops2.StatusEventTypeError || code != shops2.ErrorGenericError {
+		t.Errorf("Expected a GENERIC_ERROR when the charge fails, got [%s] [%s]", typ, code)
+	}
+	if len(f.created) != 0 {
+		t.Errorf("Expected no item to be created when the charge fails, got %v", f.created)
+	}
+	if err = db.Model(&transactions.Entity{}).Where("npc_id = ?", npcId).Count(&count).Error; err != nil {
+		t.Fatalf("Failed to count transactions: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected the failed purchase to not be recorded, got %d recorded purchases", count)
+	}
+}
+
+func testIdleSessionExpiry(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2061)
+	c := character.NewModelBuilder().SetId(6001).Build()
+
+	ctx := test.CreateTestContext()
+	f := newShopFloor(ctx, db, c)
+	if _, err := f.processor.CreateShop(shops.NewBuilder(npcId).Build()); err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+	if err := f.processor.EnterAndEmit(c.Id(), npcId); err != nil {
+		t.Fatalf("Failed to enter shop: %v", err)
+	}
+	f.lastEvent()
+
+	// A character active within the idle timeout stays in the shop
+	if err := f.processor.ExpireIdleSessionsAndEmit(time.Now()); err != nil {
+		t.Fatalf("Failed to expire idle sessions: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != "" {
+		t.Errorf("Expected no event for a character which is not idle, got [%s]", typ)
+	}
+	if characters := f.processor.GetCharactersInShop(npcId); !slices.Contains(characters, c.Id()) {
+		t.Errorf("Expected character [%d] to remain in shop, got %v", c.Id(), characters)
+	}
+
+	// A character idle for longer than the timeout is removed, and told it exited
+	if err := f.processor.ExpireIdleSessionsAndEmit(time.Now().Add(shops.DefaultIdleTimeout + time.Minute)); err != nil {
+		t.Fatalf("Failed to expire idle sessions: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != shops2.StatusEventTypeExited {
+		t.Errorf("Expected an EXITED event for an idle character, got [%s]", typ)
+	}
+	if characters := f.processor.GetCharactersInShop(npcId); slices.Contains(characters, c.Id()) {
+		t.Errorf("Expected character [%d] to be removed from shop, got %v", c.Id(), characters)
+	}
+
+	// Exiting a character already removed reports nothing
+	if err := f.processor.ExitAndEmit(c.Id()); err != nil {
+		t.Fatalf("Failed to exit shop: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != "" {
+		t.Errorf("Expected no event exiting a character no longer in a shop, got [%s]", typ)
+	}
+
+	// An idle timeout of 0 disables expiry
+	t.Setenv(shops.EnvIdleTimeout, "0")
+	f = newShopFloor(ctx, db, c)
+	if err := f.processor.EnterAndEmit(c.Id(), npcId); err != nil {
+		t.Fatalf("Failed to enter shop: %v", err)
+	}
+	f.lastEvent()
+	if err := f.processor.ExpireIdleSessionsAndEmit(time.Now().Add(24 * time.Hour)); err != nil {
+		t.Fatalf("Failed to expire idle sessions: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != "" {
+		t.Errorf("Expected no event with expiry disabled, got [%s]", typ)
+	}
+	if characters := f.processor.GetCharactersInShop(npcId); !slices.Contains(characters, c.Id()) {
+		t.Errorf("Expected character [%d] to remain in shop with expiry disabled, got %v", c.Id(), characters)
+	}
+	if err := f.processor.ExitAndEmit(c.Id()); err != nil {
+		t.Fatalf("Failed to exit shop: %v", err)
+	}
+}
+
+func testForceExit(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2062)
+	otherNpcId := uint32(2063)
+	leaving := character.NewModelBuilder().SetId(6002).Build()
+	staying := character.NewModelBuilder().SetId(6003).Build()
+	elsewhere := character.NewModelBuilder().SetId(6004).Build()
+
+	ctx := test.CreateTestContext()
+	f := newShopFloor(ctx, db, leaving, staying, elsewhere)
+	for _, id := range []uint32{npcId, otherNpcId} {
+		if _, err := f.processor.CreateShop(shops.NewBuilder(id).Build()); err != nil {
+			t.Fatalf("Failed to create shop: %v", err)
+		}
+	}
+	for c, id := range map[uint32]uint32{leaving.Id(): npcId, staying.Id(): npcId, elsewhere.Id(): otherNpcId} {
+		if err := f.processor.EnterAndEmit(c, id); err != nil {
+			t.Fatalf("Failed to enter shop: %v", err)
+		}
+	}
+	f.lastEvent()
+
+	// A character in another shop is not forced out of this one
+	if err := f.processor.ExitFromShopAndEmit(npcId, elsewhere.Id()); !errors.Is(err, shops.ErrNotInShop) {
+		t.Errorf("Expected ErrNotInShop forcing out a character of another shop, got %v", err)
+	}
+	if characters := f.processor.GetCharactersInShop(otherNpcId); !slices.Contains(characters, elsewhere.Id()) {
+		t.Errorf("Expected character [%d] to remain in shop [%d], got %v", elsewhere.Id(), otherNpcId, characters)
+	}
+
+	// The REST API reports it as not found
+	t.Run("NotInShop", func(t *testing.T) {
+		ten := tenant.MustFromContext(ctx)
+		router := mux.NewRouter()
+		shops.InitResource(GetServer())(db)(router, logrus.New())
+		r := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/npcs/%d/shop/characters/%d", npcId, elsewhere.Id()), nil)
+		r.Header.Set("TENANT_ID", ten.Id().String())
+		r.Header.Set("REGION", ten.Region())
+		r.Header.Set("MAJOR_VERSION", strconv.Itoa(int(ten.MajorVersion())))
+		r.Header.Set("MINOR_VERSION", strconv.Itoa(int(ten.MinorVersion())))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d forcing out a character of another shop, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	// A character forced out is told it exited
+	if err := f.processor.ExitFromShopAndEmit(npcId, leaving.Id()); err != nil {
+		t.Fatalf("Failed to force character out of shop: %v", err)
+	}
+	if typ, _ := f.lastEvent(); typ != shops2.StatusEventTypeExited {
+		t.Errorf("Expected an EXITED event forcing a character out, got [%s]", typ)
+	}
+	if characters := f.processor.GetCharactersInShop(npcId); slices.Contains(characters, leaving.Id()) {
+		t.Errorf("Expected character [%d] to be removed from shop, got %v", leaving.Id(), characters)
+	}
+
+	// Forcing every character out empties the shop, leaving other shops as they are
+	if err := f.processor.ExitAllAndEmit(npcId); err != nil {
+		t.Fatalf("Failed to force characters out of shop: %v", err)
+	}
+	if len(f.events) != 1 || f.events[0].Type != shops2.StatusEventTypeExited || f.events[0].CharacterId != staying.Id() {
+		t.Errorf("Expected an EXITED event for character [%d], got %v", staying.Id(), f.events)
+	}
+	if characters := f.processor.GetCharactersInShop(npcId); len(characters) != 0 {
+		t.Errorf("Expected shop [%d] to be empty, got %v", npcId, characters)
+	}
+	if characters := f.processor.GetCharactersInShop(otherNpcId); !slices.Contains(characters, elsewhere.Id()) {
+		t.Errorf("Expected character [%d] to remain in shop [%d], got %v", elsewhere.Id(), otherNpcId, characters)
+	}
+	if err := f.processor.ExitAndEmit(elsewhere.Id()); err != nil {
+		t.Fatalf("Failed to exit shop: %v", err)
+	}
+}
+
+func testActivityStream(t *testing.T, db *gorm.DB) {
+	npcId := uint32(2064)
+	c := character.NewModelBuilder().SetId(6005).Build()
+
+	ctx := test.CreateTestContext()
+	f := newShopFloor(ctx, db, c)
+	if _, err := f.processor.CreateShop(shops.NewBuilder(npcId).Build()); err != nil {
+		t.Fatalf("Failed to create shop: %v", err)
+	}
+
+	router := mux.NewRouter()
+	shops.InitResource(GetServer())(db)(router, logrus.New())
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ten := tenant.MustFromContext(ctx)
+	r, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf("%s/npcs/%d/shop/activity", srv.URL, npcId), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	r.Header.Set("TENANT_ID", ten.Id().String())
+	r.Header.Set("REGION", ten.Region())
+	r.Header.Set("MAJOR_VERSION", strconv.Itoa(int(ten.MajorVersion())))
+	r.Header.Set("MINOR_VERSION", strconv.Itoa(int(ten.MinorVersion())))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Failed to open activity stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected content type [text/event-stream], got [%s]", ct)
+	}
+
+	// A command at the shop is streamed as an event named for its operation
+	if err = f.processor.EnterAndEmit(c.Id(), npcId); err != nil {
+		t.Fatalf("Failed to enter shop: %v", err)
+	}
+	defer f.processor.ExitAndEmit(c.Id())
+
+	reader := bufio.NewReader(resp.Body)
+	var event, data string
+	for event == "" || data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read activity stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	if event != shops.OperationEnter {
+		t.Errorf("Expected event [%s], got [%s]", shops.OperationEnter, event)
+	}
+	var rm shops.ActivityRestModel
+	if err = json.Unmarshal([]byte(data), &rm); err != nil {
+		t.Fatalf("Failed to decode activity [%s]: %v", data, err)
+	}
+	if rm.NpcId != npcId || rm.CharacterId != c.Id() || rm.Outcome != metrics.OutcomeSuccess {
+		t.Errorf("Expected successful enter of character [%d] at shop [%d], got %+v", c.Id(), npcId, rm)
+	}
+}
@@ -1,19 +1,35 @@
 package shops
 
 import (
+	"atlas-npc/commodities"
 	"atlas-npc/kafka/message/shops"
 	"github.com/Chronicle20/atlas-kafka/producer"
 	"github.com/Chronicle20/atlas-model/model"
 	"github.com/segmentio/kafka-go"
 )
 
-func enteredEventProvider(characterId uint32, npcId uint32) model.Provider[[]kafka.Message] {
+func enteredEventProvider(characterId uint32, npcId uint32, cms []commodities.Model) model.Provider[[]kafka.Message] {
 	key := producer.CreateKey(int(characterId))
+	ecs := make([]shops.StatusEventCommodity, 0, len(cms))
+	for _, c := range cms {
+		ecs = append(ecs, shops.StatusEventCommodity{
+			TemplateId:      c.TemplateId(),
+			MesoPrice:       c.MesoPrice(),
+			DiscountRate:    c.DiscountRate(),
+			TokenTemplateId: c.TokenTemplateId(),
+			TokenPrice:      c.TokenPrice(),
+			Period:          c.Period(),
+			LevelLimit:      c.LevelLimit(),
+			UnitPrice:       c.UnitPrice(),
+			SlotMax:         c.SlotMax(),
+		})
+	}
 	value := &shops.StatusEvent[shops.StatusEventEnteredBody]{
 		CharacterId: characterId,
 		Type:        shops.StatusEventTypeEntered,
 		Body: shops.StatusEventEnteredBody{
 			NpcTemplateId: npcId,
+			Commodities:   ecs,
 		},
 	}
 	return producer.SingleMessageProvider(key, value)
@@ -34,6 +34,86 @@ func getAllShops(tenantId uuid.UUID) database.EntityProvider[[]Entity] {
 	}
 }
 
+// scopeShops narrows a query to the shops of a tenant matching the filters of q
+func scopeShops(db *gorm.DB, tenantId uuid.UUID, q Query) *gorm.DB {
+	db = db.Model(&Entity{}).Where("tenant_id = ?", tenantId)
+	if q.Recharger != nil {
+		db = db.Where("recharger = ?", *q.Recharger)
+	}
+	if q.Enabled != nil {
+		db = db.Where("enabled = ?", *q.Enabled)
+	}
+	if q.NpcIdMin != nil {
+		db = db.Where("npc_id >= ?", *q.NpcIdMin)
+	}
+	if q.NpcIdMax != nil {
+		db = db.Where("npc_id <= ?", *q.NpcIdMax)
+	}
+	if q.ShopTemplateId != nil {
+		db = db.Where("shop_template_id = ?", *q.ShopTemplateId)
+	}
+	return db
+}
+
+// getShops returns a provider that gets the shop entities of a tenant selected by the query, in its order
+func getShops(tenantId uuid.UUID, q Query) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		tx := scopeShops(db, tenantId, q).Order(q.orderClause())
+		if q.Paged() {
+			tx = tx.Limit(q.PageSize).Offset((q.PageNumber - 1) * q.PageSize)
+		}
+		var results []Entity
+		err := tx.Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// countMatchingShops returns a provider that counts the shop entities of a tenant matching the filters of the query
+func countMatchingShops(tenantId uuid.UUID, q Query) database.EntityProvider[int64] {
+	return func(db *gorm.DB) model.Provider[int64] {
+		var count int64
+		err := scopeShops(db, tenantId, q).Count(&count).Error
+		if err != nil {
+			return model.ErrorProvider[int64](err)
+		}
+		return model.FixedProvider(count)
+	}
+}
+
+// getByNpcIds returns a provider that gets the shop entities of a tenant for the given NPCs
+func getByNpcIds(tenantId uuid.UUID, npcIds []uint32) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		if len(npcIds) == 0 {
+			return model.FixedProvider(results)
+		}
+		err := db.Where("tenant_id = ? AND npc_id IN ?", tenantId, npcIds).Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getByShopTemplateIds returns a provider that gets the shop entities of a tenant inheriting from any of the given shop
+// templates
+func getByShopTemplateIds(tenantId uuid.UUID, shopTemplateIds []uuid.UUID) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		if len(shopTemplateIds) == 0 {
+			return model.FixedProvider(results)
+		}
+		err := db.Where("tenant_id = ? AND shop_template_id IN ?", tenantId, shopTemplateIds).Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
 // existsByNpcId returns a provider that checks if a shop exists for a given NPC ID
 func existsByNpcId(tenantId uuid.UUID, npcId uint32) database.EntityProvider[bool] {
 	return func(db *gorm.DB) model.Provider[bool] {
@@ -47,3 +127,63 @@ func existsByNpcId(tenantId uuid.UUID, npcId uint32) database.EntityProvider[boo
 		return model.FixedProvider(count > 0)
 	}
 }
+
+// countShops returns a provider that counts the shop entities of a tenant
+func countShops(tenantId uuid.UUID) database.EntityProvider[int64] {
+	return func(db *gorm.DB) model.Provider[int64] {
+		var count int64
+		err := db.Model(&Entity{}).
+			Where(&Entity{TenantId: tenantId}).
+			Count(&count).Error
+		if err != nil {
+			return model.ErrorProvider[int64](err)
+		}
+		return model.FixedProvider(count)
+	}
+}
+
+// getByShopTemplateId returns a provider that gets all shop entities inheriting from a shop template
+func getByShopTemplateId(tenantId uuid.UUID, shopTemplateId uuid.UUID) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		err := db.Where(&Entity{TenantId: tenantId, ShopTemplateId: shopTemplateId}).Order("npc_id").Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getDeleted returns a provider that gets all soft-deleted shop entities for a tenant, most recently deleted first
+func getDeleted(tenantId uuid.UUID) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		err := db.Unscoped().
+			Where("tenant_id = ?", tenantId).
+			Where("deleted_at IS NOT NULL").
+			Order("deleted_at DESC").
+			Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getDeletedById returns a provider that gets a soft-deleted shop entity by id
+func getDeletedById(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		var result Entity
+		err := db.Unscoped().
+			Where("tenant_id = ? AND id = ?", tenantId, id).
+			Where("deleted_at IS NOT NULL").
+			First(&result).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return model.ErrorProvider[Entity](ErrNotFound)
+			}
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(result)
+	}
+}
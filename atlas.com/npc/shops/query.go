@@ -0,0 +1,127 @@
+package shops
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidQuery = errors.New("invalid shop query")
+
+// MaxPageSize bounds the number of shops returned in a page.
+const MaxPageSize = 500
+
+// DefaultPageSize is the number of shops in a page when the page size is not given.
+const DefaultPageSize = 50
+
+// sortColumns maps the attributes shops may be sorted by to their columns.
+var sortColumns = map[string]string{
+	"npcId":     "npc_id",
+	"name":      "name",
+	"recharger": "recharger",
+	"enabled":   "enabled",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+// SortField orders shops by an attribute.
+type SortField struct {
+	Attribute  string
+	Descending bool
+}
+
+// Query selects a page of a tenant's shops. Nil filters and a zero page size do not restrict.
+type Query struct {
+	Recharger      *bool
+	Enabled        *bool
+	NpcIdMin       *uint32
+	NpcIdMax       *uint32
+	ShopTemplateId *uuid.UUID
+	Sort           []SortField
+	PageNumber     int
+	PageSize       int
+}
+
+// Paged reports whether the query selects a page rather than every matching shop.
+func (q Query) Paged() bool {
+	return q.PageSize > 0
+}
+
+// orderClause renders the sort order of the query, falling back to NPC id to keep pages stable.
+func (q Query) orderClause() string {
+	parts := make([]string, 0, len(q.Sort)+1)
+	byNpcId := false
+	for _, s := range q.Sort {
+		column := sortColumns[s.Attribute]
+		if column == "npc_id" {
+			byNpcId = true
+		}
+		if s.Descending {
+			column += " DESC"
+		}
+		parts = append(parts, column)
+	}
+	if !byNpcId {
+		parts = append(parts, "npc_id")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseSort parses a JSON:API sort parameter, a comma separated list of attributes each optionally prefixed with - for
+// descending order.
+func ParseSort(sort string) ([]SortField, error) {
+	fields := make([]SortField, 0)
+	if sort == "" {
+		return fields, nil
+	}
+	for _, a := range strings.Split(sort, ",") {
+		f := SortField{Attribute: strings.TrimSpace(a)}
+		if strings.HasPrefix(f.Attribute, "-") {
+			f.Attribute = f.Attribute[1:]
+			f.Descending = true
+		}
+		if _, ok := sortColumns[f.Attribute]; !ok {
+			return nil, fmt.Errorf("%w: cannot sort by [%s]", ErrInvalidQuery, f.Attribute)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// ParseNpcIdRange parses an NPC id filter, either a single id or an inclusive range `min..max` with either bound
+// optional. A range whose minimum exceeds its maximum is rejected.
+func ParseNpcIdRange(v string) (*uint32, *uint32, error) {
+	lower, upper, isRange := strings.Cut(v, "..")
+	if !isRange {
+		upper = lower
+	}
+	lo, err := parseBound(lower)
+	if err != nil {
+		return nil, nil, err
+	}
+	hi, err := parseBound(upper)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lo == nil && hi == nil {
+		return nil, nil, fmt.Errorf("%w: empty npcId range", ErrInvalidQuery)
+	}
+	if lo != nil && hi != nil && *lo > *hi {
+		return nil, nil, fmt.Errorf("%w: npcId range [%s] is reversed", ErrInvalidQuery, v)
+	}
+	return lo, hi, nil
+}
+
+func parseBound(v string) (*uint32, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid npcId [%s]", ErrInvalidQuery, v)
+	}
+	b := uint32(n)
+	return &b, nil
+}
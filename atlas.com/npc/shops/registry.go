@@ -1,60 +1,153 @@
 package shops
 
 import (
+	"atlas-npc/metrics"
+	tenant "github.com/Chronicle20/atlas-tenant"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
 	"sync"
+	"time"
 )
 
-type Registry struct {
+const (
+	EnvRegistry = "SHOP_REGISTRY"
+
+	// RegistryMemory keeps shop sessions in the memory of the process. It is the default.
+	RegistryMemory = "memory"
+	// RegistryDatabase keeps shop sessions in the database, shared by every replica and surviving restarts.
+	RegistryDatabase = "database"
+)
+
+// Registry tracks which shop each character is in. Writes report failures; reads of a backend which fails are logged
+// and treated as the character not being in a shop.
+type Registry interface {
+	// AddCharacter places the character in the shop of the NPC, leaving any shop it was in. The tenant is remembered so
+	// background tasks can rebuild a tenant context for it.
+	AddCharacter(t tenant.Model, characterId uint32, npcId uint32) error
+	// RemoveCharacter takes the character out of its shop, reporting whether it was in one. Of concurrent removals of a
+	// character, only one reports it.
+	RemoveCharacter(tenantId uuid.UUID, characterId uint32) (bool, error)
+	GetShop(tenantId uuid.UUID, characterId uint32) (uint32, bool)
+	GetCharactersInShop(tenantId uuid.UUID, npcId uint32) []uint32
+	// GetSessions returns every character in a shop for the tenant.
+	GetSessions(tenantId uuid.UUID) []Session
+	// GetTenants returns every tenant that has had a character enter a shop.
+	GetTenants() []tenant.Model
+	// GetOccupiedShops returns the ids of every shop with at least one character in it for the tenant.
+	GetOccupiedShops(tenantId uuid.UUID) []uint32
+	// Touch records activity of the character in its shop, postponing its expiry. Characters not in a shop are ignored.
+	Touch(tenantId uuid.UUID, characterId uint32) error
+	// GetIdleSessions returns the sessions of the tenant without activity since the given time.
+	GetIdleSessions(tenantId uuid.UUID, since time.Time) []Session
+}
+
+// Session is a character in a shop.
+type Session struct {
+	characterId  uint32
+	npcId        uint32
+	enteredAt    time.Time
+	lastActivity time.Time
+}
+
+func (s Session) CharacterId() uint32 {
+	return s.characterId
+}
+
+func (s Session) NpcId() uint32 {
+	return s.npcId
+}
+
+// EnteredAt returns when the character entered the shop.
+func (s Session) EnteredAt() time.Time {
+	return s.enteredAt
+}
+
+// LastActivity returns when the character entered the shop, or last bought, sold or recharged in it.
+func (s Session) LastActivity() time.Time {
+	return s.lastActivity
+}
+
+func registryBackend() string {
+	if b := os.Getenv(EnvRegistry); b != "" {
+		return b
+	}
+	return RegistryMemory
+}
+
+// getRegistry returns the registry selected by configuration.
+func getRegistry(l logrus.FieldLogger, db *gorm.DB) Registry {
+	if registryBackend() == RegistryDatabase {
+		return NewDatabaseRegistry(l, db)
+	}
+	return getMemoryRegistry()
+}
+
+// MemoryRegistry is a Registry local to the process. Replicas do not see each other's sessions, and sessions are lost
+// on restart.
+type MemoryRegistry struct {
 	mutex             sync.RWMutex
-	characterRegister map[uuid.UUID]map[uint32]uint32
+	tenants           map[uuid.UUID]tenant.Model
+	characterRegister map[uuid.UUID]map[uint32]Session
 	shopCharacterMap  map[uuid.UUID]map[uint32][]uint32
 }
 
-var registry *Registry
+var memoryRegistry *MemoryRegistry
 var once sync.Once
 
-func getRegistry() *Registry {
+func getMemoryRegistry() *MemoryRegistry {
 	once.Do(func() {
-		registry = &Registry{}
-		registry.characterRegister = make(map[uuid.UUID]map[uint32]uint32)
-		registry.shopCharacterMap = make(map[uuid.UUID]map[uint32][]uint32)
+		memoryRegistry = NewMemoryRegistry()
 	})
-	return registry
+	return memoryRegistry
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		tenants:           make(map[uuid.UUID]tenant.Model),
+		characterRegister: make(map[uuid.UUID]map[uint32]Session),
+		shopCharacterMap:  make(map[uuid.UUID]map[uint32][]uint32),
+	}
 }
 
-func (r *Registry) ensureTenantMaps(tenantId uuid.UUID) {
+func (r *MemoryRegistry) ensureTenantMaps(tenantId uuid.UUID) {
 	if _, ok := r.characterRegister[tenantId]; !ok {
-		r.characterRegister[tenantId] = make(map[uint32]uint32)
+		r.characterRegister[tenantId] = make(map[uint32]Session)
 	}
 	if _, ok := r.shopCharacterMap[tenantId]; !ok {
 		r.shopCharacterMap[tenantId] = make(map[uint32][]uint32)
 	}
 }
 
-func (r *Registry) AddCharacter(tenantId uuid.UUID, characterId uint32, templateId uint32) {
+func (r *MemoryRegistry) AddCharacter(t tenant.Model, characterId uint32, templateId uint32) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	tenantId := t.Id()
+	r.tenants[tenantId] = t
 	r.ensureTenantMaps(tenantId)
 
 	// If character was already in a shop, remove it from that shop's character list
-	if oldTemplateId, ok := r.characterRegister[tenantId][characterId]; ok {
-		if oldTemplateId > 0 {
-			r.removeFromShopCharacterMap(tenantId, oldTemplateId, characterId)
+	if old, ok := r.characterRegister[tenantId][characterId]; ok {
+		if old.npcId > 0 {
+			r.removeFromShopCharacterMap(tenantId, old.npcId, characterId)
 		}
 	}
 
 	// Add character to new shop
-	r.characterRegister[tenantId][characterId] = templateId
+	now := time.Now()
+	r.characterRegister[tenantId][characterId] = Session{characterId: characterId, npcId: templateId, enteredAt: now, lastActivity: now}
 
 	// Add character to shop's character list for faster lookups
 	if templateId > 0 {
 		r.addToShopCharacterMap(tenantId, templateId, characterId)
 	}
+	r.reportOccupancy(tenantId)
+	return nil
 }
 
-func (r *Registry) removeFromShopCharacterMap(tenantId uuid.UUID, shopId uint32, characterId uint32) {
+func (r *MemoryRegistry) removeFromShopCharacterMap(tenantId uuid.UUID, shopId uint32, characterId uint32) {
 	if characters, ok := r.shopCharacterMap[tenantId][shopId]; ok {
 		for i, id := range characters {
 			if id == characterId {
@@ -71,50 +164,59 @@ func (r *Registry) removeFromShopCharacterMap(tenantId uuid.UUID, shopId uint32,
 	}
 }
 
-func (r *Registry) addToShopCharacterMap(tenantId uuid.UUID, shopId uint32, characterId uint32) {
+func (r *MemoryRegistry) addToShopCharacterMap(tenantId uuid.UUID, shopId uint32, characterId uint32) {
 	if _, ok := r.shopCharacterMap[tenantId][shopId]; !ok {
 		r.shopCharacterMap[tenantId][shopId] = make([]uint32, 0)
 	}
 	r.shopCharacterMap[tenantId][shopId] = append(r.shopCharacterMap[tenantId][shopId], characterId)
 }
 
-func (r *Registry) RemoveCharacter(tenantId uuid.UUID, characterId uint32) {
+func (r *MemoryRegistry) RemoveCharacter(tenantId uuid.UUID, characterId uint32) (bool, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	r.ensureTenantMaps(tenantId)
 
 	// If character was in a shop, remove it from that shop's character list
-	if templateId, ok := r.characterRegister[tenantId][characterId]; ok {
-		if templateId > 0 {
-			r.removeFromShopCharacterMap(tenantId, templateId, characterId)
+	removed := false
+	if s, ok := r.characterRegister[tenantId][characterId]; ok {
+		if s.npcId > 0 {
+			r.removeFromShopCharacterMap(tenantId, s.npcId, characterId)
+			removed = true
 		}
 	}
 
 	// Remove character from register
 	delete(r.characterRegister[tenantId], characterId)
+	r.reportOccupancy(tenantId)
+	return removed, nil
 }
 
-func (r *Registry) GetShop(tenantId uuid.UUID, characterId uint32) (uint32, bool) {
+// reportOccupancy publishes the number of characters in a shop for the tenant
+func (r *MemoryRegistry) reportOccupancy(tenantId uuid.UUID) {
+	count := 0
+	for _, characters := range r.shopCharacterMap[tenantId] {
+		count += len(characters)
+	}
+	metrics.RegistryOccupancy(tenantId.String(), count)
+}
+
+func (r *MemoryRegistry) GetShop(tenantId uuid.UUID, characterId uint32) (uint32, bool) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	r.ensureTenantMaps(tenantId)
-
-	if tid, ok := r.characterRegister[tenantId][characterId]; ok {
-		if tid > 0 {
-			return tid, true
+	if s, ok := r.characterRegister[tenantId][characterId]; ok {
+		if s.npcId > 0 {
+			return s.npcId, true
 		}
 	}
 	return 0, false
 }
 
-func (r *Registry) GetCharactersInShop(tenantId uuid.UUID, shopId uint32) []uint32 {
+func (r *MemoryRegistry) GetCharactersInShop(tenantId uuid.UUID, shopId uint32) []uint32 {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	r.ensureTenantMaps(tenantId)
-
 	// Use the shop-character map for O(1) lookup instead of iterating through all characters
 	if characters, ok := r.shopCharacterMap[tenantId][shopId]; ok {
 		// Return a copy of the slice to prevent external modifications
@@ -125,3 +227,66 @@ func (r *Registry) GetCharactersInShop(tenantId uuid.UUID, shopId uint32) []uint
 
 	return []uint32{}
 }
+
+// GetTenants returns every tenant that has had a character enter a shop
+func (r *MemoryRegistry) GetTenants() []tenant.Model {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]tenant.Model, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		result = append(result, t)
+	}
+	return result
+}
+
+// GetOccupiedShops returns the ids of every shop with at least one character in it for the tenant
+func (r *MemoryRegistry) GetOccupiedShops(tenantId uuid.UUID) []uint32 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]uint32, 0)
+	for shopId, characters := range r.shopCharacterMap[tenantId] {
+		if len(characters) > 0 {
+			result = append(result, shopId)
+		}
+	}
+	return result
+}
+
+func (r *MemoryRegistry) Touch(tenantId uuid.UUID, characterId uint32) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if s, ok := r.characterRegister[tenantId][characterId]; ok {
+		s.lastActivity = time.Now()
+		r.characterRegister[tenantId][characterId] = s
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) GetIdleSessions(tenantId uuid.UUID, since time.Time) []Session {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]Session, 0)
+	for _, s := range r.characterRegister[tenantId] {
+		if s.npcId > 0 && s.lastActivity.Before(since) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (r *MemoryRegistry) GetSessions(tenantId uuid.UUID) []Session {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]Session, 0)
+	for _, s := range r.characterRegister[tenantId] {
+		if s.npcId > 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
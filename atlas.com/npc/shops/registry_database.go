@@ -0,0 +1,176 @@
+package shops
+
+import (
+	"atlas-npc/metrics"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// sessionEntity is a character in a shop. The tenant is stored in full so background tasks can rebuild a tenant context
+// from the sessions alone.
+type sessionEntity struct {
+	TenantId     uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_shop_sessions_tenant_npc,priority:1"`
+	CharacterId  uint32    `gorm:"primaryKey;autoIncrement:false"`
+	Region       string    `gorm:"not null"`
+	MajorVersion uint16    `gorm:"not null"`
+	MinorVersion uint16    `gorm:"not null"`
+	NpcId        uint32    `gorm:"not null;index:idx_shop_sessions_tenant_npc,priority:2"`
+	EnteredAt    time.Time `gorm:"not null"`
+	LastActivity time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (e *sessionEntity) TableName() string {
+	return "shop_sessions"
+}
+
+// DatabaseRegistry is a Registry kept in the database, so every replica sees the same sessions and they survive a
+// restart.
+type DatabaseRegistry struct {
+	l  logrus.FieldLogger
+	db *gorm.DB
+}
+
+func NewDatabaseRegistry(l logrus.FieldLogger, db *gorm.DB) *DatabaseRegistry {
+	return &DatabaseRegistry{l: l, db: db}
+}
+
+func (r *DatabaseRegistry) AddCharacter(t tenant.Model, characterId uint32, npcId uint32) error {
+	now := time.Now()
+	e := &sessionEntity{
+		TenantId:     t.Id(),
+		CharacterId:  characterId,
+		Region:       t.Region(),
+		MajorVersion: t.MajorVersion(),
+		MinorVersion: t.MinorVersion(),
+		NpcId:        npcId,
+		EnteredAt:    now,
+		LastActivity: now,
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "character_id"}},
+		UpdateAll: true,
+	}).Create(e).Error
+	if err != nil {
+		return err
+	}
+	r.reportOccupancy(t.Id())
+	return nil
+}
+
+func (r *DatabaseRegistry) RemoveCharacter(tenantId uuid.UUID, characterId uint32) (bool, error) {
+	result := r.db.Where("tenant_id = ? AND character_id = ?", tenantId, characterId).Delete(&sessionEntity{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	r.reportOccupancy(tenantId)
+	return result.RowsAffected > 0, nil
+}
+
+// reportOccupancy publishes the number of characters in a shop for the tenant, across every replica.
+func (r *DatabaseRegistry) reportOccupancy(tenantId uuid.UUID) {
+	var count int64
+	if err := r.db.Model(&sessionEntity{}).Where("tenant_id = ?", tenantId).Count(&count).Error; err != nil {
+		r.l.WithError(err).Warnf("Unable to count shop sessions of tenant [%s].", tenantId)
+		return
+	}
+	metrics.RegistryOccupancy(tenantId.String(), int(count))
+}
+
+func (r *DatabaseRegistry) GetShop(tenantId uuid.UUID, characterId uint32) (uint32, bool) {
+	var es []sessionEntity
+	err := r.db.Where("tenant_id = ? AND character_id = ?", tenantId, characterId).Limit(1).Find(&es).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the shop character [%d] is in.", characterId)
+		return 0, false
+	}
+	if len(es) == 0 || es[0].NpcId == 0 {
+		return 0, false
+	}
+	return es[0].NpcId, true
+}
+
+func (r *DatabaseRegistry) GetCharactersInShop(tenantId uuid.UUID, npcId uint32) []uint32 {
+	result := make([]uint32, 0)
+	err := r.db.Model(&sessionEntity{}).Where("tenant_id = ? AND npc_id = ?", tenantId, npcId).Pluck("character_id", &result).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the characters in shop [%d].", npcId)
+		return []uint32{}
+	}
+	return result
+}
+
+func (r *DatabaseRegistry) GetTenants() []tenant.Model {
+	var es []sessionEntity
+	err := r.db.Model(&sessionEntity{}).Distinct("tenant_id", "region", "major_version", "minor_version").Find(&es).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the tenants with shop sessions.")
+		return []tenant.Model{}
+	}
+	result := make([]tenant.Model, 0, len(es))
+	for _, e := range es {
+		t, err := tenant.Create(e.TenantId, e.Region, e.MajorVersion, e.MinorVersion)
+		if err != nil {
+			r.l.WithError(err).Errorf("Unable to rebuild tenant [%s].", e.TenantId)
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+func (r *DatabaseRegistry) GetOccupiedShops(tenantId uuid.UUID) []uint32 {
+	result := make([]uint32, 0)
+	err := r.db.Model(&sessionEntity{}).Where("tenant_id = ?", tenantId).Distinct().Pluck("npc_id", &result).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the occupied shops of tenant [%s].", tenantId)
+		return []uint32{}
+	}
+	return result
+}
+
+func (r *DatabaseRegistry) Touch(tenantId uuid.UUID, characterId uint32) error {
+	return r.db.Model(&sessionEntity{}).
+		Where("tenant_id = ? AND character_id = ?", tenantId, characterId).
+		Update("last_activity", time.Now()).Error
+}
+
+func (r *DatabaseRegistry) GetSessions(tenantId uuid.UUID) []Session {
+	var es []sessionEntity
+	err := r.db.Where("tenant_id = ? AND npc_id > 0", tenantId).Find(&es).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the shop sessions of tenant [%s].", tenantId)
+		return []Session{}
+	}
+	result := make([]Session, 0, len(es))
+	for _, e := range es {
+		result = append(result, makeSession(e))
+	}
+	return result
+}
+
+func (r *DatabaseRegistry) GetIdleSessions(tenantId uuid.UUID, since time.Time) []Session {
+	var es []sessionEntity
+	err := r.db.Where("tenant_id = ? AND npc_id > 0 AND last_activity < ?", tenantId, since).Find(&es).Error
+	if err != nil {
+		r.l.WithError(err).Errorf("Unable to retrieve the idle shop sessions of tenant [%s].", tenantId)
+		return []Session{}
+	}
+	result := make([]Session, 0, len(es))
+	for _, e := range es {
+		result = append(result, makeSession(e))
+	}
+	return result
+}
+
+func makeSession(e sessionEntity) Session {
+	return Session{
+		characterId:  e.CharacterId,
+		npcId:        e.NpcId,
+		enteredAt:    e.EnteredAt,
+		lastActivity: e.LastActivity,
+	}
+}
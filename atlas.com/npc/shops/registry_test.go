@@ -0,0 +1,127 @@
+package shops_test
+
+import (
+	"atlas-npc/shops"
+	"atlas-npc/test"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestRegistry runs the same expectations against every registry backend. The database backend runs on the in-memory
+// SQLite stand-in used by the other tests.
+func TestRegistry(t *testing.T) {
+	backends := map[string]func(t *testing.T) (shops.Registry, func()){
+		shops.RegistryMemory: func(t *testing.T) (shops.Registry, func()) {
+			return shops.NewMemoryRegistry(), func() {}
+		},
+		shops.RegistryDatabase: func(t *testing.T) (shops.Registry, func()) {
+			db := test.SetupTestDB(t, shops.Migration)
+			return shops.NewDatabaseRegistry(logrus.New(), db), func() { test.CleanupTestDB(t, db) }
+		},
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			r, cleanup := backend(t)
+			defer cleanup()
+			testRegistry(t, r)
+		})
+	}
+}
+
+func testRegistry(t *testing.T, r shops.Registry) {
+	ten := test.CreateDefaultMockTenant()
+	other := test.CreateDefaultMockTenant()
+
+	if _, ok := r.GetShop(ten.Id(), 1); ok {
+		t.Fatalf("Expected character to not be in a shop before entering.")
+	}
+
+	for _, c := range []uint32{1, 2} {
+		if err := r.AddCharacter(ten, c, 9000); err != nil {
+			t.Fatalf("Failed to add character [%d]: %v", c, err)
+		}
+	}
+	if err := r.AddCharacter(other, 1, 9001); err != nil {
+		t.Fatalf("Failed to add character to other tenant: %v", err)
+	}
+
+	if npcId, ok := r.GetShop(ten.Id(), 1); !ok || npcId != 9000 {
+		t.Errorf("Expected character to be in shop [9000], got [%d] [%t].", npcId, ok)
+	}
+	if npcId, ok := r.GetShop(other.Id(), 1); !ok || npcId != 9001 {
+		t.Errorf("Expected character of other tenant to be in shop [9001], got [%d] [%t].", npcId, ok)
+	}
+	characters := r.GetCharactersInShop(ten.Id(), 9000)
+	sort.Slice(characters, func(i, j int) bool { return characters[i] < characters[j] })
+	if len(characters) != 2 || characters[0] != 1 || characters[1] != 2 {
+		t.Errorf("Expected characters [1 2] in shop, got %v.", characters)
+	}
+	if len(r.GetTenants()) != 2 {
+		t.Errorf("Expected [2] tenants, got [%d].", len(r.GetTenants()))
+	}
+
+	// Entering another shop leaves the first
+	if err := r.AddCharacter(ten, 2, 9002); err != nil {
+		t.Fatalf("Failed to move character: %v", err)
+	}
+	if characters = r.GetCharactersInShop(ten.Id(), 9000); len(characters) != 1 || characters[0] != 1 {
+		t.Errorf("Expected characters [1] in shop, got %v.", characters)
+	}
+	occupied := r.GetOccupiedShops(ten.Id())
+	sort.Slice(occupied, func(i, j int) bool { return occupied[i] < occupied[j] })
+	if len(occupied) != 2 || occupied[0] != 9000 || occupied[1] != 9002 {
+		t.Errorf("Expected occupied shops [9000 9002], got %v.", occupied)
+	}
+
+	if removed, err := r.RemoveCharacter(ten.Id(), 1); err != nil || !removed {
+		t.Fatalf("Failed to remove character: [%t] %v", removed, err)
+	}
+	if removed, err := r.RemoveCharacter(ten.Id(), 1); err != nil || removed {
+		t.Errorf("Expected removing a character no longer in a shop to report nothing removed, got [%t] %v", removed, err)
+	}
+	if _, ok := r.GetShop(ten.Id(), 1); ok {
+		t.Errorf("Expected character to not be in a shop after exiting.")
+	}
+	if characters = r.GetCharactersInShop(ten.Id(), 9000); len(characters) != 0 {
+		t.Errorf("Expected no characters in shop, got %v.", characters)
+	}
+	if _, ok := r.GetShop(other.Id(), 1); !ok {
+		t.Errorf("Expected character of other tenant to be unaffected.")
+	}
+
+	ss := r.GetSessions(ten.Id())
+	if len(ss) != 1 || ss[0].CharacterId() != 2 || ss[0].NpcId() != 9002 || ss[0].EnteredAt().IsZero() {
+		t.Errorf("Expected a session of character [2] in shop [9002], got %v.", ss)
+	}
+
+	// Sessions are idle until touched
+	idle := r.GetIdleSessions(ten.Id(), time.Now().Add(time.Second))
+	if len(idle) != 1 || idle[0].CharacterId() != 2 || idle[0].NpcId() != 9002 {
+		t.Fatalf("Expected character [2] to be idle in shop [9002], got %v.", idle)
+	}
+	since := time.Now()
+	if err := r.Touch(ten.Id(), 2); err != nil {
+		t.Fatalf("Failed to touch session: %v", err)
+	}
+	if idle = r.GetIdleSessions(ten.Id(), since); len(idle) != 0 {
+		t.Errorf("Expected no idle sessions after activity, got %v.", idle)
+	}
+	if err := r.Touch(ten.Id(), 1); err != nil {
+		t.Errorf("Expected touching a character not in a shop to be ignored, got %v.", err)
+	}
+	if _, ok := r.GetShop(ten.Id(), 1); ok {
+		t.Errorf("Expected touching a character not in a shop to not place it in one.")
+	}
+
+	// A character registered without a shop has no session to expire
+	if err := r.AddCharacter(ten, 3, 0); err != nil {
+		t.Fatalf("Failed to add character without a shop: %v", err)
+	}
+	for _, s := range r.GetIdleSessions(ten.Id(), time.Now().Add(time.Second)) {
+		if s.CharacterId() == 3 {
+			t.Errorf("Expected a character without a shop to not be idle in one, got %v.", s)
+		}
+	}
+}
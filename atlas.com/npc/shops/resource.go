@@ -1,10 +1,14 @@
 package shops
 
 import (
+	"atlas-npc/character"
 	"atlas-npc/commodities"
 	"atlas-npc/rest"
+	"atlas-npc/templates"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Chronicle20/atlas-model/model"
 	"github.com/Chronicle20/atlas-rest/server"
 	"github.com/google/uuid"
@@ -13,6 +17,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
@@ -21,12 +28,28 @@ func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteIn
 			// Add endpoints to get and delete shops for a tenant
 			router.HandleFunc("/shops", rest.RegisterHandler(l)(db)(si)("get_all_shops", handleGetAllShops)).Methods(http.MethodGet)
 			router.HandleFunc("/shops", rest.RegisterHandler(l)(db)(si)("delete_all_shops", handleDeleteAllShops)).Methods(http.MethodDelete)
+			router.HandleFunc("/shops/arbitrage", rest.RegisterHandler(l)(db)(si)("get_shop_arbitrage", handleGetArbitrage)).Methods(http.MethodGet)
+			router.HandleFunc("/shops/sessions", rest.RegisterHandler(l)(db)(si)("get_shop_sessions", handleGetShopSessions)).Methods(http.MethodGet)
+			router.HandleFunc("/shops/deleted", rest.RegisterHandler(l)(db)(si)("get_deleted_shops", handleGetDeletedShops)).Methods(http.MethodGet)
+			router.HandleFunc("/shops/deleted", rest.RegisterHandler(l)(db)(si)("purge_deleted_shops", handlePurgeDeleted)).Methods(http.MethodDelete)
+			router.HandleFunc("/shops/deleted/{shopId}/restore", rest.RegisterHandler(l)(db)(si)("restore_shop", handleRestoreShop)).Methods(http.MethodPost)
+			router.HandleFunc("/shops/restore", rest.RegisterHandler(l)(db)(si)("restore_shops_as_of", handleRestoreAsOf)).Methods(http.MethodPost)
+			router.HandleFunc("/commodities/deleted", rest.RegisterHandler(l)(db)(si)("get_deleted_commodities", handleGetDeletedCommodities)).Methods(http.MethodGet)
+			router.HandleFunc("/commodities/deleted/{commodityId}/restore", rest.RegisterHandler(l)(db)(si)("restore_commodity", handleRestoreCommodity)).Methods(http.MethodPost)
+			router.HandleFunc("/items/{templateId}/vendors", rest.RegisterHandler(l)(db)(si)("get_item_vendors", handleGetItemVendors)).Methods(http.MethodGet)
+			router.HandleFunc("/shop-templates", rest.RegisterInputHandler[templates.RestModel](l)(db)(si)("create_shop_template", handleCreateShopTemplate)).Methods(http.MethodPost)
+			router.HandleFunc("/shop-templates/{shopTemplateId}", rest.RegisterInputHandler[templates.RestModel](l)(db)(si)("update_shop_template", handleUpdateShopTemplate)).Methods(http.MethodPut)
+			router.HandleFunc("/shop-templates/{shopTemplateId}/shops", rest.RegisterHandler(l)(db)(si)("get_shop_template_shops", handleGetShopTemplateShops)).Methods(http.MethodGet)
 
 			r := router.PathPrefix("/npcs/{npcId}/shop").Subrouter()
 			r.HandleFunc("", rest.RegisterHandler(l)(db)(si)("get_shop", handleGetShop)).Methods(http.MethodGet)
 			r.HandleFunc("", rest.RegisterInputHandler[RestModel](l)(db)(si)("create_shop", handleCreateShop)).Methods(http.MethodPost)
 			r.HandleFunc("", rest.RegisterInputHandler[RestModel](l)(db)(si)("update_shop", handleUpdateShop)).Methods(http.MethodPut)
+			r.HandleFunc("/activity", rest.RegisterHandler(l)(db)(si)("get_shop_activity", handleGetShopActivity)).Methods(http.MethodGet)
 			r.HandleFunc("/characters", rest.RegisterHandler(l)(db)(si)("get_shop_characters", handleGetShopCharacters)).Methods(http.MethodGet)
+			r.HandleFunc("/characters", rest.RegisterHandler(l)(db)(si)("exit_shop_characters", handleExitShopCharacters)).Methods(http.MethodDelete)
+			r.HandleFunc("/characters/{characterId}", rest.RegisterHandler(l)(db)(si)("exit_shop_character", handleExitShopCharacter)).Methods(http.MethodDelete)
+			r.HandleFunc("/characters/{characterId}/commodities", rest.RegisterHandler(l)(db)(si)("get_shop_character_commodities", handleGetShopCharacterCommodities)).Methods(http.MethodGet)
 
 			// Commodities are now a relationship of shops
 			r.HandleFunc("/relationships/commodities", rest.RegisterInputHandler[commodities.RestModel](l)(db)(si)("add_commodity", handleAddCommodity)).Methods(http.MethodPost)
@@ -61,6 +84,7 @@ func handleGetShop(d *rest.HandlerDependency, c *rest.HandlerContext) http.Handl
 				return
 			}
 
+			w.Header().Set("ETag", rest.ETag(shopModel.Version()))
 			query := r.URL.Query()
 			queryParams := jsonapi.ParseQueryFields(&query)
 			server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
@@ -73,58 +97,61 @@ func decoratorsFromInclude(l logrus.FieldLogger, ctx context.Context, db *gorm.D
 	includes := query["include"]
 	for _, include := range includes {
 		if include == "commodities" {
-			return model.Decorators(NewProcessor(l, ctx, db).CommodityDecorator)
+			p := NewProcessor(l, ctx, db)
+			decorators := model.Decorators(p.CommodityDecorator)
+			if c, ok := characterFromQuery(l, ctx, query.Get("characterId")); ok {
+				decorators = append(decorators, p.AvailableToDecorator(c))
+			}
+			return decorators
 		}
 	}
 	return make([]model.Decorator[Model], 0)
 }
 
-func handleAddCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i commodities.RestModel) http.HandlerFunc {
-	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			p := NewProcessor(d.Logger(), d.Context(), d.DB())
-			// Default values for new fields
-			discountRate := i.DiscountRate
-			tokenTemplateId := i.TokenTemplateId
-			tokenPrice := i.TokenPrice
-			period := i.Period
-			levelLimited := i.LevelLimit
-			commodity, err := p.AddCommodity(npcId, i.TemplateId, i.MesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
-			if err != nil {
-				d.Logger().WithError(err).Errorf("Adding commodity.")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-
-			res, err := commodities.Transform(commodity)
-			if err != nil {
-				d.Logger().WithError(err).Errorf("Creating REST model.")
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-
-			w.WriteHeader(http.StatusCreated)
-			query := r.URL.Query()
-			queryParams := jsonapi.ParseQueryFields(&query)
-			server.MarshalResponse[commodities.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
-		}
-	})
+// characterFromQuery resolves the character named by the characterId query parameter, used to restrict the
+// commodities returned to those the character may buy.
+func characterFromQuery(l logrus.FieldLogger, ctx context.Context, characterId string) (character.Model, bool) {
+	if characterId == "" {
+		return character.Model{}, false
+	}
+	id, err := strconv.ParseUint(characterId, 10, 32)
+	if err != nil {
+		l.WithError(err).Warnf("Ignoring invalid characterId [%s].", characterId)
+		return character.Model{}, false
+	}
+	c, err := character.NewProcessor(l, ctx).GetById()(uint32(id))
+	if err != nil {
+		l.WithError(err).Warnf("Unable to retrieve character [%d]. Commodities will not be filtered.", id)
+		return character.Model{}, false
+	}
+	return c, true
 }
 
-func handleUpdateCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i commodities.RestModel) http.HandlerFunc {
+func handleAddCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i commodities.RestModel) http.HandlerFunc {
 	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
-		return rest.ParseCommodityId(d.Logger(), func(commodityId uuid.UUID) http.HandlerFunc {
+		return rest.ParseIfMatch(d.Logger(), func(version uint32) http.HandlerFunc {
 			return func(w http.ResponseWriter, r *http.Request) {
-				p := NewProcessor(d.Logger(), d.Context(), d.DB())
-				// Default values for new fields
-				discountRate := i.DiscountRate
-				tokenTemplateId := i.TokenTemplateId
-				tokenPrice := i.TokenPrice
-				period := i.Period
-				levelLimited := i.LevelLimit
-				commodity, err := p.UpdateCommodity(commodityId, i.TemplateId, i.MesoPrice, discountRate, tokenTemplateId, tokenPrice, period, levelLimited)
+				p := NewProcessor(d.Logger(), d.Context(), d.DB()).WithExpectedVersion(version)
+				im, err := commodities.Extract(i)
+				if err != nil {
+					d.Logger().WithError(err).Errorf("Extracting commodity model.")
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				commodity, err := p.AddCommodity(npcId, im)
 				if err != nil {
-					d.Logger().WithError(err).Errorf("Updating commodity.")
+					if errors.Is(err, ErrVersionConflict) {
+						d.Logger().WithError(err).Errorf("Shop was changed concurrently.")
+						w.WriteHeader(http.StatusPreconditionFailed)
+						return
+					}
+					var ces CommodityErrors
+					if errors.As(err, &ces) {
+						d.Logger().WithError(err).Errorf("Rejecting commodity.")
+						rest.WriteErrors(d.Logger(), w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, false))
+						return
+					}
+					d.Logger().WithError(err).Errorf("Adding commodity.")
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
@@ -136,7 +163,7 @@ func handleUpdateCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i
 					return
 				}
 
-				w.WriteHeader(http.StatusOK)
+				w.WriteHeader(http.StatusCreated)
 				query := r.URL.Query()
 				queryParams := jsonapi.ParseQueryFields(&query)
 				server.MarshalResponse[commodities.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
@@ -145,14 +172,95 @@ func handleUpdateCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i
 	})
 }
 
+func handleUpdateCommodity(d *rest.HandlerDependency, c *rest.HandlerContext, i commodities.RestModel) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return rest.ParseCommodityId(d.Logger(), func(commodityId uuid.UUID) http.HandlerFunc {
+			return rest.ParseIfMatch(d.Logger(), func(version uint32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					p := NewProcessor(d.Logger(), d.Context(), d.DB()).WithExpectedVersion(version)
+					im, err := commodities.Extract(i)
+					if err != nil {
+						d.Logger().WithError(err).Errorf("Extracting commodity model.")
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					commodity, err := p.UpdateCommodity(commodityId, im)
+					if err != nil {
+						if errors.Is(err, ErrVersionConflict) {
+							d.Logger().WithError(err).Errorf("Shop was changed concurrently.")
+							w.WriteHeader(http.StatusPreconditionFailed)
+							return
+						}
+						var ces CommodityErrors
+						if errors.As(err, &ces) {
+							d.Logger().WithError(err).Errorf("Rejecting commodity.")
+							rest.WriteErrors(d.Logger(), w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, false))
+							return
+						}
+						d.Logger().WithError(err).Errorf("Updating commodity.")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					res, err := commodities.Transform(commodity)
+					if err != nil {
+						d.Logger().WithError(err).Errorf("Creating REST model.")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					w.WriteHeader(http.StatusOK)
+					query := r.URL.Query()
+					queryParams := jsonapi.ParseQueryFields(&query)
+					server.MarshalResponse[commodities.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+				}
+			})
+		})
+	})
+}
+
 func handleRemoveCommodity(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
 		return rest.ParseCommodityId(d.Logger(), func(commodityId uuid.UUID) http.HandlerFunc {
+			return rest.ParseIfMatch(d.Logger(), func(version uint32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					p := NewProcessor(d.Logger(), d.Context(), d.DB()).WithExpectedVersion(version)
+					err := p.RemoveCommodity(commodityId)
+					if err != nil {
+						if errors.Is(err, ErrVersionConflict) {
+							d.Logger().WithError(err).Errorf("Shop was changed concurrently.")
+							w.WriteHeader(http.StatusPreconditionFailed)
+							return
+						}
+						if errors.Is(err, commodities.ErrNotFound) {
+							w.WriteHeader(http.StatusNotFound)
+							return
+						}
+						d.Logger().WithError(err).Errorf("Removing commodity.")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					w.WriteHeader(http.StatusNoContent)
+				}
+			})
+		})
+	})
+}
+
+func handleDeleteAllCommodities(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return rest.ParseIfMatch(d.Logger(), func(version uint32) http.HandlerFunc {
 			return func(w http.ResponseWriter, r *http.Request) {
-				p := NewProcessor(d.Logger(), d.Context(), d.DB())
-				err := p.RemoveCommodity(commodityId)
+				p := NewProcessor(d.Logger(), d.Context(), d.DB()).WithExpectedVersion(version)
+				err := p.DeleteAllCommoditiesByNpcId(npcId)
 				if err != nil {
-					d.Logger().WithError(err).Errorf("Removing commodity.")
+					if errors.Is(err, ErrVersionConflict) {
+						d.Logger().WithError(err).Errorf("Shop was changed concurrently.")
+						w.WriteHeader(http.StatusPreconditionFailed)
+						return
+					}
+					d.Logger().WithError(err).Errorf("Deleting all commodities for NPC %d.", npcId)
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
@@ -163,28 +271,107 @@ func handleRemoveCommodity(d *rest.HandlerDependency, c *rest.HandlerContext) ht
 	})
 }
 
-func handleDeleteAllCommodities(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
-	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+func handleDeleteAllShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := NewProcessor(d.Logger(), d.Context(), d.DB())
+		err := p.DeleteAllShops()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Deleting all shops.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleGetDeletedShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ds, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetDeletedShops()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Getting deleted shops.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(TransformDeleted)(model.FixedProvider(ds))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]DeletedRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleRestoreShop(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseShopId(d.Logger(), func(shopId uuid.UUID) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			p := NewProcessor(d.Logger(), d.Context(), d.DB())
-			err := p.DeleteAllCommoditiesByNpcId(npcId)
+			shop, err := NewProcessor(d.Logger(), d.Context(), d.DB()).RestoreShop(shopId)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if errors.Is(err, ErrShopExists) {
+					d.Logger().WithError(err).Errorf("Restoring shop [%s].", shopId)
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				d.Logger().WithError(err).Errorf("Restoring shop [%s].", shopId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			res, err := Transform(shop)
 			if err != nil {
-				d.Logger().WithError(err).Errorf("Deleting all commodities for NPC %d.", npcId)
+				d.Logger().WithError(err).Errorf("Creating REST model.")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			w.WriteHeader(http.StatusNoContent)
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
 		}
 	})
 }
 
-func handleDeleteAllShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+func handleRestoreAsOf(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		p := NewProcessor(d.Logger(), d.Context(), d.DB())
-		err := p.DeleteAllShops()
+		asOf, err := time.Parse(time.RFC3339, r.URL.Query().Get("asOf"))
 		if err != nil {
-			d.Logger().WithError(err).Errorf("Deleting all shops.")
+			d.Logger().WithError(err).Errorf("Parsing asOf as an RFC 3339 timestamp.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = NewProcessor(d.Logger(), d.Context(), d.DB()).RestoreAsOf(asOf)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Restoring shops as of [%s].", asOf)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handlePurgeDeleted(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		retention, err := time.ParseDuration(r.URL.Query().Get("retention"))
+		if err != nil || retention < 0 {
+			d.Logger().WithError(err).Errorf("Parsing retention as a non-negative duration.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, err = NewProcessor(d.Logger(), d.Context(), d.DB()).PurgeDeleted(time.Now().Add(-retention))
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Purging deleted shops and commodities.")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -193,6 +380,110 @@ func handleDeleteAllShops(d *rest.HandlerDependency, c *rest.HandlerContext) htt
 	}
 }
 
+func handleGetDeletedCommodities(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dcs, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetDeletedCommodities()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Getting deleted commodities.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(commodities.TransformDeleted)(model.FixedProvider(dcs))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]commodities.DeletedRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleRestoreCommodity(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseCommodityId(d.Logger(), func(commodityId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			commodity, err := NewProcessor(d.Logger(), d.Context(), d.DB()).RestoreCommodity(commodityId)
+			if err != nil {
+				if errors.Is(err, commodities.ErrNotFound) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				d.Logger().WithError(err).Errorf("Restoring commodity [%s].", commodityId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			res, err := commodities.Transform(commodity)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Creating REST model.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[commodities.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+		}
+	})
+}
+
+// activityHeartbeat is how often an idle activity stream sends a comment, keeping proxies from closing it.
+const activityHeartbeat = 15 * time.Second
+
+// handleGetShopActivity streams the activity of a shop as Server-Sent Events until the client disconnects. Each event is
+// named for the operation and carries an ActivityRestModel.
+func handleGetShopActivity(d *rest.HandlerDependency, _ *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// Subscribe before the headers are sent, so a client which has received them misses no activity.
+			activities, unsubscribe := NewProcessor(d.Logger(), d.Context(), d.DB()).SubscribeActivity(npcId)
+			defer unsubscribe()
+
+			rc := http.NewResponseController(w)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			if err := rc.Flush(); err != nil {
+				d.Logger().WithError(err).Errorf("Streaming is not supported for shop [%d] activity.", npcId)
+				return
+			}
+
+			heartbeat := time.NewTicker(activityHeartbeat)
+			defer heartbeat.Stop()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-heartbeat.C:
+					if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+						return
+					}
+				case a := <-activities:
+					rm, err := TransformActivity(a)
+					if err != nil {
+						continue
+					}
+					data, err := json.Marshal(rm)
+					if err != nil {
+						d.Logger().WithError(err).Errorf("Serializing shop [%d] activity.", npcId)
+						continue
+					}
+					if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", a.Operation(), data); err != nil {
+						return
+					}
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
 func handleGetShopCharacters(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
@@ -213,14 +504,167 @@ func handleGetShopCharacters(d *rest.HandlerDependency, c *rest.HandlerContext)
 	})
 }
 
+// handleExitShopCharacters forces every character out of the shop, emitting an EXITED status event for each.
+func handleExitShopCharacters(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			err := NewProcessor(d.Logger(), d.Context(), d.DB()).ExitAllAndEmit(npcId)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Removing characters from shop [%d].", npcId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// handleExitShopCharacter forces a character out of the shop, emitting an EXITED status event.
+func handleExitShopCharacter(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return rest.ParseCharacterId(d.Logger(), func(characterId uint32) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				err := NewProcessor(d.Logger(), d.Context(), d.DB()).ExitFromShopAndEmit(npcId, characterId)
+				if err != nil {
+					if errors.Is(err, ErrNotInShop) {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					d.Logger().WithError(err).Errorf("Removing character [%d] from shop [%d].", characterId, npcId)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+		})
+	})
+}
+
+func handleGetShopSessions(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ss := NewProcessor(d.Logger(), d.Context(), d.DB()).GetSessions()
+
+		res, err := model.SliceMap(TransformSession)(model.FixedProvider(ss))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]SessionRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleGetShopCharacterCommodities(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
+		return rest.ParseCharacterId(d.Logger(), func(characterId uint32) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				views, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetCommodityViews(npcId, characterId)
+				if err != nil {
+					if errors.Is(err, ErrNotFound) || errors.Is(err, ErrCharacterNotFound) {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+
+					d.Logger().WithError(err).Errorf("Retrieving commodities of shop [%d] for character [%d].", npcId, characterId)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				res, err := model.SliceMap(TransformCommodityView)(model.FixedProvider(views))(model.ParallelMap())()
+				if err != nil {
+					d.Logger().WithError(err).Errorf("Creating REST model.")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				query := r.URL.Query()
+				queryParams := jsonapi.ParseQueryFields(&query)
+				server.MarshalResponse[[]CommodityViewRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+			}
+		})
+	})
+}
+
+// queryFromRequest builds a Query from the JSON:API page[number], page[size] and sort parameters, and the
+// filter[recharger], filter[enabled], filter[npcId] and filter[shopTemplateId] filters. The query always selects a
+// page, the first page of DefaultPageSize shops unless the request asks otherwise.
+func queryFromRequest(query url.Values) (Query, error) {
+	var q Query
+	var err error
+	if q.Sort, err = ParseSort(query.Get("sort")); err != nil {
+		return Query{}, err
+	}
+	if v := query.Get("filter[recharger]"); v != "" {
+		if q.Recharger, err = parseBoolFilter("recharger", v); err != nil {
+			return Query{}, err
+		}
+	}
+	if v := query.Get("filter[enabled]"); v != "" {
+		if q.Enabled, err = parseBoolFilter("enabled", v); err != nil {
+			return Query{}, err
+		}
+	}
+	if v := query.Get("filter[npcId]"); v != "" {
+		if q.NpcIdMin, q.NpcIdMax, err = ParseNpcIdRange(v); err != nil {
+			return Query{}, err
+		}
+	}
+	if v := query.Get("filter[shopTemplateId]"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return Query{}, fmt.Errorf("%w: invalid shopTemplateId [%s]", ErrInvalidQuery, v)
+		}
+		q.ShopTemplateId = &id
+	}
+
+	number, size := query.Get("page[number]"), query.Get("page[size]")
+	q.PageNumber, q.PageSize = 1, DefaultPageSize
+	if number != "" {
+		if q.PageNumber, err = strconv.Atoi(number); err != nil || q.PageNumber < 1 {
+			return Query{}, fmt.Errorf("%w: invalid page number [%s]", ErrInvalidQuery, number)
+		}
+	}
+	if size != "" {
+		if q.PageSize, err = strconv.Atoi(size); err != nil || q.PageSize < 1 || q.PageSize > MaxPageSize {
+			return Query{}, fmt.Errorf("%w: page size must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+		}
+	}
+	return q, nil
+}
+
+func parseBoolFilter(name string, v string) (*bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s filter [%s]", ErrInvalidQuery, name, v)
+	}
+	return &b, nil
+}
+
 func handleGetAllShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		p := NewProcessor(d.Logger(), d.Context(), d.DB())
 
-		// Get all shops using the processor
-		shops, err := p.GetAllShops(decoratorsFromInclude(d.Logger(), d.Context(), d.DB(), r)...)
+		q, err := queryFromRequest(r.URL.Query())
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Parsing shop query.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		total, err := p.CountShops(q)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Counting shops.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Get the selected shops using the processor
+		shops, err := p.GetShops(q, decoratorsFromInclude(d.Logger(), d.Context(), d.DB(), r)...)
 		if err != nil {
-			d.Logger().WithError(err).Errorf("Getting all shops.")
+			d.Logger().WithError(err).Errorf("Getting shops.")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -233,33 +677,94 @@ func handleGetAllShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.H
 			return
 		}
 
-		// Return the response
+		// Return the page, with the total and pagination links
+		rest.WritePage(d.Logger(), w, c.ServerInformation(), r.URL, rest.Page{Number: q.PageNumber, Size: q.PageSize, Total: total}, restShops)
+	}
+}
+
+func handleGetArbitrage(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		as, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetArbitrage()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Scanning shops for arbitrage.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(TransformArbitrage)(model.FixedProvider(as))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		query := r.URL.Query()
 		queryParams := jsonapi.ParseQueryFields(&query)
-		server.MarshalResponse[[]RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(restShops)
+		server.MarshalResponse[[]ArbitrageRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
 	}
 }
 
+func handleGetItemVendors(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseTemplateId(d.Logger(), func(templateId uint32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			vs, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetVendors(templateId)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Getting vendors of item [%d].", templateId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			res, err := model.SliceMap(TransformVendor)(model.FixedProvider(vs))(model.ParallelMap())()
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Creating REST models.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[[]VendorRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+		}
+	})
+}
+
 func handleCreateShop(d *rest.HandlerDependency, c *rest.HandlerContext, i RestModel) http.HandlerFunc {
 	return rest.ParseNpcId(d.Logger(), func(npcId uint32) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			p := NewProcessor(d.Logger(), d.Context(), d.DB())
 
-			// Extract commodities from the REST model
-			commodityModels := make([]commodities.Model, 0, len(i.Commodities))
-			for _, cr := range i.Commodities {
-				cm, err := commodities.Extract(cr)
-				if err != nil {
-					d.Logger().WithError(err).Errorf("Extracting commodity model.")
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
-				commodityModels = append(commodityModels, cm)
+			// Extract the shop and its commodities from the REST model
+			im, err := Extract(i)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Extracting shop model.")
+				w.WriteHeader(http.StatusBadRequest)
+				return
 			}
 
 			// Create the shop
-			shop, err := p.CreateShop(npcId, i.Recharger, commodityModels)
+			shop, err := p.CreateShop(Clone(im).SetNpcId(npcId).Build())
 			if err != nil {
+				if errors.Is(err, ErrShopExists) {
+					d.Logger().WithError(err).Errorf("Shop [%d] already exists.", npcId)
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				if errors.Is(err, ErrInvalidSchedule) {
+					d.Logger().WithError(err).Errorf("Invalid shop schedule.")
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if errors.Is(err, ErrUnknownShopTemplate) {
+					d.Logger().WithError(err).Errorf("Shop references an unknown shop template.")
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				var ces CommodityErrors
+				if errors.As(err, &ces) {
+					d.Logger().WithError(err).Errorf("Rejecting shop commodities.")
+					rest.WriteErrors(d.Logger(), w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, true))
+					return
+				}
 				d.Logger().WithError(err).Errorf("Creating shop.")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
@@ -274,6 +779,7 @@ func handleCreateShop(d *rest.HandlerDependency, c *rest.HandlerContext, i RestM
 			}
 
 			// Return the response
+			w.Header().Set("ETag", rest.ETag(shop.Version()))
 			w.WriteHeader(http.StatusCreated)
 			query := r.URL.Query()
 			queryParams := jsonapi.ParseQueryFields(&query)
@@ -287,39 +793,196 @@ func handleUpdateShop(d *rest.HandlerDependency, c *rest.HandlerContext, i RestM
 		return func(w http.ResponseWriter, r *http.Request) {
 			p := NewProcessor(d.Logger(), d.Context(), d.DB())
 
-			// Extract commodities from the REST model
-			commodityModels := make([]commodities.Model, 0, len(i.Commodities))
-			for _, cr := range i.Commodities {
-				cm, err := commodities.Extract(cr)
-				if err != nil {
-					d.Logger().WithError(err).Errorf("Extracting commodity model.")
-					w.WriteHeader(http.StatusBadRequest)
-					return
+			// Extract the shop and its commodities from the REST model
+			im, err := Extract(i)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Extracting shop model.")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			sm := Clone(im).SetNpcId(npcId).Build()
+
+			rest.ParseIfMatch(d.Logger(), func(version uint32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					vp := p.WithExpectedVersion(version)
+
+					// Report the changes the update would make, without making them
+					if r.URL.Query().Get("dryRun") == "true" {
+						diff, err := vp.DiffShop(sm)
+						if err != nil {
+							writeShopError(d.Logger(), w, err)
+							return
+						}
+						res, err := TransformDiff(diff)
+						if err != nil {
+							d.Logger().WithError(err).Errorf("Creating REST model.")
+							w.WriteHeader(http.StatusInternalServerError)
+							return
+						}
+						query := r.URL.Query()
+						queryParams := jsonapi.ParseQueryFields(&query)
+						server.MarshalResponse[DiffRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+						return
+					}
+
+					// Update the shop, provided it has not changed since the client read it
+					shop, err := vp.UpdateShop(sm)
+					if err != nil {
+						writeShopError(d.Logger(), w, err)
+						return
+					}
+
+					// Transform the shop model to a REST model
+					restShop, err := Transform(shop)
+					if err != nil {
+						d.Logger().WithError(err).Errorf("Creating REST model.")
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+
+					// Return the response
+					w.Header().Set("ETag", rest.ETag(shop.Version()))
+					w.WriteHeader(http.StatusOK)
+					query := r.URL.Query()
+					queryParams := jsonapi.ParseQueryFields(&query)
+					server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(restShop)
 				}
-				commodityModels = append(commodityModels, cm)
+			})(w, r)
+		}
+	})
+}
+
+func handleCreateShopTemplate(d *rest.HandlerDependency, c *rest.HandlerContext, i templates.RestModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		im, err := templates.Extract(i)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Extracting shop template model.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		m, err := NewProcessor(d.Logger(), d.Context(), d.DB()).CreateShopTemplate(im)
+		if err != nil {
+			var ces CommodityErrors
+			if errors.As(err, &ces) {
+				d.Logger().WithError(err).Errorf("Rejecting shop template commodities.")
+				rest.WriteErrors(d.Logger(), w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, true))
+				return
 			}
+			d.Logger().WithError(err).Errorf("Creating shop template.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-			// Update the shop
-			shop, err := p.UpdateShop(npcId, i.Recharger, commodityModels)
+		res, err := templates.Transform(m)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST model.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[templates.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleUpdateShopTemplate(d *rest.HandlerDependency, c *rest.HandlerContext, i templates.RestModel) http.HandlerFunc {
+	return rest.ParseShopTemplateId(d.Logger(), func(shopTemplateId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			im, err := templates.Extract(i)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Extracting shop template model.")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			m, err := NewProcessor(d.Logger(), d.Context(), d.DB()).UpdateShopTemplate(templates.Clone(im).SetId(shopTemplateId).Build())
 			if err != nil {
-				d.Logger().WithError(err).Errorf("Updating shop.")
+				if errors.Is(err, templates.ErrNotFound) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				var ces CommodityErrors
+				if errors.As(err, &ces) {
+					d.Logger().WithError(err).Errorf("Rejecting shop template commodities.")
+					rest.WriteErrors(d.Logger(), w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, true))
+					return
+				}
+				d.Logger().WithError(err).Errorf("Updating shop template [%s].", shopTemplateId)
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			// Transform the shop model to a REST model
-			restShop, err := Transform(shop)
+			res, err := templates.Transform(m)
 			if err != nil {
 				d.Logger().WithError(err).Errorf("Creating REST model.")
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
-			// Return the response
 			w.WriteHeader(http.StatusOK)
 			query := r.URL.Query()
 			queryParams := jsonapi.ParseQueryFields(&query)
-			server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(restShop)
+			server.MarshalResponse[templates.RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
 		}
 	})
 }
+
+func handleGetShopTemplateShops(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseShopTemplateId(d.Logger(), func(shopTemplateId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p := NewProcessor(d.Logger(), d.Context(), d.DB())
+
+			// Get all shops inheriting from the template
+			shops, err := p.GetByShopTemplateId(decoratorsFromInclude(d.Logger(), d.Context(), d.DB(), r)...)(shopTemplateId)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Getting shops for shop template [%s].", shopTemplateId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// Transform shop models to REST models
+			restShops, err := model.SliceMap(Transform)(model.FixedProvider(shops))(model.ParallelMap())()
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Creating REST models.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// Return the response
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[[]RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(restShops)
+		}
+	})
+}
+
+// writeShopError responds to a rejected shop write.
+func writeShopError(l logrus.FieldLogger, w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrVersionConflict) {
+		l.WithError(err).Errorf("Shop was changed concurrently.")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, ErrInvalidSchedule) {
+		l.WithError(err).Errorf("Invalid shop schedule.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrUnknownShopTemplate) {
+		l.WithError(err).Errorf("Shop references an unknown shop template.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var ces CommodityErrors
+	if errors.As(err, &ces) {
+		l.WithError(err).Errorf("Rejecting shop commodities.")
+		rest.WriteErrors(l, w, http.StatusUnprocessableEntity, TransformCommodityErrors(ces, true))
+		return
+	}
+	l.WithError(err).Errorf("Updating shop.")
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -2,17 +2,30 @@ package shops
 
 import (
 	"atlas-npc/commodities"
+	"atlas-npc/rest"
+	"errors"
 	"fmt"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
 	"github.com/jtumidanski/api2go/jsonapi"
 	"strconv"
+	"time"
 )
 
 // RestModel is a JSON API representation of the Model
 type RestModel struct {
-	Id          string                  `json:"id"`
-	NpcId       uint32                  `json:"npcId"`
-	Recharger   bool                    `json:"recharger"`
-	Commodities []commodities.RestModel `json:"-"` // Commodities are now a relationship, not a direct attribute
+	Id             string                  `json:"id"`
+	NpcId          uint32                  `json:"npcId"`
+	Recharger      bool                    `json:"recharger"`
+	Name           string                  `json:"name"`
+	Description    string                  `json:"description"`
+	OpensAt        string                  `json:"opensAt"`
+	ClosesAt       string                  `json:"closesAt"`
+	TimeZone       string                  `json:"timeZone"`
+	Enabled        *bool                   `json:"enabled,omitempty"` // Absent on input means enabled
+	ShopTemplateId string                  `json:"shopTemplateId"`    // Empty when the shop does not inherit from a template
+	ExcludedItems  []uint32                `json:"excludedItems"`     // Inherited item template ids the shop does not sell
+	Commodities    []commodities.RestModel `json:"-"`                 // Commodities are now a relationship, not a direct attribute
 }
 
 // GetID to satisfy jsonapi.MarshalIdentifier interface
@@ -111,11 +124,28 @@ func Transform(m Model) (RestModel, error) {
 		commodityRest = append(commodityRest, cr)
 	}
 
+	enabled := m.Enabled()
+	shopTemplateId := ""
+	if m.ShopTemplateId() != uuid.Nil {
+		shopTemplateId = m.ShopTemplateId().String()
+	}
+	excludedItems := m.ExcludedItems()
+	if excludedItems == nil {
+		excludedItems = make([]uint32, 0)
+	}
 	return RestModel{
-		Id:          fmt.Sprintf("shop-%d", m.NpcId()),
-		NpcId:       m.NpcId(),
-		Recharger:   m.Recharger(),
-		Commodities: commodityRest,
+		Id:             fmt.Sprintf("shop-%d", m.NpcId()),
+		NpcId:          m.NpcId(),
+		Recharger:      m.Recharger(),
+		Name:           m.Name(),
+		Description:    m.Description(),
+		OpensAt:        m.OpensAt(),
+		ClosesAt:       m.ClosesAt(),
+		TimeZone:       m.TimeZone(),
+		Enabled:        &enabled,
+		ShopTemplateId: shopTemplateId,
+		ExcludedItems:  excludedItems,
+		Commodities:    commodityRest,
 	}, nil
 }
 
@@ -130,9 +160,31 @@ func Extract(rm RestModel) (Model, error) {
 		commodityModels = append(commodityModels, cm)
 	}
 
+	enabled := true
+	if rm.Enabled != nil {
+		enabled = *rm.Enabled
+	}
+
+	shopTemplateId := uuid.Nil
+	if rm.ShopTemplateId != "" {
+		var err error
+		shopTemplateId, err = uuid.Parse(rm.ShopTemplateId)
+		if err != nil {
+			return Model{}, err
+		}
+	}
+
 	return NewBuilder(rm.NpcId).
 		SetCommodities(commodityModels).
 		SetRecharger(rm.Recharger).
+		SetName(rm.Name).
+		SetDescription(rm.Description).
+		SetOpensAt(rm.OpensAt).
+		SetClosesAt(rm.ClosesAt).
+		SetTimeZone(rm.TimeZone).
+		SetEnabled(enabled).
+		SetShopTemplateId(shopTemplateId).
+		SetExcludedItems(rm.ExcludedItems).
 		Build(), nil
 }
 
@@ -162,3 +214,356 @@ func TransformCharacterList(characterId uint32) (CharacterListRestModel, error)
 	idStr := strconv.Itoa(int(characterId))
 	return CharacterListRestModel{Id: idStr}, nil
 }
+
+// CommodityViewRestModel is a JSON API representation of a commodity as seen by a character
+type CommodityViewRestModel struct {
+	Id                     string  `json:"-"`
+	TemplateId             uint32  `json:"templateId"`
+	MesoPrice              uint32  `json:"mesoPrice"`
+	DiscountRate           byte    `json:"discountRate"`
+	EffectivePrice         uint32  `json:"effectivePrice"`
+	TokenTemplateId        uint32  `json:"tokenTemplateId"`
+	TokenPrice             uint32  `json:"tokenPrice"`
+	LevelLimit             uint32  `json:"levelLimit"`
+	UnitPrice              float64 `json:"unitPrice"`
+	SlotMax                uint32  `json:"slotMax"`
+	Inherited              bool    `json:"inherited"`
+	MeetsLevelRequirement  bool    `json:"meetsLevelRequirement"`
+	MeetsJobRequirement    bool    `json:"meetsJobRequirement"`
+	MeetsGenderRequirement bool    `json:"meetsGenderRequirement"`
+	MeetsQuestRequirement  bool    `json:"meetsQuestRequirement"`
+	Available              bool    `json:"available"`
+	RemainingAllowance     uint32  `json:"remainingAllowance"`
+	Affordable             bool    `json:"affordable"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r CommodityViewRestModel) GetID() string {
+	return r.Id
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r CommodityViewRestModel) GetName() string {
+	return "character-commodities"
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *CommodityViewRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// TransformCommodityView converts a CommodityView to a CommodityViewRestModel
+func TransformCommodityView(v CommodityView) (CommodityViewRestModel, error) {
+	cm := v.Commodity()
+	return CommodityViewRestModel{
+		Id:                     cm.Id().String(),
+		TemplateId:             cm.TemplateId(),
+		MesoPrice:              cm.MesoPrice(),
+		DiscountRate:           cm.DiscountRate(),
+		EffectivePrice:         v.EffectivePrice(),
+		TokenTemplateId:        cm.TokenTemplateId(),
+		TokenPrice:             cm.TokenPrice(),
+		LevelLimit:             cm.LevelLimit(),
+		UnitPrice:              cm.UnitPrice(),
+		SlotMax:                cm.SlotMax(),
+		Inherited:              cm.Inherited(),
+		MeetsLevelRequirement:  v.MeetsLevelRequirement(),
+		MeetsJobRequirement:    v.MeetsJobRequirement(),
+		MeetsGenderRequirement: v.MeetsGenderRequirement(),
+		MeetsQuestRequirement:  v.MeetsQuestRequirement(),
+		Available:              v.Available(),
+		RemainingAllowance:     v.RemainingAllowance(),
+		Affordable:             v.Affordable(),
+	}, nil
+}
+
+// DeletedRestModel is a JSON API representation of a soft-deleted shop
+type DeletedRestModel struct {
+	Id        string    `json:"-"`
+	NpcId     uint32    `json:"npcId"`
+	Name      string    `json:"name"`
+	Recharger bool      `json:"recharger"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r DeletedRestModel) GetID() string {
+	return r.Id
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r DeletedRestModel) GetName() string {
+	return "deleted-shops"
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *DeletedRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// TransformDeleted converts a DeletedModel to a DeletedRestModel
+func TransformDeleted(m DeletedModel) (DeletedRestModel, error) {
+	return DeletedRestModel{
+		Id:        m.id.String(),
+		NpcId:     m.shop.npcId,
+		Name:      m.shop.name,
+		Recharger: m.shop.recharger,
+		DeletedAt: m.deletedAt,
+	}, nil
+}
+
+// commodityErrorCode is the JSON:API error code for a rejected commodity.
+func commodityErrorCode(err error) string {
+	if errors.Is(err, ErrCashItem) {
+		return "CASH_ITEM"
+	}
+	if errors.Is(err, ErrArbitrage) {
+		return "ARBITRAGE"
+	}
+	return "UNKNOWN_TEMPLATE"
+}
+
+// TransformCommodityErrors converts rejected commodities to JSON:API error objects. Commodities of a single commodity
+// write point at the primary data, otherwise at the included commodity of the same position.
+func TransformCommodityErrors(ces CommodityErrors, included bool) []rest.ErrorObject {
+	results := make([]rest.ErrorObject, 0, len(ces))
+	for _, ce := range ces {
+		pointer := fmt.Sprintf("/data/attributes/%s", ce.Attribute)
+		if included {
+			pointer = fmt.Sprintf("/included/%d/attributes/%s", ce.Index, ce.Attribute)
+		}
+		results = append(results, rest.ErrorObject{
+			Code:   commodityErrorCode(ce.Err),
+			Title:  "Invalid commodity",
+			Detail: fmt.Sprintf("Item [%d] cannot be sold: %s.", ce.TemplateId, ce.Err),
+			Source: &rest.ErrorSource{Pointer: pointer},
+		})
+	}
+	return results
+}
+
+// DiffRestModel is a JSON API representation of the changes an update would make to a shop
+type DiffRestModel struct {
+	Id                string                     `json:"-"`
+	NpcId             uint32                     `json:"npcId"`
+	Created           bool                       `json:"created"`
+	ChangedAttributes []string                   `json:"changedAttributes"`
+	Added             []commodities.RestModel    `json:"added"`
+	Updated           []CommodityChangeRestModel `json:"updated"`
+	Removed           []commodities.RestModel    `json:"removed"`
+	Unchanged         int                        `json:"unchanged"`
+}
+
+// CommodityChangeRestModel is a JSON representation of a CommodityChange
+type CommodityChangeRestModel struct {
+	Before commodities.RestModel `json:"before"`
+	After  commodities.RestModel `json:"after"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r DiffRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *DiffRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r DiffRestModel) GetName() string {
+	return "shop-diffs"
+}
+
+// TransformDiff converts a Diff to a DiffRestModel
+func TransformDiff(d Diff) (DiffRestModel, error) {
+	added, err := model.SliceMap(commodities.Transform)(model.FixedProvider(d.Added()))(model.ParallelMap())()
+	if err != nil {
+		return DiffRestModel{}, err
+	}
+	removed, err := model.SliceMap(commodities.Transform)(model.FixedProvider(d.Removed()))(model.ParallelMap())()
+	if err != nil {
+		return DiffRestModel{}, err
+	}
+	updated := make([]CommodityChangeRestModel, 0, len(d.Updated()))
+	for _, cc := range d.Updated() {
+		before, err := commodities.Transform(cc.Before())
+		if err != nil {
+			return DiffRestModel{}, err
+		}
+		after, err := commodities.Transform(cc.After())
+		if err != nil {
+			return DiffRestModel{}, err
+		}
+		updated = append(updated, CommodityChangeRestModel{Before: before, After: after})
+	}
+	return DiffRestModel{
+		Id:                fmt.Sprintf("shop-%d", d.NpcId()),
+		NpcId:             d.NpcId(),
+		Created:           d.Created(),
+		ChangedAttributes: d.ChangedAttributes(),
+		Added:             added,
+		Updated:           updated,
+		Removed:           removed,
+		Unchanged:         len(d.Unchanged()),
+	}, nil
+}
+
+// VendorRestModel is a JSON API representation of a Vendor
+type VendorRestModel struct {
+	Id                 string `json:"-"`
+	NpcId              uint32 `json:"npcId"`
+	ShopName           string `json:"shopName"`
+	CommodityId        string `json:"commodityId"`
+	TemplateId         uint32 `json:"templateId"`
+	MesoPrice          uint32 `json:"mesoPrice"`
+	DiscountRate       byte   `json:"discountRate"`
+	EffectiveMesoPrice uint32 `json:"effectiveMesoPrice"`
+	TokenTemplateId    uint32 `json:"tokenTemplateId"`
+	TokenPrice         uint32 `json:"tokenPrice"`
+	LevelLimit         uint32 `json:"levelLimit"`
+	Inherited          bool   `json:"inherited"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r VendorRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *VendorRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r VendorRestModel) GetName() string {
+	return "vendors"
+}
+
+// TransformVendor converts a Vendor to a VendorRestModel
+func TransformVendor(v Vendor) (VendorRestModel, error) {
+	c := v.Commodity()
+	return VendorRestModel{
+		Id:                 strconv.Itoa(int(v.NpcId())),
+		NpcId:              v.NpcId(),
+		ShopName:           v.Name(),
+		CommodityId:        c.Id().String(),
+		TemplateId:         c.TemplateId(),
+		MesoPrice:          c.MesoPrice(),
+		DiscountRate:       c.DiscountRate(),
+		EffectiveMesoPrice: c.EffectiveMesoPrice(),
+		TokenTemplateId:    c.TokenTemplateId(),
+		TokenPrice:         c.TokenPrice(),
+		LevelLimit:         c.LevelLimit(),
+		Inherited:          c.Inherited(),
+	}, nil
+}
+
+// ArbitrageRestModel is a JSON API representation of an Arbitrage
+type ArbitrageRestModel struct {
+	Id                 string `json:"-"`
+	NpcId              uint32 `json:"npcId"`
+	CommodityId        string `json:"commodityId"`
+	TemplateId         uint32 `json:"templateId"`
+	Inherited          bool   `json:"inherited"`
+	EffectiveMesoPrice uint32 `json:"effectiveMesoPrice"`
+	SellPrice          uint32 `json:"sellPrice"`
+	Profit             uint32 `json:"profit"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r ArbitrageRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *ArbitrageRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r ArbitrageRestModel) GetName() string {
+	return "shop-arbitrage"
+}
+
+// TransformArbitrage converts an Arbitrage to an ArbitrageRestModel. Inherited commodities are shared by the shops of a
+// template, so the id pairs the commodity with its shop.
+func TransformArbitrage(a Arbitrage) (ArbitrageRestModel, error) {
+	return ArbitrageRestModel{
+		Id:                 fmt.Sprintf("%d-%s", a.NpcId(), a.CommodityId()),
+		NpcId:              a.NpcId(),
+		CommodityId:        a.CommodityId().String(),
+		TemplateId:         a.TemplateId(),
+		Inherited:          a.Inherited(),
+		EffectiveMesoPrice: a.EffectiveMesoPrice(),
+		SellPrice:          a.SellPrice(),
+		Profit:             a.Profit(),
+	}, nil
+}
+
+// ActivityRestModel is a JSON representation of an Activity, sent as the data of a shop activity event
+type ActivityRestModel struct {
+	NpcId       uint32    `json:"npcId"`
+	CharacterId uint32    `json:"characterId"`
+	Operation   string    `json:"operation"`
+	Outcome     string    `json:"outcome"`
+	Code        string    `json:"code,omitempty"`
+	TemplateId  uint32    `json:"templateId,omitempty"`
+	Quantity    uint32    `json:"quantity,omitempty"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
+
+// TransformActivity converts an Activity to an ActivityRestModel
+func TransformActivity(a Activity) (ActivityRestModel, error) {
+	return ActivityRestModel{
+		NpcId:       a.NpcId(),
+		CharacterId: a.CharacterId(),
+		Operation:   a.Operation(),
+		Outcome:     a.Outcome(),
+		Code:        a.Code(),
+		TemplateId:  a.TemplateId(),
+		Quantity:    a.Quantity(),
+		OccurredAt:  a.OccurredAt(),
+	}, nil
+}
+
+// SessionRestModel is a JSON API representation of a Session
+type SessionRestModel struct {
+	Id           string    `json:"-"`
+	CharacterId  uint32    `json:"characterId"`
+	NpcId        uint32    `json:"npcId"`
+	EnteredAt    time.Time `json:"enteredAt"`
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r SessionRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *SessionRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r SessionRestModel) GetName() string {
+	return "shop-sessions"
+}
+
+// TransformSession converts a Session to a SessionRestModel
+func TransformSession(s Session) (SessionRestModel, error) {
+	return SessionRestModel{
+		Id:           strconv.Itoa(int(s.CharacterId())),
+		CharacterId:  s.CharacterId(),
+		NpcId:        s.NpcId(),
+		EnteredAt:    s.EnteredAt(),
+		LastActivity: s.LastActivity(),
+	}, nil
+}
@@ -258,3 +258,24 @@ func TestShopRestModel(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractIgnoresInherited(t *testing.T) {
+	rm := shops.RestModel{
+		NpcId: 9000,
+		Commodities: []commodities.RestModel{
+			{Id: uuid.New().String(), TemplateId: 2000000, MesoPrice: 100, Inherited: true},
+		},
+	}
+
+	m, err := shops.Extract(rm)
+	if err != nil {
+		t.Fatalf("Failed to extract model from REST model: %v", err)
+	}
+	if len(m.Commodities()) != 1 {
+		t.Fatalf("Expected 1 commodity, got %d", len(m.Commodities()))
+	}
+	c := m.Commodities()[0]
+	if c.Inherited() {
+		t.Errorf("Expected the inherited attribute of the request to be ignored")
+	}
+}
@@ -0,0 +1,73 @@
+package shops
+
+import (
+	"context"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+const ClosingTaskName = "shop_closing_task"
+
+// ClosingTask ejects characters from shops which have been disabled or are outside their opening hours.
+type ClosingTask struct {
+	l        logrus.FieldLogger
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewClosingTask(l logrus.FieldLogger, db *gorm.DB, interval time.Duration) *ClosingTask {
+	return &ClosingTask{
+		l:        l.WithField("task", ClosingTaskName),
+		db:       db,
+		interval: interval,
+	}
+}
+
+func (t *ClosingTask) Run() {
+	now := time.Now()
+	for _, ten := range getRegistry(t.l, t.db).GetTenants() {
+		tctx := tenant.WithContext(context.Background(), ten)
+		err := NewProcessor(t.l, tctx, t.db).EjectFromClosedShopsAndEmit(now)
+		if err != nil {
+			t.l.WithError(err).Errorf("Unable to eject characters from closed shops for tenant [%s].", ten.Id())
+		}
+	}
+}
+
+func (t *ClosingTask) SleepTime() time.Duration {
+	return t.interval
+}
+
+const IdleSessionTaskName = "shop_idle_session_task"
+
+// IdleSessionTask expires the sessions of characters idle in a shop for longer than the idle timeout.
+type IdleSessionTask struct {
+	l        logrus.FieldLogger
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewIdleSessionTask(l logrus.FieldLogger, db *gorm.DB, interval time.Duration) *IdleSessionTask {
+	return &IdleSessionTask{
+		l:        l.WithField("task", IdleSessionTaskName),
+		db:       db,
+		interval: interval,
+	}
+}
+
+func (t *IdleSessionTask) Run() {
+	now := time.Now()
+	for _, ten := range getRegistry(t.l, t.db).GetTenants() {
+		tctx := tenant.WithContext(context.Background(), ten)
+		err := NewProcessor(t.l, tctx, t.db).ExpireIdleSessionsAndEmit(now)
+		if err != nil {
+			t.l.WithError(err).Errorf("Unable to expire idle shop sessions for tenant [%s].", ten.Id())
+		}
+	}
+}
+
+func (t *IdleSessionTask) SleepTime() time.Duration {
+	return t.interval
+}
@@ -0,0 +1,102 @@
+package shops
+
+import (
+	"atlas-npc/commodities"
+	"errors"
+	"fmt"
+	"github.com/Chronicle20/atlas-constants/inventory"
+	"github.com/Chronicle20/atlas-constants/item"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvRejectCashItems, when true, rejects cash items sold for mesos rather than tokens.
+const EnvRejectCashItems = "SHOP_REJECT_CASH_ITEMS"
+
+var ErrInvalidCommodity = errors.New("invalid commodity")
+var ErrCashItem = errors.New("cash items cannot be sold for mesos")
+
+// CommodityError describes why a commodity of a write was rejected.
+type CommodityError struct {
+	Index      int    // Position of the commodity within the write
+	TemplateId uint32 // Item template of the commodity
+	Attribute  string // Attribute at fault, templateId, tokenTemplateId or mesoPrice
+	Err        error
+}
+
+func (e CommodityError) Error() string {
+	return fmt.Sprintf("commodity [%d] %s: %s", e.Index, e.Attribute, e.Err)
+}
+
+func (e CommodityError) Unwrap() []error {
+	return []error{ErrInvalidCommodity, e.Err}
+}
+
+// CommodityErrors is every rejected commodity of a write.
+type CommodityErrors []CommodityError
+
+func (e CommodityErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, ce := range e {
+		messages = append(messages, ce.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e CommodityErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, ce := range e {
+		errs = append(errs, ce)
+	}
+	return errs
+}
+
+func rejectCashItems() bool {
+	reject, _ := strconv.ParseBool(os.Getenv(EnvRejectCashItems))
+	return reject
+}
+
+func (p *ProcessorImpl) validateTemplateId(templateId uint32) error {
+	if p.ValidateTemplateIdFn != nil {
+		return p.ValidateTemplateIdFn(templateId)
+	}
+	return p.cp.ValidateTemplateId(templateId)
+}
+
+// ValidateCommodities resolves the item and token template of each commodity through the data service, returning
+// CommodityErrors for every commodity which cannot be sold.
+func (p *ProcessorImpl) ValidateCommodities(cms []commodities.Model) error {
+	errs := make(CommodityErrors, 0)
+	for i, c := range cms {
+		if err := p.validateTemplateId(c.TemplateId()); err != nil {
+			errs = append(errs, CommodityError{Index: i, TemplateId: c.TemplateId(), Attribute: "templateId", Err: err})
+			continue
+		}
+		if c.TokenTemplateId() != 0 {
+			if err := p.validateTemplateId(c.TokenTemplateId()); err != nil {
+				errs = append(errs, CommodityError{Index: i, TemplateId: c.TemplateId(), Attribute: "tokenTemplateId", Err: err})
+			}
+			continue
+		}
+		if p.rejectCashItems {
+			if it, ok := inventory.TypeFromItemId(item.Id(c.TemplateId())); ok && it == inventory.TypeValueCash {
+				errs = append(errs, CommodityError{Index: i, TemplateId: c.TemplateId(), Attribute: "templateId", Err: ErrCashItem})
+			}
+		}
+		if p.blockArbitrage && c.MesoPrice() > 0 {
+			price, err := p.sellPrice(c.TemplateId())
+			if err != nil {
+				errs = append(errs, CommodityError{Index: i, TemplateId: c.TemplateId(), Attribute: "templateId", Err: err})
+				continue
+			}
+			if c.EffectiveMesoPrice() < price {
+				errs = append(errs, CommodityError{Index: i, TemplateId: c.TemplateId(), Attribute: "mesoPrice", Err: fmt.Errorf("%w [%d]", ErrArbitrage, price)})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package shops
+
+import (
+	"atlas-npc/commodities"
+	"github.com/google/uuid"
+	"slices"
+	"sort"
+)
+
+// Vendor is a shop offering an item, with the commodity it sells it as.
+type Vendor struct {
+	npcId     uint32
+	name      string
+	commodity commodities.Model
+}
+
+// NpcId returns the NPC of the shop
+func (v Vendor) NpcId() uint32 {
+	return v.npcId
+}
+
+// Name returns the display name of the shop
+func (v Vendor) Name() string {
+	return v.name
+}
+
+// Commodity returns the commodity the shop sells the item as, marked inherited when it comes from the shop template
+func (v Vendor) Commodity() commodities.Model {
+	return v.commodity
+}
+
+// vendorsOf builds the vendors of an item from the commodities selling it. Shops sell their own commodity for an item
+// in place of an inherited one, and sell nothing when disabled.
+func vendorsOf(templateId uint32, own []commodities.Model, ownShops map[uint32]Model, inherited map[uuid.UUID]commodities.Model, inheritingShops []Model) []Vendor {
+	results := make([]Vendor, 0, len(own)+len(inheritingShops))
+	selling := make(map[uint32]bool, len(own))
+	for _, c := range own {
+		s, ok := ownShops[c.NpcId()]
+		if !ok || !s.Enabled() {
+			continue
+		}
+		selling[c.NpcId()] = true
+		results = append(results, Vendor{npcId: s.NpcId(), name: s.Name(), commodity: c})
+	}
+	for _, s := range inheritingShops {
+		if selling[s.NpcId()] || !s.Enabled() || slices.Contains(s.ExcludedItems(), templateId) {
+			continue
+		}
+		c, ok := inherited[s.ShopTemplateId()]
+		if !ok {
+			continue
+		}
+		results = append(results, Vendor{npcId: s.NpcId(), name: s.Name(), commodity: commodities.Clone(c).SetNpcId(s.NpcId()).SetInherited(true).Build()})
+	}
+
+	// Cheapest first, by meso price after discount and then token price
+	sort.SliceStable(results, func(i, j int) bool {
+		ci, cj := results[i].commodity, results[j].commodity
+		if ci.EffectiveMesoPrice() != cj.EffectiveMesoPrice() {
+			return ci.EffectiveMesoPrice() < cj.EffectiveMesoPrice()
+		}
+		if ci.TokenPrice() != cj.TokenPrice() {
+			return ci.TokenPrice() < cj.TokenPrice()
+		}
+		return results[i].npcId < results[j].npcId
+	})
+	return results
+}
@@ -0,0 +1,93 @@
+package shops
+
+import (
+	"atlas-npc/character"
+	"atlas-npc/character/quest"
+	"atlas-npc/commodities"
+)
+
+// CommodityView is a commodity as seen by a specific character: what they would pay, whether they are allowed to buy
+// it and how many they could buy right now.
+type CommodityView struct {
+	commodity              commodities.Model
+	effectivePrice         uint32
+	meetsLevelRequirement  bool
+	meetsJobRequirement    bool
+	meetsGenderRequirement bool
+	meetsQuestRequirement  bool
+	remainingAllowance     uint32
+	affordable             bool
+}
+
+// Commodity returns the commodity being viewed
+func (v CommodityView) Commodity() commodities.Model {
+	return v.commodity
+}
+
+// EffectivePrice returns the meso price the character would pay per unit after discounts
+func (v CommodityView) EffectivePrice() uint32 {
+	return v.effectivePrice
+}
+
+// MeetsLevelRequirement returns whether the character satisfies the commodity's level limit
+func (v CommodityView) MeetsLevelRequirement() bool {
+	return v.meetsLevelRequirement
+}
+
+// MeetsJobRequirement returns whether the character's job may buy the commodity
+func (v CommodityView) MeetsJobRequirement() bool {
+	return v.meetsJobRequirement
+}
+
+// MeetsGenderRequirement returns whether the character's gender may buy the commodity
+func (v CommodityView) MeetsGenderRequirement() bool {
+	return v.meetsGenderRequirement
+}
+
+// MeetsQuestRequirement returns whether the character's quest progress allows buying the commodity
+func (v CommodityView) MeetsQuestRequirement() bool {
+	return v.meetsQuestRequirement
+}
+
+// Available returns whether the character meets every requirement of the commodity
+func (v CommodityView) Available() bool {
+	return v.meetsLevelRequirement && v.meetsJobRequirement && v.meetsGenderRequirement && v.meetsQuestRequirement
+}
+
+// RemainingAllowance returns how many units the character could buy in a single purchase right now
+func (v CommodityView) RemainingAllowance() uint32 {
+	return v.remainingAllowance
+}
+
+// Affordable returns whether the character has enough meso for at least one unit
+func (v CommodityView) Affordable() bool {
+	return v.affordable
+}
+
+// NewCommodityView evaluates a commodity for a character. quests holds the character's quest progress and questsOk
+// whether it could be retrieved; quest gated commodities are unavailable when it could not.
+func NewCommodityView(c character.Model, cm commodities.Model, quests []quest.Model, questsOk bool) CommodityView {
+	v := CommodityView{
+		commodity:              cm,
+		effectivePrice:         cm.EffectiveMesoPrice(),
+		meetsLevelRequirement:  cm.MeetsLevelRequirement(c.Level()),
+		meetsJobRequirement:    cm.AllowsJob(c.JobId()),
+		meetsGenderRequirement: cm.AllowsGender(c.Gender()),
+		meetsQuestRequirement:  !cm.RequiresQuest() || (questsOk && cm.AllowsQuestState(byte(quest.GetState(quests, cm.QuestId())))),
+	}
+	v.affordable = c.Meso() >= v.effectivePrice
+	if !v.Available() || !v.affordable {
+		return v
+	}
+
+	// A single purchase is bounded by the item's stack size, treating an unknown stack size as one.
+	allowance := cm.SlotMax()
+	if allowance == 0 {
+		allowance = 1
+	}
+	if v.effectivePrice > 0 && c.Meso()/v.effectivePrice < allowance {
+		allowance = c.Meso() / v.effectivePrice
+	}
+	v.remainingAllowance = allowance
+	return v
+}
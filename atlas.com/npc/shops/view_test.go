@@ -0,0 +1,94 @@
+package shops_test
+
+import (
+	"atlas-npc/character"
+	"atlas-npc/commodities"
+	"atlas-npc/shops"
+	"testing"
+)
+
+func TestNewCommodityView(t *testing.T) {
+	fighter := character.NewModelBuilder().SetLevel(30).SetJobId(110).SetGender(0).SetMeso(1000).Build()
+
+	tests := []struct {
+		name               string
+		commodity          commodities.Model
+		questsOk           bool
+		effectivePrice     uint32
+		available          bool
+		affordable         bool
+		remainingAllowance uint32
+	}{
+		{
+			name:               "discounted potion bounded by meso",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(300).SetDiscountRate(50).SetSlotMax(100).Build(),
+			questsOk:           true,
+			effectivePrice:     150,
+			available:          true,
+			affordable:         true,
+			remainingAllowance: 6,
+		},
+		{
+			name:               "cheap item bounded by stack size",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(1).SetSlotMax(100).Build(),
+			questsOk:           true,
+			effectivePrice:     1,
+			available:          true,
+			affordable:         true,
+			remainingAllowance: 100,
+		},
+		{
+			name:               "too expensive",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(5000).SetSlotMax(1).Build(),
+			questsOk:           true,
+			effectivePrice:     5000,
+			available:          true,
+			affordable:         false,
+			remainingAllowance: 0,
+		},
+		{
+			name:               "level limited",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(100).SetLevelLimit(50).SetSlotMax(1).Build(),
+			questsOk:           true,
+			effectivePrice:     100,
+			available:          false,
+			affordable:         true,
+			remainingAllowance: 0,
+		},
+		{
+			name:               "magician only",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(100).SetJobMask(commodities.JobFamilyMagician).SetSlotMax(1).Build(),
+			questsOk:           true,
+			effectivePrice:     100,
+			available:          false,
+			affordable:         true,
+			remainingAllowance: 0,
+		},
+		{
+			name:               "quest gated without quest progress",
+			commodity:          (&commodities.ModelBuilder{}).SetMesoPrice(100).SetQuestId(1000).SetQuestState(2).SetSlotMax(1).Build(),
+			questsOk:           false,
+			effectivePrice:     100,
+			available:          false,
+			affordable:         true,
+			remainingAllowance: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := shops.NewCommodityView(fighter, tt.commodity, nil, tt.questsOk)
+			if v.EffectivePrice() != tt.effectivePrice {
+				t.Errorf("Expected effective price %d, got %d", tt.effectivePrice, v.EffectivePrice())
+			}
+			if v.Available() != tt.available {
+				t.Errorf("Expected available %v, got %v", tt.available, v.Available())
+			}
+			if v.Affordable() != tt.affordable {
+				t.Errorf("Expected affordable %v, got %v", tt.affordable, v.Affordable())
+			}
+			if v.RemainingAllowance() != tt.remainingAllowance {
+				t.Errorf("Expected remaining allowance %d, got %d", tt.remainingAllowance, v.RemainingAllowance())
+			}
+		})
+	}
+}
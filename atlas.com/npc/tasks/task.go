@@ -0,0 +1,30 @@
+package tasks
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Task is a unit of work executed periodically in the background.
+type Task interface {
+	Run()
+	SleepTime() time.Duration
+}
+
+// Register starts executing the task on its own schedule until the context is cancelled.
+func Register(l logrus.FieldLogger, ctx context.Context) func(t Task) {
+	return func(t Task) {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					l.Infof("Stopping task execution.")
+					return
+				case <-time.After(t.SleepTime()):
+					t.Run()
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,141 @@
+package templates
+
+import (
+	"atlas-npc/commodities"
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// create returns a provider that creates a shop template entity
+func create(tenantId uuid.UUID, name string, description string) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		entity := Entity{
+			Id:          uuid.New(),
+			TenantId:    tenantId,
+			Name:        name,
+			Description: description,
+		}
+		err := db.Create(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
+
+// update returns a provider that updates a shop template entity
+func update(tenantId uuid.UUID, id uuid.UUID, name string, description string) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		entity, err := getById(tenantId, id)(db)()
+		if err != nil {
+			return model.ErrorProvider[Entity](err)
+		}
+
+		entity.Name = name
+		entity.Description = description
+		err = db.Save(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
+
+// remove returns a provider that deletes a shop template entity and its commodities
+func remove(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[bool] {
+	return func(db *gorm.DB) model.Provider[bool] {
+		err := db.Where(&CommodityEntity{TenantId: tenantId, ShopTemplateId: id}).Delete(&CommodityEntity{}).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		err = db.Where(&Entity{TenantId: tenantId, Id: id}).Delete(&Entity{}).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		return model.FixedProvider(true)
+	}
+}
+
+// createCommodity returns a provider that creates a commodity entity for a shop template
+func createCommodity(tenantId uuid.UUID, shopTemplateId uuid.UUID, c commodities.Model) database.EntityProvider[CommodityEntity] {
+	return func(db *gorm.DB) model.Provider[CommodityEntity] {
+		entity := CommodityEntity{
+			Id:              uuid.New(),
+			TenantId:        tenantId,
+			ShopTemplateId:  shopTemplateId,
+			TemplateId:      c.TemplateId(),
+			MesoPrice:       c.MesoPrice(),
+			DiscountRate:    c.DiscountRate(),
+			TokenTemplateId: c.TokenTemplateId(),
+			TokenPrice:      c.TokenPrice(),
+			Period:          c.Period(),
+			LevelLimit:      c.LevelLimit(),
+			JobMask:         c.JobMask(),
+			Gender:          c.Gender(),
+			QuestId:         c.QuestId(),
+			QuestState:      c.QuestState(),
+		}
+		err := db.Create(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[CommodityEntity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
+
+// updateCommodity returns a provider that updates the terms of a commodity entity of a shop template, keeping its id
+func updateCommodity(tenantId uuid.UUID, id uuid.UUID, c commodities.Model) database.EntityProvider[CommodityEntity] {
+	return func(db *gorm.DB) model.Provider[CommodityEntity] {
+		var entity CommodityEntity
+		err := db.Where(&CommodityEntity{TenantId: tenantId, Id: id}).First(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[CommodityEntity](err)
+		}
+
+		entity.TemplateId = c.TemplateId()
+		entity.MesoPrice = c.MesoPrice()
+		entity.DiscountRate = c.DiscountRate()
+		entity.TokenTemplateId = c.TokenTemplateId()
+		entity.TokenPrice = c.TokenPrice()
+		entity.Period = c.Period()
+		entity.LevelLimit = c.LevelLimit()
+		entity.JobMask = c.JobMask()
+		entity.Gender = c.Gender()
+		entity.QuestId = c.QuestId()
+		entity.QuestState = c.QuestState()
+		err = db.Save(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[CommodityEntity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
+
+// deleteCommodity returns a provider that deletes a commodity entity of a shop template
+func deleteCommodity(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[bool] {
+	return func(db *gorm.DB) model.Provider[bool] {
+		err := db.Where(&CommodityEntity{TenantId: tenantId, Id: id}).Delete(&CommodityEntity{}).Error
+		if err != nil {
+			return model.ErrorProvider[bool](err)
+		}
+		return model.FixedProvider(true)
+	}
+}
+
+// bumpInheritingShopVersions returns a provider that increments the version of every shop inheriting from a shop
+// template, as a change to the template changes the commodities those shops sell.
+func bumpInheritingShopVersions(tenantId uuid.UUID, shopTemplateId uuid.UUID) database.EntityProvider[int64] {
+	return func(db *gorm.DB) model.Provider[int64] {
+		result := db.Table("shops").
+			Where("tenant_id = ?", tenantId).
+			Where("shop_template_id = ?", shopTemplateId).
+			Where("deleted_at IS NULL").
+			Update("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return model.ErrorProvider[int64](result.Error)
+		}
+		return model.FixedProvider(result.RowsAffected)
+	}
+}
@@ -0,0 +1,73 @@
+package templates
+
+import (
+	"atlas-npc/commodities"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Entity is the GORM entity for the shop templates Model
+type Entity struct {
+	gorm.Model
+	Id          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId    uuid.UUID `gorm:"type:uuid;not null"`
+	Name        string    `gorm:"not null"`
+	Description string    `gorm:"not null;default:''"`
+}
+
+func (e *Entity) TableName() string {
+	return "shop_templates"
+}
+
+// CommodityEntity is the GORM entity for a commodity offered by a shop template
+type CommodityEntity struct {
+	gorm.Model
+	Id              uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId        uuid.UUID `gorm:"type:uuid;not null;index:idx_shop_template_commodities_tenant_template,priority:1"`
+	ShopTemplateId  uuid.UUID `gorm:"type:uuid;not null;index"`
+	TemplateId      uint32    `gorm:"not null;index:idx_shop_template_commodities_tenant_template,priority:2"`
+	MesoPrice       uint32    `gorm:"not null"`
+	DiscountRate    byte      `gorm:"not null;default:0"`
+	TokenTemplateId uint32    `gorm:"not null;default:0"`
+	TokenPrice      uint32    `gorm:"not null;default:0"`
+	Period          uint32    `gorm:"not null;default:0"`
+	LevelLimit      uint32    `gorm:"not null;default:0"`
+	JobMask         uint16    `gorm:"not null;default:0"`
+	Gender          byte      `gorm:"not null;default:0"`
+	QuestId         uint32    `gorm:"not null;default:0"`
+	QuestState      byte      `gorm:"not null;default:0"`
+}
+
+func (e *CommodityEntity) TableName() string {
+	return "shop_template_commodities"
+}
+
+// Make converts an Entity to a Model
+func Make(entity Entity) (Model, error) {
+	return NewBuilder(entity.Id).
+		SetName(entity.Name).
+		SetDescription(entity.Description).
+		Build(), nil
+}
+
+// MakeCommodity converts a CommodityEntity to a commodities Model
+func MakeCommodity(entity CommodityEntity) (commodities.Model, error) {
+	return (&commodities.ModelBuilder{}).
+		SetId(entity.Id).
+		SetTemplateId(entity.TemplateId).
+		SetMesoPrice(entity.MesoPrice).
+		SetDiscountRate(entity.DiscountRate).
+		SetTokenTemplateId(entity.TokenTemplateId).
+		SetTokenPrice(entity.TokenPrice).
+		SetPeriod(entity.Period).
+		SetLevelLimit(entity.LevelLimit).
+		SetJobMask(entity.JobMask).
+		SetGender(entity.Gender).
+		SetQuestId(entity.QuestId).
+		SetQuestState(entity.QuestState).
+		Build(), nil
+}
+
+func Migration(db *gorm.DB) error {
+	return db.AutoMigrate(&Entity{}, &CommodityEntity{})
+}
@@ -0,0 +1,92 @@
+package templates
+
+import (
+	"atlas-npc/commodities"
+	"github.com/google/uuid"
+)
+
+type Model struct {
+	id          uuid.UUID
+	name        string
+	description string
+	commodities []commodities.Model
+}
+
+// Id returns the model's id
+func (m *Model) Id() uuid.UUID {
+	return m.id
+}
+
+// Name returns the model's name
+func (m *Model) Name() string {
+	return m.name
+}
+
+// Description returns the model's description
+func (m *Model) Description() string {
+	return m.description
+}
+
+// Commodities returns the commodities offered by the template
+func (m *Model) Commodities() []commodities.Model {
+	return m.commodities
+}
+
+// NewBuilder is used to initialize a new ModelBuilder
+func NewBuilder(id uuid.UUID) *ModelBuilder {
+	return &ModelBuilder{
+		id: id,
+	}
+}
+
+// ModelBuilder is used to build Model instances
+type ModelBuilder struct {
+	id          uuid.UUID
+	name        string
+	description string
+	commodities []commodities.Model
+}
+
+// SetId sets the id for the ModelBuilder
+func (b *ModelBuilder) SetId(id uuid.UUID) *ModelBuilder {
+	b.id = id
+	return b
+}
+
+// SetName sets the name for the ModelBuilder
+func (b *ModelBuilder) SetName(name string) *ModelBuilder {
+	b.name = name
+	return b
+}
+
+// SetDescription sets the description for the ModelBuilder
+func (b *ModelBuilder) SetDescription(description string) *ModelBuilder {
+	b.description = description
+	return b
+}
+
+// SetCommodities sets the commodities for the ModelBuilder
+func (b *ModelBuilder) SetCommodities(commodities []commodities.Model) *ModelBuilder {
+	b.commodities = commodities
+	return b
+}
+
+// Build creates a new Model instance with the builder's values
+func (b *ModelBuilder) Build() Model {
+	return Model{
+		id:          b.id,
+		name:        b.name,
+		description: b.description,
+		commodities: b.commodities,
+	}
+}
+
+// Clone creates a new ModelBuilder with values from the given Model
+func Clone(m Model) *ModelBuilder {
+	return &ModelBuilder{
+		id:          m.id,
+		name:        m.name,
+		description: m.description,
+		commodities: m.commodities,
+	}
+}
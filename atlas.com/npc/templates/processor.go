@@ -0,0 +1,330 @@
+package templates
+
+import (
+	"atlas-npc/audit"
+	"atlas-npc/commodities"
+	"atlas-npc/database"
+	"context"
+	"errors"
+	"github.com/Chronicle20/atlas-model/model"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrNotFound = errors.New("not found")
+var ErrInUse = errors.New("shop template is inherited by one or more shops")
+
+type Processor interface {
+	GetById(decorators ...model.Decorator[Model]) func(id uuid.UUID) (Model, error)
+	ByIdProvider(decorators ...model.Decorator[Model]) func(id uuid.UUID) model.Provider[Model]
+	GetAll(decorators ...model.Decorator[Model]) ([]Model, error)
+	AllProvider(decorators ...model.Decorator[Model]) model.Provider[[]Model]
+	CommodityDecorator(m Model) Model
+	GetCommoditiesByTemplateId(templateId uint32) (map[uuid.UUID]commodities.Model, error)
+	Create(m Model) (Model, error)
+	Update(m Model) (Model, error)
+	Delete(id uuid.UUID) error
+	WithTransaction(tx *gorm.DB) Processor
+}
+
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+	db  *gorm.DB
+	t   tenant.Model
+	cp  commodities.Processor
+	ap  audit.Processor
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
+	p := &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+		db:  db,
+		t:   tenant.MustFromContext(ctx),
+		cp:  commodities.NewProcessor(l, ctx, db),
+		ap:  audit.NewProcessor(l, ctx, db),
+	}
+	return p
+}
+
+func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   p.l,
+		ctx: p.ctx,
+		db:  tx,
+		t:   p.t,
+		cp:  p.cp.WithTransaction(tx),
+		ap:  p.ap.WithTransaction(tx),
+	}
+}
+
+func (p *ProcessorImpl) GetById(decorators ...model.Decorator[Model]) func(id uuid.UUID) (Model, error) {
+	return func(id uuid.UUID) (Model, error) {
+		return p.ByIdProvider(decorators...)(id)()
+	}
+}
+
+func (p *ProcessorImpl) ByIdProvider(decorators ...model.Decorator[Model]) func(id uuid.UUID) model.Provider[Model] {
+	return func(id uuid.UUID) model.Provider[Model] {
+		mp := model.Map(Make)(getById(p.t.Id(), id)(p.db))
+		return model.Map(model.Decorate(decorators))(mp)
+	}
+}
+
+func (p *ProcessorImpl) GetAll(decorators ...model.Decorator[Model]) ([]Model, error) {
+	return p.AllProvider(decorators...)()
+}
+
+func (p *ProcessorImpl) AllProvider(decorators ...model.Decorator[Model]) model.Provider[[]Model] {
+	mp := model.SliceMap(Make)(getAll(p.t.Id())(p.db))(model.ParallelMap())
+	return model.SliceMap(model.Decorate(decorators))(mp)(model.ParallelMap())
+}
+
+// CommodityDecorator resolves the commodities offered by the template, including item data
+func (p *ProcessorImpl) CommodityDecorator(m Model) Model {
+	cp := model.SliceMap(MakeCommodity)(getCommodities(p.t.Id(), m.Id())(p.db))(model.ParallelMap())
+	cms, err := model.SliceMap(model.Decorate(model.Decorators(p.cp.DataDecorator)))(cp)(model.ParallelMap())()
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to retrieve commodities for shop template [%s].", m.Id())
+		return m
+	}
+	return Clone(m).SetCommodities(cms).Build()
+}
+
+// GetCommoditiesByTemplateId returns the commodity selling the item of each shop template offering it, by shop template id
+func (p *ProcessorImpl) GetCommoditiesByTemplateId(templateId uint32) (map[uuid.UUID]commodities.Model, error) {
+	es, err := getCommoditiesByTemplateId(p.t.Id(), templateId)(p.db)()
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[uuid.UUID]commodities.Model, len(es))
+	for _, e := range es {
+		if _, ok := results[e.ShopTemplateId]; ok {
+			continue
+		}
+		c, err := MakeCommodity(e)
+		if err != nil {
+			return nil, err
+		}
+		results[e.ShopTemplateId] = c
+	}
+	return results, nil
+}
+
+func (p *ProcessorImpl) Create(m Model) (Model, error) {
+	p.l.Debugf("Creating shop template [%s] with [%d] commodities.", m.Name(), len(m.Commodities()))
+	var result Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		e, err := create(p.t.Id(), m.Name(), m.Description())(tx)()
+		if err != nil {
+			return err
+		}
+		result, err = p.reconcileCommodities(tx, e, m.Commodities())
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionCreateShopTemplate, nil, &result)
+	})
+	if txErr != nil {
+		return Model{}, txErr
+	}
+	return result, nil
+}
+
+func (p *ProcessorImpl) Update(m Model) (Model, error) {
+	p.l.Debugf("Updating shop template [%s] with [%d] commodities.", m.Id(), len(m.Commodities()))
+	var result Model
+	txErr := database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		tp := p.WithTransaction(tx)
+		before, err := tp.GetById(tp.CommodityDecorator)(m.Id())
+		if err != nil {
+			return err
+		}
+		e, err := update(p.t.Id(), m.Id(), m.Name(), m.Description())(tx)()
+		if err != nil {
+			return err
+		}
+		result, err = p.reconcileCommodities(tx, e, m.Commodities())
+		if err != nil {
+			return err
+		}
+		// Shops inheriting from the template now sell different commodities, so ETags clients hold for them are stale.
+		_, err = bumpInheritingShopVersions(p.t.Id(), m.Id())(tx)()
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionUpdateShopTemplate, &before, &result)
+	})
+	if txErr != nil {
+		return Model{}, txErr
+	}
+	return result, nil
+}
+
+// reconcileCommodities persists the submitted commodities of a shop template against those stored for it. Submitted
+// commodities are matched to stored ones first by id and then by template id; matched commodities keep their id and are
+// only written when their terms changed, unmatched submitted commodities are created and unmatched stored ones deleted.
+func (p *ProcessorImpl) reconcileCommodities(tx *gorm.DB, e Entity, cms []commodities.Model) (Model, error) {
+	existing, err := getCommodities(p.t.Id(), e.Id)(tx)()
+	if err != nil {
+		return Model{}, err
+	}
+	byId := make(map[uuid.UUID]int, len(existing))
+	for i, ce := range existing {
+		byId[ce.Id] = i
+	}
+	matched := make([]bool, len(existing))
+	pending := make([]commodities.Model, 0)
+	result := make([]commodities.Model, 0, len(cms))
+
+	match := func(i int, c commodities.Model) error {
+		matched[i] = true
+		stored, err := MakeCommodity(existing[i])
+		if err != nil {
+			return err
+		}
+		if sameTerms(stored, c) {
+			result = append(result, p.cp.DataDecorator(stored))
+			return nil
+		}
+		ce, err := updateCommodity(p.t.Id(), stored.Id(), c)(tx)()
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to update commodity [%s] for shop template [%s].", stored.Id(), e.Id)
+			return err
+		}
+		uc, err := MakeCommodity(ce)
+		if err != nil {
+			return err
+		}
+		result = append(result, p.cp.DataDecorator(uc))
+		return nil
+	}
+
+	for _, c := range cms {
+		if i, ok := byId[c.Id()]; ok && c.Id() != uuid.Nil && !matched[i] {
+			if err = match(i, c); err != nil {
+				return Model{}, err
+			}
+			continue
+		}
+		pending = append(pending, c)
+	}
+	for _, c := range pending {
+		found := false
+		for i, ce := range existing {
+			if !matched[i] && ce.TemplateId == c.TemplateId() {
+				if err = match(i, c); err != nil {
+					return Model{}, err
+				}
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		ce, err := createCommodity(p.t.Id(), e.Id, c)(tx)()
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to create commodity with template ID [%d] for shop template [%s].", c.TemplateId(), e.Id)
+			return Model{}, err
+		}
+		ac, err := MakeCommodity(ce)
+		if err != nil {
+			return Model{}, err
+		}
+		result = append(result, p.cp.DataDecorator(ac))
+	}
+	for i, ce := range existing {
+		if matched[i] {
+			continue
+		}
+		_, err = deleteCommodity(p.t.Id(), ce.Id)(tx)()
+		if err != nil {
+			p.l.WithError(err).Errorf("Failed to delete commodity [%s] for shop template [%s].", ce.Id, e.Id)
+			return Model{}, err
+		}
+	}
+
+	m, err := Make(e)
+	if err != nil {
+		return Model{}, err
+	}
+	return Clone(m).SetCommodities(result).Build(), nil
+}
+
+// sameTerms reports whether two commodities would be persisted identically.
+func sameTerms(a commodities.Model, b commodities.Model) bool {
+	return a.TemplateId() == b.TemplateId() &&
+		a.MesoPrice() == b.MesoPrice() &&
+		a.DiscountRate() == b.DiscountRate() &&
+		a.TokenTemplateId() == b.TokenTemplateId() &&
+		a.TokenPrice() == b.TokenPrice() &&
+		a.Period() == b.Period() &&
+		a.LevelLimit() == b.LevelLimit() &&
+		a.JobMask() == b.JobMask() &&
+		a.Gender() == b.Gender() &&
+		a.QuestId() == b.QuestId() &&
+		a.QuestState() == b.QuestState()
+}
+
+func (p *ProcessorImpl) Delete(id uuid.UUID) error {
+	return database.ExecuteTransaction(p.db, func(tx *gorm.DB) error {
+		tp := p.WithTransaction(tx)
+		before, err := tp.GetById(tp.CommodityDecorator)(id)
+		if err != nil {
+			return err
+		}
+		count, err := countInheritingShops(p.t.Id(), id)(tx)()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrInUse
+		}
+		_, err = remove(p.t.Id(), id)(tx)()
+		if err != nil {
+			return err
+		}
+		return p.record(tx, audit.ActionDeleteShopTemplate, &before, nil)
+	})
+}
+
+// record audits a change to a shop template, including its commodities. A nil before or after marks the template as
+// created or deleted. Templates belong to no NPC, so the entry is recorded with an NPC of 0.
+func (p *ProcessorImpl) record(tx *gorm.DB, action string, before *Model, after *Model) error {
+	var bv, av any
+	if before != nil {
+		s, err := makeAuditState(*before)
+		if err != nil {
+			return err
+		}
+		bv = s
+	}
+	if after != nil {
+		s, err := makeAuditState(*after)
+		if err != nil {
+			return err
+		}
+		av = s
+	}
+	return p.ap.WithTransaction(tx).Record(action, 0, uuid.Nil, bv, av)
+}
+
+// auditState is the audited JSON of a shop template. Unlike the JSON API resource, it carries the template id and its
+// commodities inline, as template commodities are not audited on their own.
+type auditState struct {
+	RestModel
+	Id          string                  `json:"id"`
+	Commodities []commodities.RestModel `json:"commodities"`
+}
+
+func makeAuditState(m Model) (auditState, error) {
+	rm, err := Transform(m)
+	if err != nil {
+		return auditState{}, err
+	}
+	return auditState{RestModel: rm, Id: rm.Id, Commodities: rm.Commodities}, nil
+}
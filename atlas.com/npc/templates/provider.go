@@ -0,0 +1,76 @@
+package templates
+
+import (
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// getById returns a provider that gets a shop template entity by id
+func getById(tenantId uuid.UUID, id uuid.UUID) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		var result Entity
+		err := db.Where(&Entity{TenantId: tenantId, Id: id}).First(&result).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return model.ErrorProvider[Entity](ErrNotFound)
+			}
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(result)
+	}
+}
+
+// getAll returns a provider that gets all shop template entities for a tenant
+func getAll(tenantId uuid.UUID) database.EntityProvider[[]Entity] {
+	return func(db *gorm.DB) model.Provider[[]Entity] {
+		var results []Entity
+		err := db.Where(&Entity{TenantId: tenantId}).Order("name").Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]Entity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getCommodities returns a provider that gets the commodity entities of a shop template
+func getCommodities(tenantId uuid.UUID, shopTemplateId uuid.UUID) database.EntityProvider[[]CommodityEntity] {
+	return func(db *gorm.DB) model.Provider[[]CommodityEntity] {
+		var results []CommodityEntity
+		err := db.Where(&CommodityEntity{TenantId: tenantId, ShopTemplateId: shopTemplateId}).Order("created_at").Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]CommodityEntity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getCommoditiesByTemplateId returns a provider that gets the commodity entities of a tenant's shop templates selling an
+// item
+func getCommoditiesByTemplateId(tenantId uuid.UUID, templateId uint32) database.EntityProvider[[]CommodityEntity] {
+	return func(db *gorm.DB) model.Provider[[]CommodityEntity] {
+		var results []CommodityEntity
+		err := db.Where(&CommodityEntity{TenantId: tenantId, TemplateId: templateId}).Order("created_at").Find(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]CommodityEntity](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// countInheritingShops returns a provider that counts the shops which inherit from a shop template
+func countInheritingShops(tenantId uuid.UUID, shopTemplateId uuid.UUID) database.EntityProvider[int64] {
+	return func(db *gorm.DB) model.Provider[int64] {
+		var count int64
+		err := db.Table("shops").
+			Where("tenant_id = ?", tenantId).
+			Where("shop_template_id = ?", shopTemplateId).
+			Where("deleted_at IS NULL").
+			Count(&count).Error
+		if err != nil {
+			return model.ErrorProvider[int64](err)
+		}
+		return model.FixedProvider(count)
+	}
+}
@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"atlas-npc/rest"
+	"context"
+	"errors"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/server"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
+	return func(db *gorm.DB) server.RouteInitializer {
+		return func(router *mux.Router, l logrus.FieldLogger) {
+			// Templates are created and updated by the shops resource, which validates their commodities as it would those
+			// of a shop.
+			r := router.PathPrefix("/shop-templates").Subrouter()
+			r.HandleFunc("", rest.RegisterHandler(l)(db)(si)("get_shop_templates", handleGetShopTemplates)).Methods(http.MethodGet)
+			r.HandleFunc("/{shopTemplateId}", rest.RegisterHandler(l)(db)(si)("get_shop_template", handleGetShopTemplate)).Methods(http.MethodGet)
+			r.HandleFunc("/{shopTemplateId}", rest.RegisterHandler(l)(db)(si)("delete_shop_template", handleDeleteShopTemplate)).Methods(http.MethodDelete)
+		}
+	}
+}
+
+func decoratorsFromInclude(l logrus.FieldLogger, ctx context.Context, db *gorm.DB, r *http.Request) []model.Decorator[Model] {
+	query := r.URL.Query()
+	includes := query["include"]
+	for _, include := range includes {
+		if include == "commodities" {
+			return model.Decorators(NewProcessor(l, ctx, db).CommodityDecorator)
+		}
+	}
+	return make([]model.Decorator[Model], 0)
+}
+
+func handleGetShopTemplates(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ms, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetAll(decoratorsFromInclude(d.Logger(), d.Context(), d.DB(), r)...)
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Retrieving shop templates.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(Transform)(model.FixedProvider(ms))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
+
+func handleGetShopTemplate(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseShopTemplateId(d.Logger(), func(shopTemplateId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			m, err := NewProcessor(d.Logger(), d.Context(), d.DB()).GetById(decoratorsFromInclude(d.Logger(), d.Context(), d.DB(), r)...)(shopTemplateId)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				d.Logger().WithError(err).Errorf("Retrieving shop template [%s].", shopTemplateId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			res, err := Transform(m)
+			if err != nil {
+				d.Logger().WithError(err).Errorf("Creating REST model.")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			query := r.URL.Query()
+			queryParams := jsonapi.ParseQueryFields(&query)
+			server.MarshalResponse[RestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+		}
+	})
+}
+
+func handleDeleteShopTemplate(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return rest.ParseShopTemplateId(d.Logger(), func(shopTemplateId uuid.UUID) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			err := NewProcessor(d.Logger(), d.Context(), d.DB()).Delete(shopTemplateId)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if errors.Is(err, ErrInUse) {
+					d.Logger().WithError(err).Warnf("Refusing to delete shop template [%s].", shopTemplateId)
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				d.Logger().WithError(err).Errorf("Deleting shop template [%s].", shopTemplateId)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
@@ -1,8 +1,11 @@
 package test
 
 import (
+	"atlas-npc/audit"
 	"atlas-npc/commodities"
 	"atlas-npc/shops"
+	"atlas-npc/templates"
+	"atlas-npc/transactions"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"testing"
@@ -14,7 +17,7 @@ func CreateCommoditiesProcessor(t *testing.T) (commodities.Processor, *gorm.DB,
 	logger := logrus.New()
 
 	// Set up test database with migrations
-	db := SetupTestDB(t, commodities.Migration)
+	db := SetupTestDB(t, commodities.Migration, audit.Migration)
 
 	// Create test context
 	ctx := CreateTestContext()
@@ -48,7 +51,7 @@ func CreateShopsProcessor(t *testing.T) (shops.Processor, *gorm.DB, func()) {
 	logger := logrus.New()
 
 	// Set up test database with migrations
-	db := SetupTestDB(t, commodities.Migration, shops.Migration)
+	db := SetupTestDB(t, commodities.Migration, shops.Migration, templates.Migration, audit.Migration, transactions.Migration)
 
 	// Create test context
 	ctx := CreateTestContext()
@@ -0,0 +1,32 @@
+package transactions
+
+import (
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createTransaction returns a provider that records a transaction entity
+func createTransaction(tenantId uuid.UUID, characterId uint32, npcId uint32, transactionType string, templateId uint32, quantity uint32, mesoSunk uint32, mesoPaid uint32, tokenTemplateId uint32, tokensConsumed uint32) database.EntityProvider[Entity] {
+	return func(db *gorm.DB) model.Provider[Entity] {
+		entity := Entity{
+			Id:              uuid.New(),
+			TenantId:        tenantId,
+			CharacterId:     characterId,
+			NpcId:           npcId,
+			Type:            transactionType,
+			TemplateId:      templateId,
+			Quantity:        quantity,
+			MesoSunk:        mesoSunk,
+			MesoPaid:        mesoPaid,
+			TokenTemplateId: tokenTemplateId,
+			TokensConsumed:  tokensConsumed,
+		}
+		err := db.Create(&entity).Error
+		if err != nil {
+			return model.ErrorProvider[Entity](err)
+		}
+		return model.FixedProvider(entity)
+	}
+}
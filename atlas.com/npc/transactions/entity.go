@@ -0,0 +1,48 @@
+package transactions
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Entity is the GORM entity for the transaction Model
+type Entity struct {
+	Id              uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TenantId        uuid.UUID `gorm:"type:uuid;not null;index:idx_shop_transactions_tenant_created,priority:1;index:idx_shop_transactions_tenant_npc,priority:1;index:idx_shop_transactions_tenant_template,priority:1"`
+	CharacterId     uint32    `gorm:"not null"`
+	NpcId           uint32    `gorm:"not null;index:idx_shop_transactions_tenant_npc,priority:2"`
+	Type            string    `gorm:"not null"`
+	TemplateId      uint32    `gorm:"not null;index:idx_shop_transactions_tenant_template,priority:2"`
+	Quantity        uint32    `gorm:"not null;default:0"`
+	MesoSunk        uint32    `gorm:"not null;default:0"`
+	MesoPaid        uint32    `gorm:"not null;default:0"`
+	TokenTemplateId uint32    `gorm:"not null;default:0"`
+	TokensConsumed  uint32    `gorm:"not null;default:0"`
+	CreatedAt       time.Time `gorm:"not null;index:idx_shop_transactions_tenant_created,priority:2"`
+}
+
+func (e *Entity) TableName() string {
+	return "shop_transactions"
+}
+
+// Make converts an Entity to a Model
+func Make(entity Entity) (Model, error) {
+	return Model{
+		id:              entity.Id,
+		characterId:     entity.CharacterId,
+		npcId:           entity.NpcId,
+		transactionType: entity.Type,
+		templateId:      entity.TemplateId,
+		quantity:        entity.Quantity,
+		mesoSunk:        entity.MesoSunk,
+		mesoPaid:        entity.MesoPaid,
+		tokenTemplateId: entity.TokenTemplateId,
+		tokensConsumed:  entity.TokensConsumed,
+		createdAt:       entity.CreatedAt,
+	}, nil
+}
+
+func Migration(db *gorm.DB) error {
+	return db.AutoMigrate(&Entity{})
+}
@@ -0,0 +1,156 @@
+package transactions
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	TypeBuy      = "BUY"
+	TypeSell     = "SELL"
+	TypeRecharge = "RECHARGE"
+)
+
+const (
+	DefaultTopLimit = 10
+	MaxTopLimit     = 100
+)
+
+var ErrInvalidQuery = errors.New("invalid analytics query")
+
+// Model is a completed shop transaction
+type Model struct {
+	id              uuid.UUID
+	characterId     uint32
+	npcId           uint32
+	transactionType string
+	templateId      uint32
+	quantity        uint32
+	mesoSunk        uint32
+	mesoPaid        uint32
+	tokenTemplateId uint32
+	tokensConsumed  uint32
+	createdAt       time.Time
+}
+
+// Id returns the id of the transaction
+func (m *Model) Id() uuid.UUID {
+	return m.id
+}
+
+// CharacterId returns the character who traded with the shop
+func (m *Model) CharacterId() uint32 {
+	return m.characterId
+}
+
+// NpcId returns the NPC of the shop
+func (m *Model) NpcId() uint32 {
+	return m.npcId
+}
+
+// Type returns whether the character bought, sold or recharged
+func (m *Model) Type() string {
+	return m.transactionType
+}
+
+// TemplateId returns the item traded
+func (m *Model) TemplateId() uint32 {
+	return m.templateId
+}
+
+// Quantity returns the number of units traded
+func (m *Model) Quantity() uint32 {
+	return m.quantity
+}
+
+// MesoSunk returns the meso the character paid the shop
+func (m *Model) MesoSunk() uint32 {
+	return m.mesoSunk
+}
+
+// MesoPaid returns the meso the shop paid the character
+func (m *Model) MesoPaid() uint32 {
+	return m.mesoPaid
+}
+
+// TokenTemplateId returns the token item the character paid with, or 0 when paid in meso
+func (m *Model) TokenTemplateId() uint32 {
+	return m.tokenTemplateId
+}
+
+// TokensConsumed returns the number of tokens the character paid the shop
+func (m *Model) TokensConsumed() uint32 {
+	return m.tokensConsumed
+}
+
+// CreatedAt returns when the transaction happened
+func (m *Model) CreatedAt() time.Time {
+	return m.createdAt
+}
+
+// Filter restricts the transactions aggregated. Zero values do not filter.
+type Filter struct {
+	NpcId      uint32
+	TemplateId uint32
+	From       time.Time
+	To         time.Time
+}
+
+// Aggregate summarizes the transactions of a shop, an item or a day. Only the key of the grouping is set.
+type Aggregate struct {
+	npcId          uint32
+	templateId     uint32
+	day            string
+	mesoSunk       uint64
+	mesoPaid       uint64
+	tokensConsumed uint64
+	quantity       uint64
+	uniqueBuyers   uint64
+	transactions   uint64
+}
+
+// NpcId returns the shop aggregated, when grouped by shop
+func (a *Aggregate) NpcId() uint32 {
+	return a.npcId
+}
+
+// TemplateId returns the item aggregated, when grouped by item
+func (a *Aggregate) TemplateId() uint32 {
+	return a.templateId
+}
+
+// Day returns the UTC date aggregated as YYYY-MM-DD, when grouped by day
+func (a *Aggregate) Day() string {
+	return a.day
+}
+
+// MesoSunk returns the meso characters paid the shops
+func (a *Aggregate) MesoSunk() uint64 {
+	return a.mesoSunk
+}
+
+// MesoPaid returns the meso the shops paid characters
+func (a *Aggregate) MesoPaid() uint64 {
+	return a.mesoPaid
+}
+
+// TokensConsumed returns the tokens characters paid the shops
+func (a *Aggregate) TokensConsumed() uint64 {
+	return a.tokensConsumed
+}
+
+// Quantity returns the units traded
+func (a *Aggregate) Quantity() uint64 {
+	return a.quantity
+}
+
+// UniqueBuyers returns the number of distinct characters who bought
+func (a *Aggregate) UniqueBuyers() uint64 {
+	return a.uniqueBuyers
+}
+
+// Transactions returns the number of transactions
+func (a *Aggregate) Transactions() uint64 {
+	return a.transactions
+}
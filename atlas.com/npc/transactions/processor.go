@@ -0,0 +1,110 @@
+package transactions
+
+import (
+	"context"
+	"github.com/Chronicle20/atlas-model/model"
+	tenant "github.com/Chronicle20/atlas-tenant"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type Processor interface {
+	WithTransaction(tx *gorm.DB) Processor
+	RecordBuy(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoSunk uint32, tokenTemplateId uint32, tokensConsumed uint32) error
+	RecordSell(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoPaid uint32) error
+	RecordRecharge(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoSunk uint32) error
+	GetByShop(f Filter) ([]Aggregate, error)
+	ByShopProvider(f Filter) model.Provider[[]Aggregate]
+	GetByItem(f Filter) ([]Aggregate, error)
+	ByItemProvider(f Filter) model.Provider[[]Aggregate]
+	GetByDay(f Filter) ([]Aggregate, error)
+	ByDayProvider(f Filter) model.Provider[[]Aggregate]
+	GetTopItems(f Filter, metric string, limit int) ([]Aggregate, error)
+	TopItemsProvider(f Filter, metric string, limit int) model.Provider[[]Aggregate]
+}
+
+type ProcessorImpl struct {
+	l   logrus.FieldLogger
+	ctx context.Context
+	db  *gorm.DB
+	t   tenant.Model
+}
+
+func NewProcessor(l logrus.FieldLogger, ctx context.Context, db *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   l,
+		ctx: ctx,
+		db:  db,
+		t:   tenant.MustFromContext(ctx),
+	}
+}
+
+func (p *ProcessorImpl) WithTransaction(tx *gorm.DB) Processor {
+	return &ProcessorImpl{
+		l:   p.l,
+		ctx: p.ctx,
+		db:  tx,
+		t:   p.t,
+	}
+}
+
+// RecordBuy stores a purchase from a shop, paid in meso or tokens.
+func (p *ProcessorImpl) RecordBuy(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoSunk uint32, tokenTemplateId uint32, tokensConsumed uint32) error {
+	return p.record(characterId, npcId, TypeBuy, templateId, quantity, mesoSunk, 0, tokenTemplateId, tokensConsumed)
+}
+
+// RecordSell stores a sale to a shop.
+func (p *ProcessorImpl) RecordSell(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoPaid uint32) error {
+	return p.record(characterId, npcId, TypeSell, templateId, quantity, 0, mesoPaid, 0, 0)
+}
+
+// RecordRecharge stores a recharge of a throwing star or bullet at a shop.
+func (p *ProcessorImpl) RecordRecharge(characterId uint32, npcId uint32, templateId uint32, quantity uint32, mesoSunk uint32) error {
+	return p.record(characterId, npcId, TypeRecharge, templateId, quantity, mesoSunk, 0, 0, 0)
+}
+
+func (p *ProcessorImpl) record(characterId uint32, npcId uint32, transactionType string, templateId uint32, quantity uint32, mesoSunk uint32, mesoPaid uint32, tokenTemplateId uint32, tokensConsumed uint32) error {
+	_, err := createTransaction(p.t.Id(), characterId, npcId, transactionType, templateId, quantity, mesoSunk, mesoPaid, tokenTemplateId, tokensConsumed)(p.db)()
+	if err != nil {
+		p.l.WithError(err).Errorf("Unable to record [%s] of item [%d] by character [%d] at shop [%d].", transactionType, templateId, characterId, npcId)
+		return err
+	}
+	return nil
+}
+
+func (p *ProcessorImpl) GetByShop(f Filter) ([]Aggregate, error) {
+	return p.ByShopProvider(f)()
+}
+
+func (p *ProcessorImpl) ByShopProvider(f Filter) model.Provider[[]Aggregate] {
+	return model.SliceMap(makeAggregate)(getByShop(p.t.Id(), f)(p.db))(model.ParallelMap())
+}
+
+func (p *ProcessorImpl) GetByItem(f Filter) ([]Aggregate, error) {
+	return p.ByItemProvider(f)()
+}
+
+func (p *ProcessorImpl) ByItemProvider(f Filter) model.Provider[[]Aggregate] {
+	return model.SliceMap(makeAggregate)(getByItem(p.t.Id(), f)(p.db))(model.ParallelMap())
+}
+
+func (p *ProcessorImpl) GetByDay(f Filter) ([]Aggregate, error) {
+	return p.ByDayProvider(f)()
+}
+
+func (p *ProcessorImpl) ByDayProvider(f Filter) model.Provider[[]Aggregate] {
+	return model.SliceMap(makeAggregate)(getByDay(p.t.Id(), f)(p.db))(model.ParallelMap())
+}
+
+// GetTopItems returns the items with the highest total of the metric, at most limit of them.
+func (p *ProcessorImpl) GetTopItems(f Filter, metric string, limit int) ([]Aggregate, error) {
+	return p.TopItemsProvider(f, metric, limit)()
+}
+
+func (p *ProcessorImpl) TopItemsProvider(f Filter, metric string, limit int) model.Provider[[]Aggregate] {
+	column, ok := metricColumns[metric]
+	if !ok || limit < 1 || limit > MaxTopLimit {
+		return model.ErrorProvider[[]Aggregate](ErrInvalidQuery)
+	}
+	return model.SliceMap(makeAggregate)(getTopItems(p.t.Id(), f, column, limit)(p.db))(model.ParallelMap())
+}
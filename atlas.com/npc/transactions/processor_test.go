@@ -0,0 +1,105 @@
+package transactions_test
+
+import (
+	"atlas-npc/test"
+	"atlas-npc/transactions"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"testing"
+	"time"
+)
+
+func TestEconomyAnalytics(t *testing.T) {
+	db := test.SetupTestDB(t, transactions.Migration)
+	defer test.CleanupTestDB(t, db)
+
+	p := transactions.NewProcessor(logrus.New(), test.CreateTestContext(), db)
+	before := time.Now().UTC().Format(time.DateOnly)
+
+	// Two characters buy potions at one shop, one of them twice, and one sells and recharges at another
+	records := []func() error{
+		func() error { return p.RecordBuy(1, 9200, 2000000, 10, 500, 0, 0) },
+		func() error { return p.RecordBuy(1, 9200, 2000000, 5, 250, 0, 0) },
+		func() error { return p.RecordBuy(2, 9200, 2000001, 1, 1000, 0, 0) },
+		func() error { return p.RecordSell(2, 9201, 1302000, 1, 300) },
+		func() error { return p.RecordRecharge(1, 9201, 2070000, 800, 400) },
+		func() error { return p.RecordBuy(3, 9201, 2000000, 1, 0, 4001126, 20) },
+	}
+	for _, r := range records {
+		if err := r(); err != nil {
+			t.Fatalf("Failed to record transaction: %v", err)
+		}
+	}
+	after := time.Now().UTC().Format(time.DateOnly)
+
+	// Per shop totals
+	byShop, err := p.GetByShop(transactions.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to aggregate by shop: %v", err)
+	}
+	if len(byShop) != 2 {
+		t.Fatalf("Expected 2 shops, got %d", len(byShop))
+	}
+	first, second := byShop[0], byShop[1]
+	if first.NpcId() != 9200 || first.MesoSunk() != 1750 || first.MesoPaid() != 0 || first.UniqueBuyers() != 2 || first.Transactions() != 3 {
+		t.Errorf("Unexpected totals for shop 9200: sunk=%d paid=%d buyers=%d transactions=%d", first.MesoSunk(), first.MesoPaid(), first.UniqueBuyers(), first.Transactions())
+	}
+	if second.NpcId() != 9201 || second.MesoSunk() != 400 || second.MesoPaid() != 300 || second.TokensConsumed() != 20 || second.UniqueBuyers() != 1 {
+		t.Errorf("Unexpected totals for shop 9201: sunk=%d paid=%d tokens=%d buyers=%d", second.MesoSunk(), second.MesoPaid(), second.TokensConsumed(), second.UniqueBuyers())
+	}
+
+	// Per item totals, filtered to a shop
+	byItem, err := p.GetByItem(transactions.Filter{NpcId: 9200})
+	if err != nil {
+		t.Fatalf("Failed to aggregate by item: %v", err)
+	}
+	if len(byItem) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(byItem))
+	}
+	potion := byItem[0]
+	if potion.TemplateId() != 2000000 || potion.Quantity() != 15 || potion.MesoSunk() != 750 || potion.UniqueBuyers() != 1 {
+		t.Errorf("Unexpected totals for item 2000000: quantity=%d sunk=%d buyers=%d", potion.Quantity(), potion.MesoSunk(), potion.UniqueBuyers())
+	}
+
+	// Per day totals
+	byDay, err := p.GetByDay(transactions.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to aggregate by day: %v", err)
+	}
+	var total uint64
+	for _, d := range byDay {
+		if d.Day() != before && d.Day() != after {
+			t.Errorf("Expected transactions on %s, got %s", before, d.Day())
+		}
+		total += d.Transactions()
+	}
+	if total != uint64(len(records)) {
+		t.Errorf("Expected %d transactions across days, got %d", len(records), total)
+	}
+
+	// Transactions outside the window are not aggregated
+	byShop, err = p.GetByShop(transactions.Filter{To: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to aggregate by shop: %v", err)
+	}
+	if len(byShop) != 0 {
+		t.Errorf("Expected no shops before the transactions, got %d", len(byShop))
+	}
+
+	// Top items by meso sunk
+	top, err := p.GetTopItems(transactions.Filter{}, "mesoSunk", 2)
+	if err != nil {
+		t.Fatalf("Failed to get top items: %v", err)
+	}
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 top items, got %d", len(top))
+	}
+	if top[0].TemplateId() != 2000001 || top[1].TemplateId() != 2000000 {
+		t.Errorf("Expected top items [2000001 2000000], got [%d %d]", top[0].TemplateId(), top[1].TemplateId())
+	}
+
+	// Unknown metrics are rejected
+	if _, err = p.GetTopItems(transactions.Filter{}, "price", 2); !errors.Is(err, transactions.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an unknown metric, got %v", err)
+	}
+}
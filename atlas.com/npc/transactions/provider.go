@@ -0,0 +1,134 @@
+package transactions
+
+import (
+	"atlas-npc/database"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	groupByShop = "npc_id"
+	groupByItem = "template_id"
+	groupByDay  = "CAST(DATE(created_at) AS TEXT)"
+	// groupByUtcDay groups by UTC day on Postgres, where DATE of a timestamptz uses the session time zone. SQLite
+	// already dates timestamps in UTC.
+	groupByUtcDay = "CAST(DATE(created_at AT TIME ZONE 'UTC') AS TEXT)"
+)
+
+// dayGroup returns the expression grouping transactions by UTC day for the dialect of the database
+func dayGroup(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return groupByUtcDay
+	}
+	return groupByDay
+}
+
+// aggregateColumns are the totals computed for every grouping
+const aggregateColumns = "COALESCE(SUM(meso_sunk), 0) AS meso_sunk, " +
+	"COALESCE(SUM(meso_paid), 0) AS meso_paid, " +
+	"COALESCE(SUM(tokens_consumed), 0) AS tokens_consumed, " +
+	"COALESCE(SUM(quantity), 0) AS quantity, " +
+	"COUNT(DISTINCT CASE WHEN type = '" + TypeBuy + "' THEN character_id END) AS unique_buyers, " +
+	"COUNT(*) AS transactions"
+
+// metricColumns maps the metrics items may be ranked by to their aggregate column
+var metricColumns = map[string]string{
+	"mesoSunk":       "meso_sunk",
+	"mesoPaid":       "meso_paid",
+	"tokensConsumed": "tokens_consumed",
+	"quantity":       "quantity",
+	"uniqueBuyers":   "unique_buyers",
+	"transactions":   "transactions",
+}
+
+// aggregateRow is a row of an aggregate query. Only the column grouped by is populated among the keys.
+type aggregateRow struct {
+	NpcId          uint32
+	TemplateId     uint32
+	Day            string
+	MesoSunk       int64
+	MesoPaid       int64
+	TokensConsumed int64
+	Quantity       int64
+	UniqueBuyers   int64
+	Transactions   int64
+}
+
+func makeAggregate(r aggregateRow) (Aggregate, error) {
+	return Aggregate{
+		npcId:          r.NpcId,
+		templateId:     r.TemplateId,
+		day:            r.Day,
+		mesoSunk:       uint64(r.MesoSunk),
+		mesoPaid:       uint64(r.MesoPaid),
+		tokensConsumed: uint64(r.TokensConsumed),
+		quantity:       uint64(r.Quantity),
+		uniqueBuyers:   uint64(r.UniqueBuyers),
+		transactions:   uint64(r.Transactions),
+	}, nil
+}
+
+// scopeTransactions restricts a query to the transactions of a tenant matching the filter
+func scopeTransactions(tenantId uuid.UUID, f Filter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		q := db.Model(&Entity{}).Where("tenant_id = ?", tenantId)
+		if f.NpcId != 0 {
+			q = q.Where("npc_id = ?", f.NpcId)
+		}
+		if f.TemplateId != 0 {
+			q = q.Where("template_id = ?", f.TemplateId)
+		}
+		if !f.From.IsZero() {
+			q = q.Where("created_at >= ?", f.From)
+		}
+		if !f.To.IsZero() {
+			q = q.Where("created_at < ?", f.To)
+		}
+		return q
+	}
+}
+
+// aggregateBy returns a provider that totals the matching transactions of a tenant per value of the grouping
+// expression, which is selected into the key column of the row.
+func aggregateBy(tenantId uuid.UUID, f Filter, group string, key string, order string, limit int) database.EntityProvider[[]aggregateRow] {
+	return func(db *gorm.DB) model.Provider[[]aggregateRow] {
+		q := db.Scopes(scopeTransactions(tenantId, f)).
+			Select(group + " AS " + key + ", " + aggregateColumns).
+			Group(group).
+			Order(order)
+		if limit > 0 {
+			q = q.Limit(limit)
+		}
+
+		var results []aggregateRow
+		err := q.Scan(&results).Error
+		if err != nil {
+			return model.ErrorProvider[[]aggregateRow](err)
+		}
+		return model.FixedProvider(results)
+	}
+}
+
+// getByShop returns a provider that totals the matching transactions of a tenant per shop
+func getByShop(tenantId uuid.UUID, f Filter) database.EntityProvider[[]aggregateRow] {
+	return aggregateBy(tenantId, f, groupByShop, "npc_id", "npc_id", 0)
+}
+
+// getByItem returns a provider that totals the matching transactions of a tenant per item
+func getByItem(tenantId uuid.UUID, f Filter) database.EntityProvider[[]aggregateRow] {
+	return aggregateBy(tenantId, f, groupByItem, "template_id", "template_id", 0)
+}
+
+// getByDay returns a provider that totals the matching transactions of a tenant per UTC day
+func getByDay(tenantId uuid.UUID, f Filter) database.EntityProvider[[]aggregateRow] {
+	return func(db *gorm.DB) model.Provider[[]aggregateRow] {
+		return aggregateBy(tenantId, f, dayGroup(db), "day", "day", 0)(db)
+	}
+}
+
+// getTopItems returns a provider that totals the matching transactions of a tenant per item, ranked by the metric
+// column descending and truncated to the limit
+func getTopItems(tenantId uuid.UUID, f Filter, column string, limit int) database.EntityProvider[[]aggregateRow] {
+	return aggregateBy(tenantId, f, groupByItem, "template_id", column+" DESC, template_id", limit)
+}
@@ -0,0 +1,143 @@
+package transactions
+
+import (
+	"atlas-npc/rest"
+	"errors"
+	"github.com/Chronicle20/atlas-model/model"
+	"github.com/Chronicle20/atlas-rest/server"
+	"github.com/gorilla/mux"
+	"github.com/jtumidanski/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func InitResource(si jsonapi.ServerInformation) func(db *gorm.DB) server.RouteInitializer {
+	return func(db *gorm.DB) server.RouteInitializer {
+		return func(router *mux.Router, l logrus.FieldLogger) {
+			r := router.PathPrefix("/shops/analytics").Subrouter()
+			r.HandleFunc("/shops", rest.RegisterHandler(l)(db)(si)("get_shop_analytics_by_shop", handleGetByShop)).Methods(http.MethodGet)
+			r.HandleFunc("/items", rest.RegisterHandler(l)(db)(si)("get_shop_analytics_by_item", handleGetByItem)).Methods(http.MethodGet)
+			r.HandleFunc("/items/top", rest.RegisterHandler(l)(db)(si)("get_shop_analytics_top_items", handleGetTopItems)).Methods(http.MethodGet)
+			r.HandleFunc("/days", rest.RegisterHandler(l)(db)(si)("get_shop_analytics_by_day", handleGetByDay)).Methods(http.MethodGet)
+		}
+	}
+}
+
+// filterFromQuery builds a Filter from the npcId, templateId, from and to query parameters.
+func filterFromQuery(query url.Values) (Filter, error) {
+	f := Filter{}
+	if v := query.Get("npcId"); v != "" {
+		npcId, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.NpcId = uint32(npcId)
+	}
+	if v := query.Get("templateId"); v != "" {
+		templateId, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.TemplateId = uint32(templateId)
+	}
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.To = to
+	}
+	return f, nil
+}
+
+// topItemsFromQuery reads the metric items are ranked by and how many are returned from the metric and limit query
+// parameters.
+func topItemsFromQuery(query url.Values) (string, int, error) {
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = "mesoSunk"
+	}
+	limit := DefaultTopLimit
+	if v := query.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return "", 0, err
+		}
+		limit = l
+	}
+	return metric, limit, nil
+}
+
+func handleGetByShop(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return handleGetAggregates(d, c, func(p Processor, f Filter, _ url.Values) ([]Aggregate, error) {
+		return p.GetByShop(f)
+	})
+}
+
+func handleGetByItem(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return handleGetAggregates(d, c, func(p Processor, f Filter, _ url.Values) ([]Aggregate, error) {
+		return p.GetByItem(f)
+	})
+}
+
+func handleGetByDay(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return handleGetAggregates(d, c, func(p Processor, f Filter, _ url.Values) ([]Aggregate, error) {
+		return p.GetByDay(f)
+	})
+}
+
+func handleGetTopItems(d *rest.HandlerDependency, c *rest.HandlerContext) http.HandlerFunc {
+	return handleGetAggregates(d, c, func(p Processor, f Filter, query url.Values) ([]Aggregate, error) {
+		metric, limit, err := topItemsFromQuery(query)
+		if err != nil {
+			return nil, ErrInvalidQuery
+		}
+		return p.GetTopItems(f, metric, limit)
+	})
+}
+
+// handleGetAggregates serves the aggregates computed over the transactions matching the filter of the request.
+func handleGetAggregates(d *rest.HandlerDependency, c *rest.HandlerContext, aggregate func(p Processor, f Filter, query url.Values) ([]Aggregate, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := filterFromQuery(r.URL.Query())
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Parsing analytics filter.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		as, err := aggregate(NewProcessor(d.Logger(), d.Context(), d.DB()), f, r.URL.Query())
+		if errors.Is(err, ErrInvalidQuery) {
+			d.Logger().WithError(err).Errorf("Parsing analytics query.")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Aggregating shop transactions.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		res, err := model.SliceMap(TransformAggregate)(model.FixedProvider(as))(model.ParallelMap())()
+		if err != nil {
+			d.Logger().WithError(err).Errorf("Creating REST models.")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		queryParams := jsonapi.ParseQueryFields(&query)
+		server.MarshalResponse[[]AggregateRestModel](d.Logger())(w)(c.ServerInformation())(queryParams)(res)
+	}
+}
@@ -0,0 +1,59 @@
+package transactions
+
+import (
+	"strconv"
+)
+
+// AggregateRestModel is a JSON API representation of an Aggregate
+type AggregateRestModel struct {
+	Id             string `json:"-"`
+	NpcId          uint32 `json:"npcId,omitempty"`
+	TemplateId     uint32 `json:"templateId,omitempty"`
+	Day            string `json:"day,omitempty"`
+	MesoSunk       uint64 `json:"mesoSunk"`
+	MesoPaid       uint64 `json:"mesoPaid"`
+	TokensConsumed uint64 `json:"tokensConsumed"`
+	Quantity       uint64 `json:"quantity"`
+	UniqueBuyers   uint64 `json:"uniqueBuyers"`
+	Transactions   uint64 `json:"transactions"`
+}
+
+// GetID to satisfy jsonapi.MarshalIdentifier interface
+func (r AggregateRestModel) GetID() string {
+	return r.Id
+}
+
+// SetID to satisfy jsonapi.UnmarshalIdentifier interface
+func (r *AggregateRestModel) SetID(id string) error {
+	r.Id = id
+	return nil
+}
+
+// GetName to satisfy jsonapi.EntityNamer interface
+func (r AggregateRestModel) GetName() string {
+	return "shop-economy"
+}
+
+// TransformAggregate converts an Aggregate to an AggregateRestModel, identified by the key it is grouped by
+func TransformAggregate(a Aggregate) (AggregateRestModel, error) {
+	rm := AggregateRestModel{
+		NpcId:          a.NpcId(),
+		TemplateId:     a.TemplateId(),
+		Day:            a.Day(),
+		MesoSunk:       a.MesoSunk(),
+		MesoPaid:       a.MesoPaid(),
+		TokensConsumed: a.TokensConsumed(),
+		Quantity:       a.Quantity(),
+		UniqueBuyers:   a.UniqueBuyers(),
+		Transactions:   a.Transactions(),
+	}
+	switch {
+	case a.Day() != "":
+		rm.Id = a.Day()
+	case a.TemplateId() != 0:
+		rm.Id = strconv.Itoa(int(a.TemplateId()))
+	default:
+		rm.Id = strconv.Itoa(int(a.NpcId()))
+	}
+	return rm, nil
+}